@@ -60,9 +60,17 @@ type QueryState struct {
 		} `json:"rootStage"`
 		ProgressPercentage float64 `json:"progressPercentage"`
 	} `json:"stats"`
+	Error    *QueryError   `json:"error"`
 	Warnings []interface{} `json:"warnings"`
 }
 
+type QueryError struct {
+	Message   string `json:"message"`
+	ErrorCode int    `json:"errorCode"`
+	ErrorName string `json:"errorName"`
+	ErrorType string `json:"errorType"`
+}
+
 func (taskDetail Tasks) GetElapsedTime() (time.Duration, error) {
 	return time.ParseDuration(taskDetail.Stats.ElapsedTime)
 }
@@ -0,0 +1,56 @@
+package trino
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dataSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	// longer suffixes first, every unit ends with B
+	{"kB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"TB", 1 << 40},
+	{"PB", 1 << 50},
+	{"B", 1},
+}
+
+// ParseDataSize converts the data sizes returned by the trino api ( 1.23MB, 0B ... ) to bytes
+func ParseDataSize(raw string) (int64, error) {
+	value := strings.TrimSpace(raw)
+	for _, unit := range dataSizeUnits {
+		if !strings.HasSuffix(value, unit.suffix) {
+			continue
+		}
+
+		number, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid data size %s: %w", raw, err)
+		}
+
+		return int64(math.Round(number * unit.multiplier)), nil
+	}
+
+	return 0, fmt.Errorf("invalid data size %s: unknown unit", raw)
+}
+
+// ParseDuration converts the durations returned by the trino api ( 1.23ms, 2.00m, 1.50d ... ), unlike
+// time.ParseDuration it supports the days unit
+func ParseDuration(raw string) (time.Duration, error) {
+	value := strings.TrimSpace(raw)
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s: %w", raw, err)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(value)
+}
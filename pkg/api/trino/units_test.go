@@ -0,0 +1,67 @@
+package trino
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseDataSize(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected int64
+		err      bool
+	}{
+		{raw: "0B", expected: 0},
+		{raw: "512B", expected: 512},
+		{raw: "1.50kB", expected: 1536},
+		{raw: "2MB", expected: 2 << 20},
+		{raw: "1.25GB", expected: 1342177280},
+		{raw: "1TB", expected: 1 << 40},
+		{raw: "", err: true},
+		{raw: "12XB", err: true},
+		{raw: "12", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			size, err := ParseDataSize(tt.raw)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, size)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected time.Duration
+		err      bool
+	}{
+		{raw: "0.00ns", expected: 0},
+		{raw: "12.00us", expected: 12 * time.Microsecond},
+		{raw: "1.50ms", expected: 1500 * time.Microsecond},
+		{raw: "2.25s", expected: 2250 * time.Millisecond},
+		{raw: "1.50m", expected: 90 * time.Second},
+		{raw: "2.00h", expected: 2 * time.Hour},
+		{raw: "1.50d", expected: 36 * time.Hour},
+		{raw: "", err: true},
+		{raw: "xd", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			duration, err := ParseDuration(tt.raw)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, duration)
+		})
+	}
+}
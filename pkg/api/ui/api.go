@@ -4,6 +4,8 @@ import (
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/discovery"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
 	"github.com/gorilla/mux"
 	"net/http"
 )
@@ -12,6 +14,8 @@ type Api struct {
 	statsRetriever   trino.Api
 	discoveryStorage discovery.Storage
 	discover         discovery.Discovery
+	queryHistory     history.Storage
+	routingRules     routing.RulesStorage
 	logger           logging.Logger
 }
 
@@ -24,6 +28,18 @@ func NewApi(statsRetriever trino.Api, discover discovery.Discovery, discoverStor
 	}
 }
 
+// WithQueryHistory enables the /api/queries endpoints reading the queries stored by the controller
+func (a Api) WithQueryHistory(storage history.Storage) Api {
+	a.queryHistory = storage
+	return a
+}
+
+// WithRoutingRules enables the /api/routing/rules endpoints managing the user routing rules
+func (a Api) WithRoutingRules(storage routing.RulesStorage) Api {
+	a.routingRules = storage
+	return a
+}
+
 func (a *Api) Router() *mux.Router {
 	r := mux.NewRouter()
 	r.HandleFunc("/api/health", healthProbe)
@@ -33,6 +49,21 @@ func (a *Api) Router() *mux.Router {
 	r.Methods(http.MethodPost).Path("/api/cluster").HandlerFunc(a.addCluster)
 	r.Methods(http.MethodPost).Path("/api/cluster/discover").HandlerFunc(a.launchDiscover)
 
+	if a.queryHistory != nil {
+		r.Methods(http.MethodGet).Path("/api/queries").HandlerFunc(a.searchQueries)
+		r.Methods(http.MethodGet).Path("/api/queries/stats/users").HandlerFunc(a.topUsersByCpu)
+		r.Methods(http.MethodGet).Path("/api/queries/stats/hourly").HandlerFunc(a.hourlyQueries)
+		r.Methods(http.MethodGet).Path("/api/queries/{id}").HandlerFunc(a.queryDetail)
+	}
+
+	if a.routingRules != nil {
+		r.Methods(http.MethodGet).Path("/api/routing/rules").HandlerFunc(a.listRoutingRules)
+		r.Methods(http.MethodPost).Path("/api/routing/rules").HandlerFunc(a.createRoutingRule)
+		r.Methods(http.MethodGet).Path("/api/routing/rules/{id}").HandlerFunc(a.getRoutingRule)
+		r.Methods(http.MethodPut).Path("/api/routing/rules/{id}").HandlerFunc(a.updateRoutingRule)
+		r.Methods(http.MethodDelete).Path("/api/routing/rules/{id}").HandlerFunc(a.deleteRoutingRule)
+	}
+
 	return r
 }
 
@@ -2,14 +2,19 @@ package ui
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/discovery"
 	"github.com/gorilla/mux"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
+var errInvalidWeight = errors.New("invalid weight")
+
 type Cluster struct {
 	Name      string            `json:"name"`
 	Host      string            `json:"host"`
@@ -20,6 +25,8 @@ type Cluster struct {
 
 type ClusterUpdateRequest struct {
 	Enabled bool `json:"enabled"`
+	// Weight replaces the weight tag used by the weighted routing rules when set
+	Weight *int `json:"weight,omitempty"`
 }
 
 type ClustersResponse struct {
@@ -46,12 +53,22 @@ func (a Api) updateCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.discoveryStorage.Update(ctx, vars["name"], discovery.UpdateRequest{
+	update := discovery.UpdateRequest{
 		Enabled: &req.Enabled,
-	})
+	}
+
+	if req.Weight != nil {
+		update.Tags, err = a.weightedTags(r, vars["name"], *req.Weight)
+		if err != nil {
+			a.clusterUpdateError(w, err)
+			return
+		}
+	}
+
+	err = a.discoveryStorage.Update(ctx, vars["name"], update)
 
 	if err != nil {
-		if err == discovery.ErrClusterNotFound {
+		if errors.Is(err, discovery.ErrClusterNotFound) {
 			if _, err := w.Write([]byte(err.Error())); err != nil {
 				a.logger.Error("error writing response: %w", err)
 			}
@@ -69,6 +86,34 @@ func (a Api) updateCluster(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// weightedTags returns the tags of the cluster with the weight replaced, the update request replaces all the tags
+func (a Api) weightedTags(r *http.Request, name string, weight int) (map[string]string, error) {
+	if weight < 0 {
+		return nil, fmt.Errorf("%w: weight must be positive or zero", errInvalidWeight)
+	}
+
+	coordinator, err := a.discoveryStorage.Get(r.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(coordinator.Tags)+1)
+	for k, v := range coordinator.Tags {
+		tags[k] = v
+	}
+	tags[models.TagWeight] = strconv.Itoa(weight)
+	return tags, nil
+}
+
+func (a Api) clusterUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, discovery.ErrClusterNotFound), errors.Is(err, errInvalidWeight):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (a Api) clustersList(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 
@@ -9,6 +9,7 @@ import (
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/discovery"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
@@ -107,3 +108,47 @@ func TestLaunchDiscoverApi(t *testing.T) {
 
 	require.Equal(t, rr.Code, http.StatusOK)
 }
+
+func TestUpdateClusterWeightApi(t *testing.T) {
+	discoverStorage := discovery.NewMemoryStorage()
+
+	err := discoverStorage.Add(context.TODO(), models.Coordinator{
+		Name: "cluster-00",
+		URL:  tests.MustUrl("http://localhost:8080"),
+		Tags: map[string]string{
+			"test": "true",
+		},
+		Enabled: true,
+	})
+	require.NoError(t, err)
+
+	api := NewApi(trino.Mock(trino.ClusterStatistics{}, nil), discovery.Noop(), discoverStorage, logging.Noop())
+
+	tests := []struct {
+		name    string
+		cluster string
+		body    string
+		code    int
+		tags    map[string]string
+	}{
+		{name: "set weight", cluster: "cluster-00", body: `{"enabled":true,"weight":4}`, code: http.StatusOK, tags: map[string]string{"test": "true", models.TagWeight: "4"}},
+		{name: "keep weight", cluster: "cluster-00", body: `{"enabled":true}`, code: http.StatusOK, tags: map[string]string{"test": "true", models.TagWeight: "4"}},
+		{name: "drain", cluster: "cluster-00", body: `{"enabled":true,"weight":0}`, code: http.StatusOK, tags: map[string]string{"test": "true", models.TagWeight: "0"}},
+		{name: "negative weight", cluster: "cluster-00", body: `{"enabled":true,"weight":-1}`, code: http.StatusBadRequest, tags: map[string]string{"test": "true", models.TagWeight: "0"}},
+		{name: "missing cluster", cluster: "cluster-99", body: `{"enabled":true,"weight":1}`, code: http.StatusBadRequest, tags: map[string]string{"test": "true", models.TagWeight: "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "http://localhost:8080/api/cluster/"+tt.cluster, bytes.NewBufferString(tt.body))
+
+			api.updateCluster(rr, mux.SetURLVars(req, map[string]string{"name": tt.cluster}))
+			require.Equal(t, tt.code, rr.Code)
+
+			coordinator, err := discoverStorage.Get(context.TODO(), "cluster-00")
+			require.NoError(t, err)
+			require.Equal(t, tt.tags, coordinator.Tags)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const defaultTopUsers = 10
+
+type TopUsersResponse struct {
+	Users []history.UserUsage `json:"users"`
+}
+
+type HourlyQueriesResponse struct {
+	Hours []history.ClusterHourlyQueries `json:"hours"`
+}
+
+// searchQueries returns the stored queries matching the filters, the next page is requested passing
+// the next_cursor of the response as cursor parameter
+func (a Api) searchQueries(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	from, to, err := timeRange(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intParam(params, "limit", history.DefaultSearchLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := a.queryHistory.Search(r.Context(), history.SearchRequest{
+		User:          params.Get("user"),
+		Cluster:       params.Get("cluster"),
+		State:         params.Get("state"),
+		ResourceGroup: params.Get("resource_group"),
+		Text:          params.Get("text"),
+		From:          from,
+		To:            to,
+		Limit:         limit,
+		Cursor:        params.Get("cursor"),
+	})
+
+	if err != nil {
+		if errors.Is(err, history.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, result)
+}
+
+func (a Api) queryDetail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	query, err := a.queryHistory.Get(r.Context(), r.URL.Query().Get("cluster"), vars["id"])
+	if err != nil {
+		if errors.Is(err, history.ErrQueryNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, query)
+}
+
+func (a Api) topUsersByCpu(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	from, to, err := timeRange(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intParam(params, "limit", defaultTopUsers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := a.queryHistory.TopUsersByCpu(r.Context(), from, to, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, TopUsersResponse{Users: users})
+}
+
+func (a Api) hourlyQueries(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hours, err := a.queryHistory.HourlyQueries(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, HourlyQueriesResponse{Hours: hours})
+}
+
+func (a Api) writeJson(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		a.logger.Error("error writing response: %w", err)
+	}
+}
+
+// timeRange parses the optional from and to RFC3339 parameters
+func timeRange(params url.Values) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+
+	if raw := params.Get("from"); len(raw) != 0 {
+		if from, err = time.Parse(time.RFC3339, raw); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from parameter: %w", err)
+		}
+	}
+
+	if raw := params.Get("to"); len(raw) != 0 {
+		if to, err = time.Parse(time.RFC3339, raw); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to parameter: %w", err)
+		}
+	}
+
+	return from, to, nil
+}
+
+func intParam(params url.Values, name string, defaultValue int) (int, error) {
+	raw := params.Get(name)
+	if len(raw) == 0 {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter: %w", name, err)
+	}
+	return value, nil
+}
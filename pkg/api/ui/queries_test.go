@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func queryHistoryApi(t *testing.T) Api {
+	storage := history.NewMemoryStorage()
+	base := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for i, user := range []string{"alice", "bob", "alice"} {
+		submission := base.Add(time.Duration(i) * 10 * time.Minute)
+		cpu := time.Duration(i+1) * time.Second
+		err := storage.Store(context.Background(), history.Query{
+			ID:             fmt.Sprintf("q%d", i),
+			Cluster:        "trino-0",
+			State:          "FINISHED",
+			User:           user,
+			SubmissionTime: &submission,
+			CpuTime:        &cpu,
+		})
+		require.NoError(t, err)
+	}
+
+	return NewApi(nil, nil, nil, logging.Noop()).WithQueryHistory(storage)
+}
+
+func serve(api Api, target string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	return rr
+}
+
+func TestSearchQueriesApi(t *testing.T) {
+	api := queryHistoryApi(t)
+
+	rr := serve(api, "/api/queries?user=alice&limit=1")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var page history.SearchResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	require.Len(t, page.Queries, 1)
+	require.Equal(t, "q2", page.Queries[0].ID)
+	require.NotEmpty(t, page.NextCursor)
+
+	rr = serve(api, "/api/queries?user=alice&limit=1&cursor="+page.NextCursor)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var last history.SearchResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &last))
+	require.Len(t, last.Queries, 1)
+	require.Equal(t, "q0", last.Queries[0].ID)
+	require.Empty(t, last.NextCursor)
+}
+
+func TestSearchQueriesApiInvalidParameters(t *testing.T) {
+	api := queryHistoryApi(t)
+
+	tests := []string{
+		"/api/queries?from=yesterday",
+		"/api/queries?limit=ten",
+		"/api/queries?cursor=invalid",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			require.Equal(t, http.StatusBadRequest, serve(api, tt).Code)
+		})
+	}
+}
+
+func TestQueryDetailApi(t *testing.T) {
+	api := queryHistoryApi(t)
+
+	rr := serve(api, "/api/queries/q1")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var query history.Query
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &query))
+	require.Equal(t, "bob", query.User)
+
+	require.Equal(t, http.StatusNotFound, serve(api, "/api/queries/q1?cluster=trino-1").Code)
+	require.Equal(t, http.StatusNotFound, serve(api, "/api/queries/missing").Code)
+}
+
+func TestQueryStatsApi(t *testing.T) {
+	api := queryHistoryApi(t)
+
+	rr := serve(api, "/api/queries/stats/users?from=2021-01-01T00:00:00Z&to=2021-01-02T00:00:00Z")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var users TopUsersResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &users))
+	require.Equal(t, []history.UserUsage{
+		{User: "alice", Queries: 2, CpuTime: 4 * time.Second},
+		{User: "bob", Queries: 1, CpuTime: 2 * time.Second},
+	}, users.Users)
+
+	rr = serve(api, "/api/queries/stats/hourly")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var hourly HourlyQueriesResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &hourly))
+	require.Len(t, hourly.Hours, 1)
+	require.Equal(t, int64(3), hourly.Hours[0].Queries)
+}
+
+func TestQueriesApiDisabledWithoutHistory(t *testing.T) {
+	api := NewApi(nil, nil, nil, logging.Noop())
+	require.Equal(t, http.StatusNotFound, serve(api, "/api/queries").Code)
+}
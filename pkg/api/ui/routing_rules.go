@@ -0,0 +1,110 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+func (a Api) listRoutingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := a.routingRules.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, rules)
+}
+
+func (a Api) getRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := a.routingRules.Get(r.Context(), id)
+	if err != nil {
+		a.routingRuleError(w, err)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, rule)
+}
+
+func (a Api) createRoutingRule(w http.ResponseWriter, r *http.Request) {
+	var rule routing.RuleDefinition
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := a.routingRules.Create(r.Context(), rule)
+	if err != nil {
+		a.routingRuleError(w, err)
+		return
+	}
+
+	a.writeJson(w, http.StatusCreated, created)
+}
+
+func (a Api) updateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rule routing.RuleDefinition
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.ID = id
+	if err := a.routingRules.Update(r.Context(), rule); err != nil {
+		a.routingRuleError(w, err)
+		return
+	}
+
+	a.writeJson(w, http.StatusOK, rule)
+}
+
+func (a Api) deleteRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := ruleID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.routingRules.Delete(r.Context(), id); err != nil {
+		a.routingRuleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a Api) routingRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, routing.ErrRuleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, routing.ErrInvalidRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func ruleID(r *http.Request) (int64, error) {
+	raw := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rule id %s", raw)
+	}
+	return id, nil
+}
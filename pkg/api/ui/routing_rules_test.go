@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"encoding/json"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveBody(api Api, method string, target string, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if len(body) != 0 {
+		reader = strings.NewReader(body)
+	}
+
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, httptest.NewRequest(method, target, reader))
+	return rr
+}
+
+func TestRoutingRulesApi(t *testing.T) {
+	api := NewApi(nil, nil, nil, logging.Noop()).WithRoutingRules(routing.NewMemoryRulesStorage())
+
+	rr := serveBody(api, http.MethodPost, "/api/routing/rules", `{"user": "etl-(.+)", "cluster_name": "cluster-01", "cluster_tags": {"workload": "etl"}}`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var created routing.RuleDefinition
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	require.Equal(t, int64(1), created.ID)
+	require.Equal(t, 1, created.Position)
+
+	rr = serveBody(api, http.MethodPost, "/api/routing/rules", `{"user": "etl-("}`)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = serveBody(api, http.MethodPut, "/api/routing/rules/1", `{"user": "etl-(.+)", "position": 1, "cluster_name": "cluster-02", "use_default_if_unhealthy": true}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = serve(api, "/api/routing/rules/1")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var rule routing.RuleDefinition
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rule))
+	require.Equal(t, "cluster-02", rule.ClusterName)
+	require.True(t, rule.UseDefaultIfUnhealthy)
+
+	rr = serve(api, "/api/routing/rules")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var set routing.RuleSet
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &set))
+	require.Equal(t, int64(2), set.Version)
+	require.Len(t, set.Rules, 1)
+
+	rr = serveBody(api, http.MethodDelete, "/api/routing/rules/1", "")
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	require.Equal(t, http.StatusNotFound, serve(api, "/api/routing/rules/1").Code)
+	require.Equal(t, http.StatusNotFound, serveBody(api, http.MethodDelete, "/api/routing/rules/1", "").Code)
+	require.Equal(t, http.StatusBadRequest, serve(api, "/api/routing/rules/first").Code)
+}
+
+func TestRoutingRulesApiDisabled(t *testing.T) {
+	api := NewApi(nil, nil, nil, logging.Noop())
+	require.Equal(t, http.StatusNotFound, serve(api, "/api/routing/rules").Code)
+}
@@ -28,7 +28,11 @@ var legacyCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		handlers, err := configuration.CreateHandlers(redisClient, logger, notifiers, conf)
+		if redisClient == nil {
+			log.Fatal("the controller requires a redis standalone or sentinel configuration")
+		}
+
+		handlers, err := configuration.CreateHandlers(redisClient, databaseIf(conf.Features.QueryHistory.Enabled), logger, notifiers, conf)
 		if err != nil {
 			log.Fatal(err)
 		}
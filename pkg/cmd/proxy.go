@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/serving"
 	api2 "github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/ui"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/configuration"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
 	lb2 "github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/lb"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/metrics"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	"github.com/spf13/cobra"
@@ -36,8 +41,23 @@ var proxyCmd = &cobra.Command{
 			go enableProfilingServer(profilingAddr)
 		}
 
-		var routerConf configuration.RoutingConf
-		if err := viper.UnmarshalKey("routing", &routerConf); err != nil {
+		rulesConf := configuration.RoutingRulesConfiguration{
+			Source:       viper.GetString("routing.users.source"),
+			Table:        viper.GetString("routing.users.database.table"),
+			PollInterval: viper.GetDuration("routing.users.database.poll_interval"),
+		}
+
+		if err := configuration.ValidateRoutingRulesSource(rulesConf.Source); err != nil {
+			log.Fatal(err)
+		}
+
+		var rulesStorage routing.RulesStorage
+		if rulesConf.Source == configuration.RoutingRulesSourceDatabase {
+			rulesStorage = routing.NewDatabaseRulesStorage(openDatabase(), rulesConf.Table)
+		}
+
+		routerConf, rulesVersion, err := routingConfiguration(cmd.Context(), viper.GetViper(), rulesStorage)
+		if err != nil {
 			log.Fatal(err)
 		}
 
@@ -46,12 +66,84 @@ var proxyCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		publicURL, err := configuration.ParseOptionalUrl(viper.GetString("proxy.public_url"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		affinityConf := lb2.AffinityConf{
+			Enabled:      viper.GetBool("proxy.affinity.enabled"),
+			Secret:       viper.GetString("proxy.affinity.secret"),
+			SessionLinks: viper.GetBool("proxy.affinity.session_links"),
+		}
+
+		if affinityConf.Enabled && len(affinityConf.Secret) == 0 {
+			log.Fatal("proxy.affinity.secret is required when query affinity is enabled")
+		}
+
+		if affinityConf.Enabled && !viper.GetBool("proxy.uri_rewrite.enabled") {
+			log.Fatal("proxy.uri_rewrite must be enabled when query affinity is enabled")
+		}
+
 		poolConfig := lb2.PoolConfig{
 			HealthCheckDelay: viper.GetDuration("clusters.healthcheck.delay"),
 			StatisticsDelay:  viper.GetDuration("clusters.statistics.delay"),
+			LatencyDecay:     viper.GetDuration("clusters.latency.decay"),
+			UriRewrite: lb2.UriRewriteConf{
+				Enabled:   viper.GetBool("proxy.uri_rewrite.enabled"),
+				PublicURL: publicURL,
+				Affinity:  affinityConf,
+			},
+			OutlierDetection: lb2.OutlierDetectionConf{
+				Enabled:          viper.GetBool("clusters.outlier_detection.enabled"),
+				Interval:         viper.GetDuration("clusters.outlier_detection.interval"),
+				MinRequests:      viper.GetInt("clusters.outlier_detection.min_requests"),
+				MaxErrorRate:     viper.GetFloat64("clusters.outlier_detection.max_error_rate"),
+				MaxLatency:       viper.GetDuration("clusters.outlier_detection.max_latency"),
+				BaseEjectionTime: viper.GetDuration("clusters.outlier_detection.base_ejection_time"),
+				MaxEjectionTime:  viper.GetDuration("clusters.outlier_detection.max_ejection_time"),
+			},
 		}
 
+		accessLogConf := accessLogConfiguration()
+
 		pool := lb2.NewPool(poolConfig, sessionStorage, clusterHealthCheck, clusterStats, logger)
+
+		trackerConf := lb2.QueryTrackerConf{
+			Enabled:        viper.GetBool("proxy.query_tracker.enabled"),
+			AbandonTimeout: viper.GetDuration("proxy.query_tracker.abandon_timeout"),
+			SweepInterval:  viper.GetDuration("proxy.query_tracker.sweep_interval"),
+		}
+
+		// the tracker is the registry of the queries in flight also for the access log, its api is served only
+		// when enabled
+		var tracker *lb2.QueryTracker
+		if trackerConf.Enabled || accessLogConf.Enabled {
+			tracker = lb2.NewQueryTracker(trackerConf, sessionStorage, logger)
+		}
+
+		if accessLogConf.Enabled {
+			sink, err := configuration.CreateAccessLogSink(accessLogConf, logger)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			accessLog := lb2.NewQueryAccessLog(lb2.AccessLogConf{
+				Enabled:        accessLogConf.Enabled,
+				CaptureQuery:   accessLogConf.CaptureQuery,
+				RedactQuery:    accessLogConf.RedactQuery,
+				MaxQueryLength: accessLogConf.MaxQueryLength,
+			}, sink, logger)
+			defer accessLog.Close()
+
+			tracker.WithListener(accessLog)
+		}
+
+		if tracker != nil {
+			go tracker.Run(cmd.Context())
+			pool.WithQueryTracker(tracker)
+		}
+
 		sync := lb2.NewPoolStateSync(discoveryStorage, logger)
 
 		logger.Info("proxy initialized, syncing cluster state")
@@ -62,8 +154,16 @@ var proxyCmd = &cobra.Command{
 
 		logger.Info("cluster state sync success")
 
+		if clusterEvents != nil {
+			go sync.Watch(cmd.Context(), pool, clusterEvents)
+		}
+
 		conf := lb2.ProxyConf{
-			SyncDelay: viper.GetDuration("clusters.sync.delay"),
+			SyncDelay:         viper.GetDuration("clusters.sync.delay"),
+			Affinity:          affinityConf,
+			SubmissionRetries: viper.GetInt("proxy.submission.retries"),
+			CaptureQuery:      accessLogConf.Enabled && accessLogConf.CaptureQuery,
+			RouteHeader:       viper.GetBool("proxy.route_header.enabled"),
 		}
 
 		proxy := lb2.NewProxy(conf, pool, sync, sessionStorage, router, lb2.RequestReWriters(), logger)
@@ -71,15 +171,63 @@ var proxyCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		// the global viper instance is read by the proxy and never written after the startup, the configuration
+		// file is read again and watched through dedicated instances
+		configFile := viper.ConfigFileUsed()
+
+		routingReloader := configuration.NewRoutingReloader(routerConf, func() (configuration.RoutingConf, error) {
+			v, err := readRoutingConfig(configFile)
+			if err != nil {
+				return configuration.RoutingConf{}, err
+			}
+			conf, _, err := routingConfiguration(cmd.Context(), v, rulesStorage)
+			return conf, err
+		}, proxy.SetQueryRouter, logger)
+
+		if rulesStorage != nil {
+			watcher := configuration.NewRoutingRulesWatcher(rulesStorage, routingReloader, rulesVersion, rulesConf.PollInterval, logger)
+			go watcher.Run(cmd.Context())
+		}
+
+		if viper.GetBool("routing.reload.watch") {
+			watcher := viper.New()
+			watcher.SetConfigFile(configFile)
+			watcher.OnConfigChange(func(event fsnotify.Event) {
+				if _, err := routingReloader.Reload(); err != nil {
+					logger.Warn("routing reload failed, keeping the current routing: %s", err.Error())
+				}
+			})
+			watcher.WatchConfig()
+		}
+
 		port := viper.GetInt("proxy.port")
 
 		logger.Info("proxy listening on port %d", port)
 
 		httpRouter := mux.NewRouter()
 
+		if viper.GetBool("proxy.metrics.enabled") {
+			metrics.Registry.MustRegister(lb2.NewPoolCollector(pool))
+			httpRouter.Handle(viper.GetString("proxy.metrics.path"), metrics.Handler())
+		}
+
 		api := api2.NewApi(clusterStats, discover, discoveryStorage, logger)
+		// the query history is written by the controller in the postgres database
+		if viper.GetBool("controller.features.query_history.enabled") && viper.GetString("persistence.type") == configuration.PersistencePostgres {
+			api = api.WithQueryHistory(history.NewDatabaseStorage(openDatabase(), viper.GetString("controller.features.query_history.table")))
+		}
+		if rulesStorage != nil {
+			api = api.WithRoutingRules(rulesStorage)
+		}
 		uiSrv := serving.New(staticFilesPath)
 
+		if trackerConf.Enabled {
+			httpRouter.Handle("/api/proxy/queries", tracker.Handler())
+		}
+
+		httpRouter.Handle("/api/routing/reload", routingReloader.Handler())
+		httpRouter.Handle("/api/routing/explain", proxy.ExplainHandler())
+
 		httpRouter.PathPrefix("/ui").Handler(uiSrv.Router())
 		httpRouter.PathPrefix("/api").Handler(api.Router())
 		httpRouter.PathPrefix("/").Handler(proxy.Router())
@@ -96,3 +244,60 @@ var proxyCmd = &cobra.Command{
 		}
 	},
 }
+
+// routingConfiguration reads the routing from the configuration, the user rules are read from the rules storage if present
+func routingConfiguration(ctx context.Context, v *viper.Viper, rules routing.RulesStorage) (configuration.RoutingConf, int64, error) {
+	var conf configuration.RoutingConf
+	if err := v.UnmarshalKey("routing", &conf); err != nil {
+		return conf, 0, err
+	}
+
+	// the nested defaults are not applied by UnmarshalKey
+	conf.LoadScore = configuration.RoutingLoadScoreConf{
+		Running:          v.GetFloat64("routing.load_score.running"),
+		Queued:           v.GetFloat64("routing.load_score.queued"),
+		Blocked:          v.GetFloat64("routing.load_score.blocked"),
+		Memory:           v.GetFloat64("routing.load_score.memory"),
+		MaxStatisticsAge: v.GetDuration("routing.load_score.max_statistics_age"),
+		Stale:            v.GetString("routing.load_score.stale"),
+		StalePenalty:     v.GetFloat64("routing.load_score.stale_penalty"),
+	}
+
+	if rules == nil {
+		return conf, 0, nil
+	}
+
+	return configuration.LoadRoutingRules(ctx, conf, rules)
+}
+
+// readRoutingConfig reads the configuration file into a new viper instance with the routing defaults
+func readRoutingConfig(configFile string) (*viper.Viper, error) {
+	v := viper.New()
+	setRoutingDefaults(v)
+	v.SetConfigFile(configFile)
+	v.AutomaticEnv()
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func accessLogConfiguration() configuration.AccessLogConfiguration {
+	var conf configuration.AccessLogConfiguration
+	conf.Enabled = viper.GetBool("proxy.access_log.enabled")
+	conf.CaptureQuery = viper.GetBool("proxy.access_log.capture_query")
+	conf.RedactQuery = viper.GetBool("proxy.access_log.redact_query")
+	conf.MaxQueryLength = viper.GetInt("proxy.access_log.max_query_length")
+	conf.BufferSize = viper.GetInt("proxy.access_log.buffer_size")
+	conf.Sinks.Stdout.Enabled = viper.GetBool("proxy.access_log.sinks.stdout.enabled")
+	conf.Sinks.File.Enabled = viper.GetBool("proxy.access_log.sinks.file.enabled")
+	conf.Sinks.File.Path = viper.GetString("proxy.access_log.sinks.file.path")
+	conf.Sinks.File.MaxSizeMB = viper.GetInt64("proxy.access_log.sinks.file.max_size_mb")
+	conf.Sinks.File.MaxBackups = viper.GetInt("proxy.access_log.sinks.file.max_backups")
+	conf.Sinks.Http.Enabled = viper.GetBool("proxy.access_log.sinks.http.enabled")
+	conf.Sinks.Http.Endpoint = viper.GetString("proxy.access_log.sinks.http.endpoint")
+	conf.Sinks.Http.Timeout = viper.GetDuration("proxy.access_log.sinks.http.timeout")
+	conf.Sinks.Http.Headers = viper.GetStringMapString("proxy.access_log.sinks.http.headers")
+	return conf
+}
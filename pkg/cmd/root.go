@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"database/sql"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/notifier"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/configuration"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/discovery"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
 	"github.com/go-redis/redis/v8"
 	"github.com/spf13/cobra"
@@ -24,17 +27,21 @@ var (
 	configPath         string
 	logger             logging.Logger = logging.Logrus()
 	discoveryStorage   discovery.Storage
+	clusterEvents      discovery.Events
 	sessionStorage     session.Storage
 	clusterStats       trino.Api
 	clusterHealthCheck healthcheck.HealthCheck
 	discover           discovery.Discovery
 	redisClient        redis.UniversalClient
+	database           *sql.DB
 	notifiers          notifier.Notifier
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "config file path")
 
+	viper.SetDefault("persistence.type", configuration.PersistencePostgres)
+	viper.SetDefault("persistence.k8s.namespace", "default")
 	viper.SetDefault("persistence.postgres.db", "postgres")
 	viper.SetDefault("persistence.postgres.host", "127.0.0.1")
 	viper.SetDefault("persistence.postgres.port", 5432)
@@ -42,6 +49,16 @@ func init() {
 	viper.SetDefault("persistence.postgres.password", "")
 	viper.SetDefault("persistence.postgres.ssl_mode", "disable")
 
+	viper.SetDefault("session.store.type", configuration.SessionStorageRedis)
+
+	viper.SetDefault("session.store.cache.max_entries", session.DefaultCacheMaxEntries)
+	viper.SetDefault("session.store.cache.shards", session.DefaultCacheShards)
+	viper.SetDefault("session.store.cache.ttl", 0)
+
+	viper.SetDefault("session.store.postgres.table", session.DefaultDatabaseTableName)
+	viper.SetDefault("session.store.postgres.ttl", 24*time.Hour)
+	viper.SetDefault("session.store.postgres.cleanup_interval", 10*time.Minute)
+
 	viper.SetDefault("session.store.redis.opts.prefix", "github.com/The-Data-Appeal-Company/trino-loadbalancer::")
 	viper.SetDefault("session.store.redis.opts.max_ttl", 24*time.Hour)
 
@@ -57,14 +74,53 @@ func init() {
 	viper.SetDefault("clusters.statistics.enabled", true)
 	viper.SetDefault("clusters.healthcheck.enabled", true)
 	viper.SetDefault("clusters.healthcheck.type", "http")
+	viper.SetDefault("clusters.healthcheck.failure_threshold", 1)
+	viper.SetDefault("clusters.healthcheck.success_threshold", 1)
+	viper.SetDefault("clusters.healthcheck.http.timeout", 15*time.Second)
+	viper.SetDefault("clusters.healthcheck.http.min_workers", 1)
+	viper.SetDefault("clusters.healthcheck.http.min_version", 0)
+	viper.SetDefault("clusters.healthcheck.query.timeout", 15*time.Second)
+	viper.SetDefault("clusters.healthcheck.query.sql", "select 1")
+	viper.SetDefault("clusters.healthcheck.query.user", "hc")
 
 	viper.SetDefault("proxy.port", 8998)
-
-	viper.SetDefault("routing.rule", "round-robin")
+	viper.SetDefault("proxy.public_url", "")
+	viper.SetDefault("proxy.uri_rewrite.enabled", false)
+	viper.SetDefault("proxy.affinity.enabled", false)
+	viper.SetDefault("proxy.affinity.session_links", false)
+	viper.SetDefault("proxy.submission.retries", 0)
+	viper.SetDefault("proxy.metrics.enabled", false)
+	viper.SetDefault("proxy.metrics.path", "/metrics")
+	viper.SetDefault("proxy.query_tracker.enabled", false)
+	viper.SetDefault("proxy.query_tracker.abandon_timeout", 10*time.Minute)
+	viper.SetDefault("proxy.query_tracker.sweep_interval", time.Minute)
+	viper.SetDefault("proxy.access_log.enabled", false)
+	viper.SetDefault("proxy.access_log.capture_query", false)
+	viper.SetDefault("proxy.access_log.redact_query", true)
+	viper.SetDefault("proxy.access_log.max_query_length", 4096)
+	viper.SetDefault("proxy.access_log.buffer_size", 1024)
+	viper.SetDefault("proxy.access_log.sinks.stdout.enabled", true)
+	viper.SetDefault("proxy.access_log.sinks.file.max_size_mb", 100)
+	viper.SetDefault("proxy.access_log.sinks.file.max_backups", 5)
+	viper.SetDefault("proxy.access_log.sinks.http.timeout", 5*time.Second)
+
+	viper.SetDefault("proxy.route_header.enabled", false)
+
+	setRoutingDefaults(viper.GetViper())
 
 	viper.SetDefault("clusters.healthcheck.delay", 10*time.Second)
 	viper.SetDefault("clusters.statistics.delay", 10*time.Second)
+	viper.SetDefault("clusters.latency.decay", 10*time.Second)
 	viper.SetDefault("clusters.sync.delay", 10*time.Minute)
+	viper.SetDefault("clusters.sync.events.channel", discovery.DefaultEventsChannel)
+
+	viper.SetDefault("clusters.outlier_detection.enabled", false)
+	viper.SetDefault("clusters.outlier_detection.interval", 30*time.Second)
+	viper.SetDefault("clusters.outlier_detection.min_requests", 10)
+	viper.SetDefault("clusters.outlier_detection.max_error_rate", 0.5)
+	viper.SetDefault("clusters.outlier_detection.max_latency", 0)
+	viper.SetDefault("clusters.outlier_detection.base_ejection_time", 30*time.Second)
+	viper.SetDefault("clusters.outlier_detection.max_ejection_time", 5*time.Minute)
 
 	viper.SetDefault("discovery.enabled", false)
 
@@ -72,6 +128,8 @@ func init() {
 	viper.SetDefault("controller.features.slow_worker_drainer.gracePeriodSeconds", 300)
 	viper.SetDefault("controller.features.slow_worker_drainer.dryRun", true)
 	viper.SetDefault("controller.features.slow_worker_drainer.drainThreshold", 3)
+	viper.SetDefault("controller.features.query_history.enabled", false)
+	viper.SetDefault("controller.features.query_history.table", history.DefaultTableName)
 
 	cobra.OnInitialize(func() {
 		err := readConfig()
@@ -79,20 +137,8 @@ func init() {
 			log.Fatal(err)
 		}
 
-		discoveryStorage, err = configuration.CreateDiscoveryStorage(configuration.DiscoveryStorageConfiguration{
-			Db:       viper.GetString("persistence.postgres.db"),
-			Host:     viper.GetString("persistence.postgres.host"),
-			Port:     viper.GetInt("persistence.postgres.port"),
-			User:     viper.GetString("persistence.postgres.username"),
-			Password: viper.GetString("persistence.postgres.password"),
-			SslMode:  viper.GetString("persistence.postgres.ssl_mode"),
-		})
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		redisConfig := configuration.SessionStorageConfiguration{
+		sessionConfig := configuration.SessionStorageConfiguration{
+			Type: viper.GetString("session.store.type"),
 			Standalone: configuration.RedisSessionStorageConfiguration{
 				Enabled:  viper.GetBool("session.store.redis.standalone.enabled"),
 				Host:     viper.GetString("session.store.redis.standalone.host"),
@@ -110,22 +156,96 @@ func init() {
 				Prefix: viper.GetString("session.store.redis.opts.prefix"),
 				MaxTTL: viper.GetDuration("session.store.redis.opts.max_ttl"),
 			},
+			Postgres: configuration.PostgresSessionStorageConfiguration{
+				Table:           viper.GetString("session.store.postgres.table"),
+				TTL:             viper.GetDuration("session.store.postgres.ttl"),
+				CleanupInterval: viper.GetDuration("session.store.postgres.cleanup_interval"),
+			},
+			Cache: configuration.SessionCacheConfiguration{
+				MaxEntries: viper.GetInt("session.store.cache.max_entries"),
+				Shards:     viper.GetInt("session.store.cache.shards"),
+				TTL:        viper.GetDuration("session.store.cache.ttl"),
+			},
 		}
 
-		redisClient, err = configuration.CreateRedisStorageClient(redisConfig)
+		redisClient = configuration.CreateRedisStorageClient(sessionConfig)
+
+		sessionStorage, err = configuration.CreateSessionStorage(sessionConfig, redisClient, databaseIf(sessionConfig.Type == configuration.SessionStoragePostgres), logger)
+
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		sessionStorage, err = configuration.CreateSessionStorage(redisClient, redisConfig)
+		persistenceConf := configuration.PersistenceConfiguration{
+			Type:     viper.GetString("persistence.type"),
+			Postgres: postgresConfiguration(),
+			File: configuration.FileStorageConfiguration{
+				Path: viper.GetString("persistence.file.path"),
+			},
+			K8s: configuration.K8sStorageConfiguration{
+				KubeConfig: viper.GetString("persistence.k8s.kube_config"),
+				Namespace:  viper.GetString("persistence.k8s.namespace"),
+			},
+		}
+
+		// the k8s storage is the source of its own events, the proxies watch the resources
+		if persistenceConf.Type != configuration.PersistenceK8s {
+			viper.SetDefault("clusters.sync.events.type", configuration.DefaultClusterEvents(persistenceConf.Type))
+
+			if persistenceConf.Type == configuration.PersistenceFile && viper.GetString("clusters.sync.events.type") == configuration.ClusterEventsPostgres {
+				log.Fatal("clusters.sync.events.type postgres requires the postgres persistence, use memory or redis with the file persistence")
+			}
+
+			eventsConf := configuration.ClusterEventsConfiguration{
+				Type:    viper.GetString("clusters.sync.events.type"),
+				Channel: viper.GetString("clusters.sync.events.channel"),
+			}
+
+			clusterEvents, err = configuration.CreateClusterEvents(eventsConf, redisClient, databaseIf(eventsConf.Type == configuration.ClusterEventsPostgres), postgresConfiguration(), logger)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		discoveryStorage, err = configuration.CreateDiscoveryStorage(persistenceConf, databaseIf(persistenceConf.Type == configuration.PersistencePostgres), clusterEvents, logger)
 
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		if crdStorage, ok := discoveryStorage.(*discovery.CrdStorage); ok {
+			clusterEvents = crdStorage
+		} else if clusterEvents != nil {
+			discoveryStorage = discovery.NewNotifyingStorage(discoveryStorage, clusterEvents, logger)
+		}
+
 		clusterHealthCheck, err = configuration.CreateHealthCheck(configuration.HealthCheckConfiguration{
-			Enabled: viper.GetBool("clusters.healthcheck.enabled"),
-			Type:    viper.GetString("clusters.healthcheck.type"),
+			Enabled:          viper.GetBool("clusters.healthcheck.enabled"),
+			Type:             viper.GetString("clusters.healthcheck.type"),
+			FailureThreshold: viper.GetInt("clusters.healthcheck.failure_threshold"),
+			SuccessThreshold: viper.GetInt("clusters.healthcheck.success_threshold"),
+			Http: healthcheck.HttpHealthConf{
+				Timeout:    viper.GetDuration("clusters.healthcheck.http.timeout"),
+				MinWorkers: viper.GetInt("clusters.healthcheck.http.min_workers"),
+				MinVersion: viper.GetInt("clusters.healthcheck.http.min_version"),
+			},
+			Query: healthcheck.QueryHealthConf{
+				Timeout:     viper.GetDuration("clusters.healthcheck.query.timeout"),
+				Sql:         viper.GetString("clusters.healthcheck.query.sql"),
+				User:        viper.GetString("clusters.healthcheck.query.user"),
+				Password:    viper.GetString("clusters.healthcheck.query.password"),
+				AccessToken: viper.GetString("clusters.healthcheck.query.access_token"),
+				Catalog:     viper.GetString("clusters.healthcheck.query.catalog"),
+				Schema:      viper.GetString("clusters.healthcheck.query.schema"),
+				Expect:      viper.GetString("clusters.healthcheck.query.expect"),
+				TLS: healthcheck.TLSConf{
+					InsecureSkipVerify: viper.GetBool("clusters.healthcheck.query.tls.insecure_skip_verify"),
+					CAFile:             viper.GetString("clusters.healthcheck.query.tls.ca_file"),
+					CertFile:           viper.GetString("clusters.healthcheck.query.tls.cert_file"),
+					KeyFile:            viper.GetString("clusters.healthcheck.query.tls.key_file"),
+				},
+			},
 		})
 		if err != nil {
 			log.Fatal(err)
@@ -181,3 +301,53 @@ func readConfig() error {
 
 	return viper.ReadInConfig()
 }
+
+// setRoutingDefaults sets the routing defaults, they are set also on the instances used to reload the routing
+func setRoutingDefaults(v *viper.Viper) {
+	v.SetDefault("routing.rule", "round-robin")
+	v.SetDefault("routing.reload.watch", false)
+	v.SetDefault("routing.load_score.running", 1)
+	v.SetDefault("routing.load_score.queued", 2)
+	v.SetDefault("routing.load_score.blocked", 0)
+	v.SetDefault("routing.load_score.memory", 0)
+	v.SetDefault("routing.load_score.max_statistics_age", 30*time.Second)
+	v.SetDefault("routing.load_score.stale", string(routing.StaleStatisticsPenalize))
+	v.SetDefault("routing.load_score.stale_penalty", 1000)
+	v.SetDefault("routing.users.source", configuration.RoutingRulesSourceConfig)
+	v.SetDefault("routing.users.database.table", routing.DefaultRulesTableName)
+	v.SetDefault("routing.users.database.poll_interval", 10*time.Second)
+}
+
+func postgresConfiguration() configuration.DiscoveryStorageConfiguration {
+	return configuration.DiscoveryStorageConfiguration{
+		Db:       viper.GetString("persistence.postgres.db"),
+		Host:     viper.GetString("persistence.postgres.host"),
+		Port:     viper.GetInt("persistence.postgres.port"),
+		User:     viper.GetString("persistence.postgres.username"),
+		Password: viper.GetString("persistence.postgres.password"),
+		SslMode:  viper.GetString("persistence.postgres.ssl_mode"),
+	}
+}
+
+// openDatabase opens the postgres database the first time a component configured for postgres needs it
+func openDatabase() *sql.DB {
+	if database != nil {
+		return database
+	}
+
+	db, err := configuration.CreateDatabase(postgresConfiguration())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database = db
+	return database
+}
+
+// databaseIf returns the postgres database only when needed, the components not configured for postgres get nil
+func databaseIf(needed bool) *sql.DB {
+	if !needed {
+		return nil
+	}
+	return openDatabase()
+}
@@ -10,3 +10,6 @@ type Coordinator struct {
 	Tags    map[string]string
 	Enabled bool
 }
+
+// TagWeight is the tag holding the relative weight of the coordinator, used by the weighted routing
+const TagWeight = "weight"
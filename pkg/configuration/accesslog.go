@@ -0,0 +1,69 @@
+package configuration
+
+import (
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/accesslog"
+	"os"
+	"time"
+)
+
+type AccessLogConfiguration struct {
+	Enabled        bool
+	CaptureQuery   bool
+	RedactQuery    bool
+	MaxQueryLength int
+	BufferSize     int
+	Sinks          struct {
+		Stdout struct {
+			Enabled bool
+		}
+		File struct {
+			Enabled    bool
+			Path       string
+			MaxSizeMB  int64
+			MaxBackups int
+		}
+		Http struct {
+			Enabled  bool
+			Endpoint string
+			Timeout  time.Duration
+			Headers  map[string]string
+		}
+	}
+}
+
+// CreateAccessLogSink creates the configured sinks, the writes are performed asynchronously to avoid
+// slowing down the proxied requests
+func CreateAccessLogSink(conf AccessLogConfiguration, logger logging.Logger) (accesslog.Sink, error) {
+	sinks := make([]accesslog.Sink, 0)
+
+	if conf.Sinks.Stdout.Enabled {
+		sinks = append(sinks, accesslog.NewWriterSink(os.Stdout))
+	}
+
+	if conf.Sinks.File.Enabled {
+		if len(conf.Sinks.File.Path) == 0 {
+			return nil, errors.New("access log file path is required")
+		}
+
+		file, err := accesslog.NewFileSink(conf.Sinks.File.Path, conf.Sinks.File.MaxSizeMB*1024*1024, conf.Sinks.File.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, file)
+	}
+
+	if conf.Sinks.Http.Enabled {
+		if len(conf.Sinks.Http.Endpoint) == 0 {
+			return nil, errors.New("access log http endpoint is required")
+		}
+		sinks = append(sinks, accesslog.NewHttpSink(conf.Sinks.Http.Endpoint, conf.Sinks.Http.Headers, conf.Sinks.Http.Timeout))
+	}
+
+	if len(sinks) == 0 {
+		return nil, errors.New("access log is enabled but no sink is configured")
+	}
+
+	return accesslog.NewAsyncSink(accesslog.NewMultiSink(sinks...), conf.BufferSize, logger), nil
+}
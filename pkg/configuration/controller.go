@@ -1,10 +1,12 @@
 package configuration
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/notifier"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/controller/components"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
 	"github.com/go-redis/redis/v8"
 	"time"
 )
@@ -12,6 +14,7 @@ import (
 type ControllerConf struct {
 	Features struct {
 		SlowWorkerDrainer SlowWorkerDrainerConf `json:"slow_worker_drainer" yaml:"slow_worker_drainer" mapstructure:"slow_worker_drainer"`
+		QueryHistory      QueryHistoryConf      `json:"query_history" yaml:"query_history" mapstructure:"query_history"`
 	} `json:"features" yaml:"features" mapstructure:"features"`
 }
 
@@ -55,7 +58,12 @@ type SlowWorkerDrainerConf struct {
 	} `json:"analyzer" yaml:"analyzer" mapstructure:"analyzer"`
 }
 
-func CreateHandlers(redisClient redis.UniversalClient, logger logging.Logger, notifier notifier.Notifier, conf ControllerConf) (components.QueryHandler, error) {
+type QueryHistoryConf struct {
+	Enabled bool   `json:"enabled" yaml:"enabled" mapstructure:"enabled"`
+	Table   string `json:"table" yaml:"table" mapstructure:"table"`
+}
+
+func CreateHandlers(redisClient redis.UniversalClient, db *sql.DB, logger logging.Logger, notifier notifier.Notifier, conf ControllerConf) (components.QueryHandler, error) {
 	handlers := make([]components.QueryHandler, 0)
 
 	slowNodeDrainerConf := conf.Features.SlowWorkerDrainer
@@ -68,6 +76,14 @@ func CreateHandlers(redisClient redis.UniversalClient, logger logging.Logger, no
 		handlers = append(handlers, slowWorkerHandler)
 	}
 
+	if conf.Features.QueryHistory.Enabled {
+		table := conf.Features.QueryHistory.Table
+		if len(table) == 0 {
+			table = history.DefaultTableName
+		}
+		handlers = append(handlers, components.NewQueryHistory(history.NewDatabaseStorage(db, table), logger))
+	}
+
 	return components.NewMultiQueryHandler(handlers...), nil
 }
 
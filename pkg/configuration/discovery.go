@@ -1,10 +1,14 @@
 package configuration
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/discovery"
+	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 	"net/url"
 )
@@ -18,15 +22,113 @@ type DiscoveryStorageConfiguration struct {
 	Password string
 }
 
-func CreateDiscoveryStorage(conf DiscoveryStorageConfiguration) (discovery.Storage, error) {
-	conn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s", conf.User, url.QueryEscape(conf.Password), conf.Host, conf.Port, conf.Db, conf.SslMode)
+const (
+	PersistencePostgres = "postgres"
+	PersistenceFile     = "file"
+	PersistenceK8s      = "k8s"
+)
+
+type FileStorageConfiguration struct {
+	Path string
+}
+
+type K8sStorageConfiguration struct {
+	KubeConfig string
+	Namespace  string
+}
+
+type PersistenceConfiguration struct {
+	Type     string
+	Postgres DiscoveryStorageConfiguration
+	File     FileStorageConfiguration
+	K8s      K8sStorageConfiguration
+}
+
+// CreateDiscoveryStorage creates the clusters storage, the file storage is watched for external changes that are
+// published as resync events when events is not nil
+func CreateDiscoveryStorage(conf PersistenceConfiguration, db *sql.DB, events discovery.Events, logger logging.Logger) (discovery.Storage, error) {
+	switch conf.Type {
+	case PersistencePostgres:
+		return discovery.NewDatabaseStorage(db, discovery.DefaultDatabaseTableName), nil
+	case PersistenceFile:
+		if len(conf.File.Path) == 0 {
+			return nil, errors.New("persistence.file.path is required by the file persistence")
+		}
 
-	db, err := sql.Open("postgres", conn)
-	if err != nil {
-		return nil, err
+		storage, err := discovery.NewFileStorage(conf.File.Path, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		if events != nil {
+			storage.WithEvents(events)
+		}
+
+		go func() {
+			if err := storage.Watch(context.Background()); err != nil {
+				logger.Error("error watching %s, external changes will not be reloaded: %s", conf.File.Path, err.Error())
+			}
+		}()
+
+		return storage, nil
+	case PersistenceK8s:
+		client, err := NewK8sDynamicClient(&conf.K8s.KubeConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return discovery.NewCrdStorage(client, conf.K8s.Namespace, logger), nil
+	}
+
+	return nil, fmt.Errorf("persistence for type %s not found", conf.Type)
+}
+
+func CreateDatabase(conf DiscoveryStorageConfiguration) (*sql.DB, error) {
+	return sql.Open("postgres", postgresConnectionString(conf))
+}
+
+func postgresConnectionString(conf DiscoveryStorageConfiguration) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s", conf.User, url.QueryEscape(conf.Password), conf.Host, conf.Port, conf.Db, conf.SslMode)
+}
+
+const (
+	ClusterEventsNone     = "none"
+	ClusterEventsMemory   = "memory"
+	ClusterEventsRedis    = "redis"
+	ClusterEventsPostgres = "postgres"
+)
+
+// DefaultClusterEvents returns the cluster events used when none are configured: the postgres persistence
+// notifies through its own database, the other persistences notify only the local proxy
+func DefaultClusterEvents(persistenceType string) string {
+	if persistenceType == PersistencePostgres {
+		return ClusterEventsPostgres
+	}
+	return ClusterEventsMemory
+}
+
+type ClusterEventsConfiguration struct {
+	Type    string
+	Channel string
+}
+
+// CreateClusterEvents returns nil when the events are disabled, the proxies rely only on the periodic sync
+func CreateClusterEvents(conf ClusterEventsConfiguration, client redis.UniversalClient, db *sql.DB, dbConf DiscoveryStorageConfiguration, logger logging.Logger) (discovery.Events, error) {
+	switch conf.Type {
+	case ClusterEventsNone, "":
+		return nil, nil
+	case ClusterEventsMemory:
+		return discovery.NewMemoryEvents(), nil
+	case ClusterEventsRedis:
+		if client == nil {
+			return nil, errors.New("redis cluster events require a redis standalone or sentinel configuration")
+		}
+		return discovery.NewRedisEvents(client, conf.Channel, logger), nil
+	case ClusterEventsPostgres:
+		return discovery.NewDatabaseEvents(db, postgresConnectionString(dbConf), conf.Channel, logger), nil
 	}
 
-	return discovery.NewDatabaseStorage(db, discovery.DefaultDatabaseTableName), nil
+	return nil, fmt.Errorf("cluster events for type %s not found", conf.Type)
 }
 
 type DiscoveryConfiguration struct {
@@ -8,6 +8,12 @@ import (
 type HealthCheckConfiguration struct {
 	Enabled bool
 	Type    string
+	// FailureThreshold is the number of consecutive failed checks required to mark an healthy cluster as unhealthy
+	FailureThreshold int
+	// SuccessThreshold is the number of consecutive successful checks required to mark an unhealthy cluster as healthy
+	SuccessThreshold int
+	Http             healthcheck.HttpHealthConf
+	Query            healthcheck.QueryHealthConf
 }
 
 const (
@@ -20,16 +26,25 @@ func CreateHealthCheck(conf HealthCheckConfiguration) (healthcheck.HealthCheck,
 		return healthcheck.NoOp(), nil
 	}
 
-	return getHealthCheckFromType(conf.Type)
+	check, err := getHealthCheckFromType(conf)
+	if err != nil {
+		return check, err
+	}
+
+	if conf.FailureThreshold > 1 || conf.SuccessThreshold > 1 {
+		return healthcheck.NewThresholdHealthCheck(check, conf.FailureThreshold, conf.SuccessThreshold), nil
+	}
+
+	return check, nil
 }
 
-func getHealthCheckFromType(healthType string) (healthcheck.HealthCheck, error) {
+func getHealthCheckFromType(conf HealthCheckConfiguration) (healthcheck.HealthCheck, error) {
 
-	switch healthType {
+	switch conf.Type {
 	case healthCheckTypeQuery:
-		return healthcheck.NewTrinoQueryHealth(), nil
+		return healthcheck.NewTrinoQueryHealthWithConf(conf.Query)
 	case healthCheckTypeHttp:
-		return healthcheck.NewHttpHealth(), nil
+		return healthcheck.NewHttpHealthWithConf(conf.Http), nil
 	default:
 		return healthcheck.NoOp(), fmt.Errorf("invalid health check type")
 	}
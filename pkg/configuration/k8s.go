@@ -1,6 +1,7 @@
 package configuration
 
 import (
+	"k8s.io/client-go/dynamic"
 	k8s "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -36,3 +37,12 @@ func NewK8sClient(kubeConfig *string) (k8s.Interface, error) {
 
 	return client, nil
 }
+
+func NewK8sDynamicClient(kubeConfig *string) (dynamic.Interface, error) {
+	kubeConf, err := newConfiguration(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(kubeConf)
+}
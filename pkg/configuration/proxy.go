@@ -0,0 +1,24 @@
+package configuration
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ParseOptionalUrl parses an url that may be omitted from the configuration, an empty value returns a nil url
+func ParseOptionalUrl(raw string) (*url.URL, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if !uri.IsAbs() || len(uri.Host) == 0 {
+		return nil, fmt.Errorf("invalid url %s: scheme and host are required", raw)
+	}
+
+	return uri, nil
+}
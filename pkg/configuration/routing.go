@@ -4,31 +4,81 @@ import (
 	"errors"
 	"fmt"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/statement"
+	"net"
+	"net/http"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+type RoutingClusterConf struct {
+	Name string            `json:"name" yaml:"name" mapstructure:"name"`
+	Tags map[string]string `json:"tags" yaml:"tags" mapstructure:"tags"`
+}
+
+// RoutingMatchConf contains the conditions on the request, the conditions set are combined with AND: every
+// condition and every matcher in all must match, at least one matcher in any must match
+type RoutingMatchConf struct {
+	User         string             `json:"user" yaml:"user" mapstructure:"user"`
+	Source       string             `json:"source" yaml:"source" mapstructure:"source"`
+	ClientTags   []string           `json:"client_tags" yaml:"client_tags" mapstructure:"client_tags"`
+	RoutingGroup string             `json:"routing_group" yaml:"routing_group" mapstructure:"routing_group"`
+	Headers      map[string]string  `json:"headers" yaml:"headers" mapstructure:"headers"`
+	ClientCidrs  []string           `json:"client_cidrs" yaml:"client_cidrs" mapstructure:"client_cidrs"`
+	All          []RoutingMatchConf `json:"all" yaml:"all" mapstructure:"all"`
+	Any          []RoutingMatchConf `json:"any" yaml:"any" mapstructure:"any"`
+}
+
+type RoutingUserRuleConf struct {
+	User                  string             `json:"user" yaml:"user" mapstructure:"user"`
+	Match                 *RoutingMatchConf  `json:"match" yaml:"match" mapstructure:"match"`
+	UseDefaultIfUnhealthy bool               `json:"use_default_if_unhealthy" yaml:"use_default_if_unhealthy" mapstructure:"use_default_if_unhealthy"`
+	Cluster               RoutingClusterConf `json:"cluster" yaml:"cluster" mapstructure:"cluster"`
+}
+
+type RoutingUsersDefaultConf struct {
+	Behaviour string             `json:"behaviour" yaml:"behaviour" mapstructure:"behaviour"`
+	Cluster   RoutingClusterConf `json:"cluster" yaml:"cluster" mapstructure:"cluster"`
+}
+
 type RoutingUsersConf struct {
-	Default struct {
-		Behaviour string `json:"behaviour" yaml:"behaviour" mapstructure:"behaviour"`
-		Cluster   struct {
-			Name string            `json:"name" yaml:"name" mapstructure:"name"`
-			Tags map[string]string `json:"tags" yaml:"tags" mapstructure:"tags"`
-		} `json:"cluster" yaml:"cluster" mapstructure:"cluster"`
-	} `json:"default" yaml:"default" mapstructure:"default"`
-	Rules []struct {
-		User                  string `json:"user" yaml:"user" mapstructure:"user"`
-		UseDefaultIfUnhealthy bool   `json:"use_default_if_unhealthy" yaml:"use_default_if_unhealthy" mapstructure:"use_default_if_unhealthy"`
-		Cluster               struct {
-			Name string            `json:"name" yaml:"name" mapstructure:"name"`
-			Tags map[string]string `json:"tags" yaml:"tags" mapstructure:"tags"`
-		} `json:"cluster" yaml:"cluster" mapstructure:"cluster"`
-	} `json:"rules" yaml:"rules" mapstructure:"rules"`
+	Default RoutingUsersDefaultConf `json:"default" yaml:"default" mapstructure:"default"`
+	Rules   []RoutingUserRuleConf   `json:"rules" yaml:"rules" mapstructure:"rules"`
+}
+
+// RoutingStatementRuleConf filters the clusters for the statements of the types referencing a table matching
+// the catalog, schema and table patterns
+type RoutingStatementRuleConf struct {
+	Types    []string           `json:"types" yaml:"types" mapstructure:"types"`
+	Catalog  string             `json:"catalog" yaml:"catalog" mapstructure:"catalog"`
+	Schema   string             `json:"schema" yaml:"schema" mapstructure:"schema"`
+	Table    string             `json:"table" yaml:"table" mapstructure:"table"`
+	Fallback bool               `json:"fallback" yaml:"fallback" mapstructure:"fallback"`
+	Cluster  RoutingClusterConf `json:"cluster" yaml:"cluster" mapstructure:"cluster"`
+}
+
+type RoutingStatementsConf struct {
+	Rules []RoutingStatementRuleConf `json:"rules" yaml:"rules" mapstructure:"rules"`
+}
+
+// RoutingLoadScoreConf contains the coefficients and the statistics freshness of the load-score rule
+type RoutingLoadScoreConf struct {
+	Running          float64       `json:"running" yaml:"running" mapstructure:"running"`
+	Queued           float64       `json:"queued" yaml:"queued" mapstructure:"queued"`
+	Blocked          float64       `json:"blocked" yaml:"blocked" mapstructure:"blocked"`
+	Memory           float64       `json:"memory" yaml:"memory" mapstructure:"memory"`
+	MaxStatisticsAge time.Duration `json:"max_statistics_age" yaml:"max_statistics_age" mapstructure:"max_statistics_age"`
+	Stale            string        `json:"stale" yaml:"stale" mapstructure:"stale"`
+	StalePenalty     float64       `json:"stale_penalty" yaml:"stale_penalty" mapstructure:"stale_penalty"`
 }
 
 type RoutingConf struct {
-	Rule  string           `json:"rule" yaml:"rule" mapstructure:"rule"`
-	Users RoutingUsersConf `json:"users" yaml:"users" mapstructure:"users"`
+	Rule       string                `json:"rule" yaml:"rule" mapstructure:"rule"`
+	LoadScore  RoutingLoadScoreConf  `json:"load_score" yaml:"load_score" mapstructure:"load_score"`
+	Users      RoutingUsersConf      `json:"users" yaml:"users" mapstructure:"users"`
+	Statements RoutingStatementsConf `json:"statements" yaml:"statements" mapstructure:"statements"`
 }
 
 func CreateQueryRouter(conf RoutingConf) (routing.Router, error) {
@@ -37,23 +87,85 @@ func CreateQueryRouter(conf RoutingConf) (routing.Router, error) {
 		return routing.Router{}, err
 	}
 
-	rule, err := createRouterRule(conf.Rule)
+	statementRouter, err := createStatementRouter(conf.Statements)
+	if err != nil {
+		return routing.Router{}, err
+	}
+
+	rule, err := createRouterRule(conf)
 	if err != nil {
 		return routing.Router{}, err
 	}
 
-	return routing.New(userAwareRouter, rule), nil
+	return routing.New(userAwareRouter, rule).WithStatementRouter(statementRouter), nil
+}
+
+func createStatementRouter(conf RoutingStatementsConf) (routing.StatementRouter, error) {
+	rules := make([]routing.StatementRule, len(conf.Rules))
+	for i, r := range conf.Rules {
+		types := make([]statement.Type, len(r.Types))
+		for j, raw := range r.Types {
+			t, err := statement.ParseType(raw)
+			if err != nil {
+				return routing.StatementRouter{}, fmt.Errorf("invalid statement routing rule %d: %w", i, err)
+			}
+			types[j] = t
+		}
+
+		catalogRe, err := regexpOrNil(r.Catalog)
+		if err != nil {
+			return routing.StatementRouter{}, fmt.Errorf("invalid catalog on statement routing rule %d: %w", i, err)
+		}
+
+		schemaRe, err := regexpOrNil(r.Schema)
+		if err != nil {
+			return routing.StatementRouter{}, fmt.Errorf("invalid schema on statement routing rule %d: %w", i, err)
+		}
+
+		tableRe, err := regexpOrNil(r.Table)
+		if err != nil {
+			return routing.StatementRouter{}, fmt.Errorf("invalid table on statement routing rule %d: %w", i, err)
+		}
+
+		clusterNameRe, err := regexpOrNil(r.Cluster.Name)
+		if err != nil {
+			return routing.StatementRouter{}, fmt.Errorf("invalid cluster name on statement routing rule %d: %w", i, err)
+		}
+
+		if len(types) == 0 && catalogRe == nil && schemaRe == nil && tableRe == nil {
+			return routing.StatementRouter{}, fmt.Errorf("statement routing rule %d has no conditions", i)
+		}
+
+		rules[i] = routing.StatementRule{
+			Types:   types,
+			Catalog: catalogRe,
+			Schema:  schemaRe,
+			Table:   tableRe,
+			Cluster: routing.UserAwareClusterMatchRule{
+				Name: clusterNameRe,
+				Tags: r.Cluster.Tags,
+			},
+			Fallback: r.Fallback,
+		}
+	}
+
+	return routing.NewStatementRouter(rules), nil
 }
 
 func createUserAwareRouter(users RoutingUsersConf) (routing.UserAwareRouter, error) {
+	// without rules every user is routed to every cluster, the default is never used
+	if len(users.Rules) == 0 {
+		return routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), nil
+	}
+
 	defaultBehaviour, err := createBehaviour(users.Default.Behaviour)
 	if err != nil {
-		return routing.UserAwareRouter{}, nil
+		return routing.UserAwareRouter{}, err
 	}
 
 	defaultNameRe, err := regexpOrNil(users.Default.Cluster.Name)
 	if err != nil {
-		return routing.UserAwareRouter{}, nil
+		return routing.UserAwareRouter{}, fmt.Errorf("invalid default cluster name: %w", err)
 	}
 
 	var conf routing.UserAwareRoutingConf
@@ -69,20 +181,29 @@ func createUserAwareRouter(users RoutingUsersConf) (routing.UserAwareRouter, err
 	for i, r := range users.Rules {
 		userRe, err := regexpOrNil(r.User)
 		if err != nil {
-			return routing.UserAwareRouter{}, nil
+			return routing.UserAwareRouter{}, fmt.Errorf("invalid user on routing rule %d: %w", i, err)
+		}
+
+		var matcher routing.Matcher
+		if r.Match != nil {
+			matcher, err = createMatcher(*r.Match)
+			if err != nil {
+				return routing.UserAwareRouter{}, fmt.Errorf("invalid match on routing rule %d: %w", i, err)
+			}
 		}
 
-		if userRe == nil {
-			return routing.UserAwareRouter{}, errors.New("user must be specified on routing rule")
+		if userRe == nil && matcher == nil {
+			return routing.UserAwareRouter{}, errors.New("user or match must be specified on routing rule")
 		}
 
 		clusterNameRe, err := regexpOrNil(r.Cluster.Name)
 		if err != nil {
-			return routing.UserAwareRouter{}, nil
+			return routing.UserAwareRouter{}, fmt.Errorf("invalid cluster name on routing rule %d: %w", i, err)
 		}
 
 		rules[i] = routing.UserAwareRoutingRule{
-			User: userRe,
+			User:  userRe,
+			Match: matcher,
 			Cluster: routing.UserAwareClusterMatchRule{
 				Name:                  clusterNameRe,
 				Tags:                  r.Cluster.Tags,
@@ -95,6 +216,87 @@ func createUserAwareRouter(users RoutingUsersConf) (routing.UserAwareRouter, err
 	return routing.NewUserAwareRouter(conf), nil
 }
 
+func createMatcher(conf RoutingMatchConf) (routing.Matcher, error) {
+	matchers := make([]routing.Matcher, 0)
+
+	if len(conf.User) != 0 {
+		re, err := regexp.Compile(conf.User)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user: %w", err)
+		}
+		matchers = append(matchers, routing.MatchUser(re))
+	}
+
+	if len(conf.Source) != 0 {
+		re, err := regexp.Compile(conf.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source: %w", err)
+		}
+		matchers = append(matchers, routing.MatchSource(re))
+	}
+
+	if len(conf.ClientTags) != 0 {
+		matchers = append(matchers, routing.MatchClientTags(conf.ClientTags))
+	}
+
+	if len(conf.RoutingGroup) != 0 {
+		matchers = append(matchers, routing.MatchRoutingGroup(conf.RoutingGroup))
+	}
+
+	// the headers are sorted to get the same matcher description for the same configuration
+	headers := make([]string, 0, len(conf.Headers))
+	for name := range conf.Headers {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+
+	for _, name := range headers {
+		re, err := regexp.Compile(conf.Headers[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %w", name, err)
+		}
+		matchers = append(matchers, routing.MatchHeader(http.CanonicalHeaderKey(name), re))
+	}
+
+	if len(conf.ClientCidrs) != 0 {
+		networks := make([]*net.IPNet, len(conf.ClientCidrs))
+		for i, raw := range conf.ClientCidrs {
+			_, network, err := net.ParseCIDR(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid client cidr: %w", err)
+			}
+			networks[i] = network
+		}
+		matchers = append(matchers, routing.MatchClientCidr(networks))
+	}
+
+	for _, child := range conf.All {
+		matcher, err := createMatcher(child)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	if len(conf.Any) != 0 {
+		anyOf := make([]routing.Matcher, len(conf.Any))
+		for i, child := range conf.Any {
+			matcher, err := createMatcher(child)
+			if err != nil {
+				return nil, err
+			}
+			anyOf[i] = matcher
+		}
+		matchers = append(matchers, routing.MatchAny(anyOf...))
+	}
+
+	if len(matchers) == 0 {
+		return nil, errors.New("match without conditions")
+	}
+
+	return routing.MatchAll(matchers...), nil
+}
+
 func regexpOrNil(raw string) (*regexp.Regexp, error) {
 	if len(raw) == 0 {
 		return nil, nil
@@ -113,15 +315,53 @@ func createBehaviour(raw string) (routing.NoMatchBehaviour, error) {
 	}
 }
 
-func createRouterRule(t string) (routing.Rule, error) {
-	switch t {
+func createRouterRule(conf RoutingConf) (routing.Rule, error) {
+	switch conf.Rule {
 	case "random":
 		return routing.Random(), nil
 	case "round-robin":
 		return routing.RoundRobin(), nil
 	case "less-running-queries":
 		return routing.LessRunningQueries(), nil
+	case "weighted-round-robin":
+		return routing.WeightedRoundRobin(), nil
+	case "weighted-random":
+		return routing.WeightedRandom(), nil
+	case "load-score":
+		return createLoadScoreRule(conf.LoadScore)
+	case "p2c":
+		return routing.PowerOfTwoChoices(), nil
 	default:
-		return nil, fmt.Errorf("no router rule for value: %s", t)
+		return nil, fmt.Errorf("no router rule for value: %s", conf.Rule)
 	}
 }
+
+func createLoadScoreRule(conf RoutingLoadScoreConf) (routing.Rule, error) {
+	stale, err := routing.ParseStaleStatisticsBehaviour(conf.Stale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid load score configuration: %w", err)
+	}
+
+	coefficients := map[string]float64{
+		"running": conf.Running, "queued": conf.Queued, "blocked": conf.Blocked, "memory": conf.Memory, "stale_penalty": conf.StalePenalty,
+	}
+	for name, value := range coefficients {
+		if value < 0 {
+			return nil, fmt.Errorf("invalid load score configuration: %s must be positive or zero", name)
+		}
+	}
+
+	if conf.MaxStatisticsAge < 0 {
+		return nil, errors.New("invalid load score configuration: max_statistics_age must be positive or zero")
+	}
+
+	return routing.LoadScore(routing.LoadScoreConf{
+		Running:          conf.Running,
+		Queued:           conf.Queued,
+		Blocked:          conf.Blocked,
+		Memory:           conf.Memory,
+		MaxStatisticsAge: conf.MaxStatisticsAge,
+		Stale:            stale,
+		StalePenalty:     conf.StalePenalty,
+	}), nil
+}
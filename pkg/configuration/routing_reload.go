@@ -0,0 +1,258 @@
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// RoutingReloader loads the routing configuration again and replaces the router when the configuration is valid,
+// an invalid configuration keeps the current router
+type RoutingReloader struct {
+	load      func() (RoutingConf, error)
+	setRouter func(routing.Router)
+	logger    logging.Logger
+
+	mutex   *sync.Mutex
+	current RoutingConf
+}
+
+type RoutingReloadResponse struct {
+	Changes []string `json:"changes"`
+}
+
+type routingReloadError struct {
+	Error string `json:"error"`
+}
+
+func NewRoutingReloader(current RoutingConf, load func() (RoutingConf, error), setRouter func(routing.Router), logger logging.Logger) *RoutingReloader {
+	return &RoutingReloader{
+		load:      load,
+		setRouter: setRouter,
+		logger:    logger,
+		mutex:     &sync.Mutex{},
+		current:   current,
+	}
+}
+
+// Reload applies the loaded configuration and returns the changes from the previous one
+func (r *RoutingReloader) Reload() ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	conf, err := r.load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading routing configuration: %w", err)
+	}
+
+	return r.apply(conf)
+}
+
+// ReloadRules replaces only the user rules of the current configuration with the stored ones, the
+// configuration file is not read again. It returns the version of the rules applied
+func (r *RoutingReloader) ReloadRules(ctx context.Context, storage routing.RulesStorage) ([]string, int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	conf, version, err := LoadRoutingRules(ctx, r.current, storage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	changes, err := r.apply(conf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return changes, version, nil
+}
+
+// apply replaces the router when the configuration changed, the caller must hold the mutex
+func (r *RoutingReloader) apply(conf RoutingConf) ([]string, error) {
+	router, err := CreateQueryRouter(conf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing configuration: %w", err)
+	}
+
+	if sameRoutingConf(r.current, conf) {
+		r.logger.Info("routing configuration reloaded, no changes")
+		return []string{}, nil
+	}
+
+	changes := DiffRoutingConf(r.current, conf)
+
+	r.setRouter(router)
+	r.current = conf
+
+	for _, change := range changes {
+		r.logger.Info("routing configuration reloaded: %s", change)
+	}
+
+	return changes, nil
+}
+
+// Handler reloads the routing on POST requests
+func (r *RoutingReloader) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		changes, err := r.Reload()
+		if err != nil {
+			r.logger.Warn("routing reload failed: %s", err.Error())
+			r.writeJson(w, http.StatusBadRequest, routingReloadError{Error: err.Error()})
+			return
+		}
+
+		r.writeJson(w, http.StatusOK, RoutingReloadResponse{Changes: changes})
+	})
+}
+
+func (r *RoutingReloader) writeJson(w http.ResponseWriter, status int, body interface{}) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(content); err != nil {
+		r.logger.Error("error writing response: %s", err.Error())
+	}
+}
+
+// sameRoutingConf compares the routing configurations, the user rules are compared by position because the
+// first matching rule is applied
+func sameRoutingConf(previous RoutingConf, next RoutingConf) bool {
+	return previous.Rule == next.Rule &&
+		previous.LoadScore == next.LoadScore &&
+		describeUsersDefault(previous.Users.Default) == describeUsersDefault(next.Users.Default) &&
+		sameUserRules(previous.Users.Rules, next.Users.Rules) &&
+		describeStatementRules(previous.Statements) == describeStatementRules(next.Statements)
+}
+
+func sameUserRules(previous []RoutingUserRuleConf, next []RoutingUserRuleConf) bool {
+	if len(previous) != len(next) {
+		return false
+	}
+
+	for i := range previous {
+		if ruleKey(previous[i]) != ruleKey(next[i]) || describeUserRule(previous[i]) != describeUserRule(next[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffRoutingConf describes the changes between two routing configurations, the user rules are matched by
+// their conditions. The changes not described by the matched rules ( e.g. reordered rules or rules with the
+// same conditions ) are reported listing the rules
+func DiffRoutingConf(previous RoutingConf, next RoutingConf) []string {
+	changes := make([]string, 0)
+
+	if previous.Rule != next.Rule {
+		changes = append(changes, fmt.Sprintf("rule: %s -> %s", previous.Rule, next.Rule))
+	}
+
+	if previous.LoadScore != next.LoadScore {
+		changes = append(changes, fmt.Sprintf("load_score: %+v -> %+v", previous.LoadScore, next.LoadScore))
+	}
+
+	if prev, curr := describeUsersDefault(previous.Users.Default), describeUsersDefault(next.Users.Default); prev != curr {
+		changes = append(changes, fmt.Sprintf("users.default: %s -> %s", prev, curr))
+	}
+
+	rulesChanges := len(changes)
+
+	previousRules := make(map[string]RoutingUserRuleConf, len(previous.Users.Rules))
+	for _, rule := range previous.Users.Rules {
+		previousRules[ruleKey(rule)] = rule
+	}
+
+	nextRules := make(map[string]RoutingUserRuleConf, len(next.Users.Rules))
+	for _, rule := range next.Users.Rules {
+		key := ruleKey(rule)
+		nextRules[key] = rule
+
+		old, present := previousRules[key]
+		if !present {
+			changes = append(changes, fmt.Sprintf("users.rules[%s] added: %s", key, describeUserRule(rule)))
+			continue
+		}
+
+		if describeUserRule(old) != describeUserRule(rule) {
+			changes = append(changes, fmt.Sprintf("users.rules[%s] changed: %s -> %s", key, describeUserRule(old), describeUserRule(rule)))
+		}
+	}
+
+	for _, rule := range previous.Users.Rules {
+		key := ruleKey(rule)
+		if _, present := nextRules[key]; !present {
+			changes = append(changes, fmt.Sprintf("users.rules[%s] removed", key))
+		}
+	}
+
+	if len(changes) == rulesChanges && !sameUserRules(previous.Users.Rules, next.Users.Rules) {
+		changes = append(changes, fmt.Sprintf("users.rules: %s -> %s", describeUserRules(previous.Users.Rules), describeUserRules(next.Users.Rules)))
+	}
+
+	if prev, curr := describeStatementRules(previous.Statements), describeStatementRules(next.Statements); prev != curr {
+		changes = append(changes, fmt.Sprintf("statements.rules: %s -> %s", prev, curr))
+	}
+
+	return changes
+}
+
+// ruleKey identifies a rule by its conditions, the match is described like the routing rule name
+func ruleKey(rule RoutingUserRuleConf) string {
+	if rule.Match == nil {
+		return rule.User
+	}
+
+	matcher, err := createMatcher(*rule.Match)
+	if err != nil {
+		return fmt.Sprintf("%s %+v", rule.User, *rule.Match)
+	}
+
+	if len(rule.User) == 0 {
+		return matcher.String()
+	}
+	return rule.User + " " + matcher.String()
+}
+
+func describeStatementRules(conf RoutingStatementsConf) string {
+	rules := make([]string, len(conf.Rules))
+	for i, rule := range conf.Rules {
+		rules[i] = fmt.Sprintf("{types=%v catalog=%q schema=%q table=%q fallback=%t %s}",
+			rule.Types, rule.Catalog, rule.Schema, rule.Table, rule.Fallback, describeCluster(rule.Cluster))
+	}
+	return "[" + strings.Join(rules, " ") + "]"
+}
+
+func describeUsersDefault(conf RoutingUsersDefaultConf) string {
+	return fmt.Sprintf("behaviour=%s %s", conf.Behaviour, describeCluster(conf.Cluster))
+}
+
+func describeUserRules(rules []RoutingUserRuleConf) string {
+	described := make([]string, len(rules))
+	for i, rule := range rules {
+		described[i] = fmt.Sprintf("{%s %s}", ruleKey(rule), describeUserRule(rule))
+	}
+	return "[" + strings.Join(described, " ") + "]"
+}
+
+func describeUserRule(rule RoutingUserRuleConf) string {
+	return fmt.Sprintf("%s use_default_if_unhealthy=%t", describeCluster(rule.Cluster), rule.UseDefaultIfUnhealthy)
+}
+
+func describeCluster(conf RoutingClusterConf) string {
+	// fmt prints the maps with sorted keys
+	return fmt.Sprintf("cluster.name=%q cluster.tags=%v", conf.Name, conf.Tags)
+}
@@ -0,0 +1,233 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testRoutingConf() RoutingConf {
+	return RoutingConf{
+		Rule: "round-robin",
+		Users: RoutingUsersConf{
+			Default: RoutingUsersDefaultConf{
+				Behaviour: "default",
+				Cluster:   RoutingClusterConf{Tags: map[string]string{"workload": "etl"}},
+			},
+			Rules: []RoutingUserRuleConf{
+				{User: "etl-(.+)", Cluster: RoutingClusterConf{Name: "cluster-01"}},
+				{User: "analyst-(.+)", Cluster: RoutingClusterConf{Name: "cluster-02"}},
+			},
+		},
+	}
+}
+
+func TestCreateQueryRouterValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(conf *RoutingConf)
+		valid  bool
+	}{
+		{name: "valid", modify: func(conf *RoutingConf) {}, valid: true},
+		{name: "no user rules", modify: func(conf *RoutingConf) { conf.Users = RoutingUsersConf{} }, valid: true},
+		{name: "unknown rule", modify: func(conf *RoutingConf) { conf.Rule = "fastest" }},
+		{name: "invalid behaviour", modify: func(conf *RoutingConf) { conf.Users.Default.Behaviour = "random" }},
+		{name: "invalid user pattern", modify: func(conf *RoutingConf) { conf.Users.Rules[0].User = "etl-(" }},
+		{name: "missing user pattern", modify: func(conf *RoutingConf) { conf.Users.Rules[0].User = "" }},
+		{name: "invalid cluster pattern", modify: func(conf *RoutingConf) { conf.Users.Rules[0].Cluster.Name = "[" }},
+		{name: "match without user", modify: func(conf *RoutingConf) {
+			conf.Users.Rules[0] = RoutingUserRuleConf{Match: &RoutingMatchConf{Source: "airflow"}}
+		}, valid: true},
+		{name: "empty match", modify: func(conf *RoutingConf) { conf.Users.Rules[0].Match = &RoutingMatchConf{} }},
+		{name: "statement rule", modify: func(conf *RoutingConf) {
+			conf.Statements.Rules = []RoutingStatementRuleConf{{Types: []string{"insert", "CTAS"}, Cluster: RoutingClusterConf{Name: "cluster-01"}}}
+		}, valid: true},
+		{name: "invalid statement type", modify: func(conf *RoutingConf) {
+			conf.Statements.Rules = []RoutingStatementRuleConf{{Types: []string{"upsert"}}}
+		}},
+		{name: "invalid statement table", modify: func(conf *RoutingConf) {
+			conf.Statements.Rules = []RoutingStatementRuleConf{{Table: "("}}
+		}},
+		{name: "statement rule without conditions", modify: func(conf *RoutingConf) {
+			conf.Statements.Rules = []RoutingStatementRuleConf{{Cluster: RoutingClusterConf{Name: "cluster-01"}}}
+		}},
+		{name: "invalid cidr", modify: func(conf *RoutingConf) {
+			conf.Users.Rules[0].Match = &RoutingMatchConf{ClientCidrs: []string{"10.0.0.0/33"}}
+		}},
+		{name: "weighted rule", modify: func(conf *RoutingConf) { conf.Rule = "weighted-round-robin" }, valid: true},
+		{name: "p2c rule", modify: func(conf *RoutingConf) { conf.Rule = "p2c" }, valid: true},
+		{name: "load score rule", modify: func(conf *RoutingConf) {
+			conf.Rule = "load-score"
+			conf.LoadScore = RoutingLoadScoreConf{Running: 1, Queued: 2, MaxStatisticsAge: time.Minute, Stale: "exclude"}
+		}, valid: true},
+		{name: "load score invalid stale behaviour", modify: func(conf *RoutingConf) {
+			conf.Rule = "load-score"
+			conf.LoadScore = RoutingLoadScoreConf{Running: 1, Stale: "ignore"}
+		}},
+		{name: "load score negative coefficient", modify: func(conf *RoutingConf) {
+			conf.Rule = "load-score"
+			conf.LoadScore = RoutingLoadScoreConf{Running: 1, Queued: -1, Stale: "penalize"}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testRoutingConf()
+			tt.modify(&conf)
+
+			_, err := CreateQueryRouter(conf)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestDiffRoutingConf(t *testing.T) {
+	previous := testRoutingConf()
+
+	next := testRoutingConf()
+	next.Rule = "random"
+	next.Users.Rules = []RoutingUserRuleConf{
+		{User: "etl-(.+)", Cluster: RoutingClusterConf{Name: "cluster-03"}, UseDefaultIfUnhealthy: true},
+		{User: "bi-(.+)", Cluster: RoutingClusterConf{Tags: map[string]string{"workload": "bi"}}},
+	}
+
+	require.Equal(t, []string{
+		"rule: round-robin -> random",
+		`users.rules[etl-(.+)] changed: cluster.name="cluster-01" cluster.tags=map[] use_default_if_unhealthy=false -> cluster.name="cluster-03" cluster.tags=map[] use_default_if_unhealthy=true`,
+		`users.rules[bi-(.+)] added: cluster.name="" cluster.tags=map[workload:bi] use_default_if_unhealthy=false`,
+		"users.rules[analyst-(.+)] removed",
+	}, DiffRoutingConf(previous, next))
+
+	require.Empty(t, DiffRoutingConf(previous, testRoutingConf()))
+
+	matched := testRoutingConf()
+	matched.Users.Rules[1].Match = &RoutingMatchConf{Source: "tableau"}
+	require.Equal(t, []string{
+		`users.rules[analyst-(.+) source=~tableau] added: cluster.name="cluster-02" cluster.tags=map[] use_default_if_unhealthy=false`,
+		"users.rules[analyst-(.+)] removed",
+	}, DiffRoutingConf(previous, matched))
+
+	statements := testRoutingConf()
+	statements.Statements.Rules = []RoutingStatementRuleConf{{Types: []string{"insert"}, Cluster: RoutingClusterConf{Name: "cluster-01"}}}
+	require.Equal(t, []string{
+		`statements.rules: [] -> [{types=[insert] catalog="" schema="" table="" fallback=false cluster.name="cluster-01" cluster.tags=map[]}]`,
+	}, DiffRoutingConf(previous, statements))
+
+	scored := testRoutingConf()
+	scored.LoadScore.Queued = 2
+	require.Equal(t, []string{
+		"load_score: {Running:0 Queued:0 Blocked:0 Memory:0 MaxStatisticsAge:0s Stale: StalePenalty:0} -> {Running:0 Queued:2 Blocked:0 Memory:0 MaxStatisticsAge:0s Stale: StalePenalty:0}",
+	}, DiffRoutingConf(previous, scored))
+
+	reordered := testRoutingConf()
+	reordered.Users.Rules[0], reordered.Users.Rules[1] = reordered.Users.Rules[1], reordered.Users.Rules[0]
+	require.Equal(t, []string{
+		`users.rules: [{etl-(.+) cluster.name="cluster-01" cluster.tags=map[] use_default_if_unhealthy=false} {analyst-(.+) cluster.name="cluster-02" cluster.tags=map[] use_default_if_unhealthy=false}] -> ` +
+			`[{analyst-(.+) cluster.name="cluster-02" cluster.tags=map[] use_default_if_unhealthy=false} {etl-(.+) cluster.name="cluster-01" cluster.tags=map[] use_default_if_unhealthy=false}]`,
+	}, DiffRoutingConf(previous, reordered))
+}
+
+func TestRoutingReloaderRulesWithSameConditions(t *testing.T) {
+	rule := func(cluster string) RoutingUserRuleConf {
+		return RoutingUserRuleConf{User: "etl-(.+)", Cluster: RoutingClusterConf{Name: cluster}}
+	}
+
+	current := testRoutingConf()
+	current.Users.Rules = []RoutingUserRuleConf{rule("cluster-01"), rule("cluster-02")}
+
+	loaded := testRoutingConf()
+	loaded.Users.Rules = []RoutingUserRuleConf{rule("cluster-02"), rule("cluster-02")}
+
+	applied := 0
+	reloader := NewRoutingReloader(current, func() (RoutingConf, error) {
+		return loaded, nil
+	}, func(router routing.Router) {
+		applied++
+	}, logging.Noop())
+
+	// the first rule is the one applied, the change must not be hidden by the rule with the same conditions
+	changes, err := reloader.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`users.rules: [{etl-(.+) cluster.name="cluster-01" cluster.tags=map[] use_default_if_unhealthy=false} {etl-(.+) cluster.name="cluster-02" cluster.tags=map[] use_default_if_unhealthy=false}] -> ` +
+			`[{etl-(.+) cluster.name="cluster-02" cluster.tags=map[] use_default_if_unhealthy=false} {etl-(.+) cluster.name="cluster-02" cluster.tags=map[] use_default_if_unhealthy=false}]`,
+	}, changes)
+	require.Equal(t, 1, applied)
+
+	changes, err = reloader.Reload()
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	require.Equal(t, 1, applied)
+}
+
+func TestRoutingReloader(t *testing.T) {
+	loaded := testRoutingConf()
+	var loadErr error
+
+	applied := 0
+	reloader := NewRoutingReloader(testRoutingConf(), func() (RoutingConf, error) {
+		return loaded, loadErr
+	}, func(router routing.Router) {
+		applied++
+	}, logging.Noop())
+
+	// nothing changed, the router is not replaced
+	changes, err := reloader.Reload()
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	require.Equal(t, 0, applied)
+
+	loaded.Rule = "random"
+	changes, err = reloader.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []string{"rule: round-robin -> random"}, changes)
+	require.Equal(t, 1, applied)
+
+	// invalid configurations keep the current router
+	loaded.Rule = "fastest"
+	_, err = reloader.Reload()
+	require.Error(t, err)
+	require.Equal(t, 1, applied)
+
+	loaded.Rule = "random"
+	loadErr = errors.New("unreadable config")
+	_, err = reloader.Reload()
+	require.Error(t, err)
+	require.Equal(t, 1, applied)
+}
+
+func TestRoutingReloaderHandler(t *testing.T) {
+	loaded := testRoutingConf()
+	reloader := NewRoutingReloader(testRoutingConf(), func() (RoutingConf, error) {
+		return loaded, nil
+	}, func(router routing.Router) {}, logging.Noop())
+
+	recorder := httptest.NewRecorder()
+	reloader.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/routing/reload", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	loaded.Rule = "less-running-queries"
+	recorder = httptest.NewRecorder()
+	reloader.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/routing/reload", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response RoutingReloadResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, []string{"rule: round-robin -> less-running-queries"}, response.Changes)
+
+	loaded.Users.Default.Behaviour = "invalid"
+	recorder = httptest.NewRecorder()
+	reloader.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/routing/reload", nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "invalid behaviour type")
+}
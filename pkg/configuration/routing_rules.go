@@ -0,0 +1,108 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"time"
+)
+
+const (
+	RoutingRulesSourceConfig   = "config"
+	RoutingRulesSourceDatabase = "database"
+)
+
+type RoutingRulesConfiguration struct {
+	Source       string
+	Table        string
+	PollInterval time.Duration
+}
+
+func ValidateRoutingRulesSource(source string) error {
+	switch source {
+	case RoutingRulesSourceConfig, RoutingRulesSourceDatabase:
+		return nil
+	default:
+		return fmt.Errorf("invalid routing rules source: %s", source)
+	}
+}
+
+// LoadRoutingRules replaces the user rules of the configuration with the stored ones, the default
+// behaviour is still read from the configuration
+func LoadRoutingRules(ctx context.Context, conf RoutingConf, storage routing.RulesStorage) (RoutingConf, int64, error) {
+	set, err := storage.List(ctx)
+	if err != nil {
+		return RoutingConf{}, 0, fmt.Errorf("error loading routing rules: %w", err)
+	}
+
+	rules := make([]RoutingUserRuleConf, len(set.Rules))
+	for i, rule := range set.Rules {
+		rules[i] = RoutingUserRuleConf{
+			User:                  rule.User,
+			UseDefaultIfUnhealthy: rule.UseDefaultIfUnhealthy,
+			Cluster: RoutingClusterConf{
+				Name: rule.ClusterName,
+				Tags: rule.ClusterTags,
+			},
+		}
+	}
+
+	conf.Users.Rules = rules
+	return conf, set.Version, nil
+}
+
+// RoutingRulesWatcher reloads the routing when the version of the stored rules changes
+type RoutingRulesWatcher struct {
+	storage  routing.RulesStorage
+	reloader *RoutingReloader
+	interval time.Duration
+	logger   logging.Logger
+	version  int64
+}
+
+func NewRoutingRulesWatcher(storage routing.RulesStorage, reloader *RoutingReloader, version int64, interval time.Duration, logger logging.Logger) *RoutingRulesWatcher {
+	return &RoutingRulesWatcher{
+		storage:  storage,
+		reloader: reloader,
+		interval: interval,
+		logger:   logger,
+		version:  version,
+	}
+}
+
+func (w *RoutingRulesWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+func (w *RoutingRulesWatcher) check(ctx context.Context) {
+	version, err := w.storage.Version(ctx)
+	if err != nil {
+		w.logger.Warn("error reading routing rules version: %s", err.Error())
+		return
+	}
+
+	if version == w.version {
+		return
+	}
+
+	// the version is updated only when the rules have been applied, a failed reload is retried on the next check
+	_, applied, err := w.reloader.ReloadRules(ctx, w.storage)
+	if err != nil {
+		w.logger.Warn("routing rules version %d not activated, keeping the current routing: %s", version, err.Error())
+		return
+	}
+
+	w.version = applied
+	w.logger.Info("routing rules version %d activated", applied)
+}
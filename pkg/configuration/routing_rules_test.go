@@ -0,0 +1,77 @@
+package configuration
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoadRoutingRules(t *testing.T) {
+	ctx := context.Background()
+	storage := routing.NewMemoryRulesStorage()
+
+	_, err := storage.Create(ctx, routing.RuleDefinition{User: "bi-(.+)", ClusterTags: map[string]string{"workload": "bi"}, UseDefaultIfUnhealthy: true})
+	require.NoError(t, err)
+
+	conf, version, err := LoadRoutingRules(ctx, testRoutingConf(), storage)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), version)
+	require.Equal(t, testRoutingConf().Users.Default, conf.Users.Default)
+	require.Equal(t, []RoutingUserRuleConf{
+		{User: "bi-(.+)", UseDefaultIfUnhealthy: true, Cluster: RoutingClusterConf{Tags: map[string]string{"workload": "bi"}}},
+	}, conf.Users.Rules)
+}
+
+// unavailableRulesStorage fails to list the rules while unavailable is set
+type unavailableRulesStorage struct {
+	routing.RulesStorage
+	unavailable bool
+}
+
+func (u *unavailableRulesStorage) List(ctx context.Context) (routing.RuleSet, error) {
+	if u.unavailable {
+		return routing.RuleSet{}, errors.New("connection refused")
+	}
+	return u.RulesStorage.List(ctx)
+}
+
+func TestRoutingRulesWatcher(t *testing.T) {
+	ctx := context.Background()
+	storage := &unavailableRulesStorage{RulesStorage: routing.NewMemoryRulesStorage()}
+
+	current, version, err := LoadRoutingRules(ctx, testRoutingConf(), storage)
+	require.NoError(t, err)
+
+	applied := 0
+	// the rules changes must not read the configuration file again
+	reloader := NewRoutingReloader(current, func() (RoutingConf, error) {
+		return RoutingConf{}, errors.New("unreadable config")
+	}, func(router routing.Router) {
+		applied++
+	}, logging.Noop())
+
+	watcher := NewRoutingRulesWatcher(storage, reloader, version, time.Second, logging.Noop())
+
+	watcher.check(ctx)
+	require.Equal(t, 0, applied)
+
+	_, err = storage.Create(ctx, routing.RuleDefinition{User: "bi-(.+)", ClusterName: "cluster-03"})
+	require.NoError(t, err)
+
+	// the failed reload is retried on the next check
+	storage.unavailable = true
+	watcher.check(ctx)
+	require.Equal(t, 0, applied)
+
+	storage.unavailable = false
+	watcher.check(ctx)
+	require.Equal(t, 1, applied)
+
+	// the version did not change, the rules are not reloaded
+	watcher.check(ctx)
+	require.Equal(t, 1, applied)
+}
@@ -0,0 +1,80 @@
+package configuration
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestCreateMatcher(t *testing.T) {
+	conf := RoutingMatchConf{
+		User: "bi-(.+)",
+		Any: []RoutingMatchConf{
+			{Source: "^tableau", ClientTags: []string{"dashboard"}},
+			{RoutingGroup: "reporting"},
+			{ClientCidrs: []string{"10.0.0.0/8"}, Headers: map[string]string{"x-team": "finance"}},
+		},
+	}
+
+	matcher, err := createMatcher(conf)
+	require.NoError(t, err)
+	require.Equal(t, "(user=~bi-(.+) && ((source=~^tableau && client_tags=dashboard) || routing_group=reporting || (header[X-Team]=~finance && client_cidr=10.0.0.0/8)))", matcher.String())
+
+	tests := []struct {
+		name    string
+		req     routing.Request
+		matched bool
+	}{
+		{
+			name:    "source and tags",
+			req:     routing.Request{User: "bi-service", Headers: http.Header{"X-Trino-Source": {"tableau"}, "X-Trino-Client-Tags": {"dashboard"}}},
+			matched: true,
+		},
+		{
+			name: "source without tags",
+			req:  routing.Request{User: "bi-service", Headers: http.Header{"X-Trino-Source": {"tableau"}}},
+		},
+		{
+			name:    "routing group",
+			req:     routing.Request{User: "bi-service", Headers: http.Header{"X-Trino-Routing-Group": {"reporting"}}},
+			matched: true,
+		},
+		{
+			name:    "header and cidr",
+			req:     routing.Request{User: "bi-service", Headers: http.Header{"X-Team": {"finance"}}, ClientAddress: "10.0.0.12"},
+			matched: true,
+		},
+		{
+			name: "other user",
+			req:  routing.Request{User: "etl", Headers: http.Header{"X-Trino-Routing-Group": {"reporting"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.matched, matcher.Match(tt.req))
+		})
+	}
+}
+
+func TestCreateMatcherErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf RoutingMatchConf
+	}{
+		{name: "empty", conf: RoutingMatchConf{}},
+		{name: "invalid user", conf: RoutingMatchConf{User: "("}},
+		{name: "invalid source", conf: RoutingMatchConf{Source: "["}},
+		{name: "invalid header", conf: RoutingMatchConf{Headers: map[string]string{"X-Team": "("}}},
+		{name: "invalid cidr", conf: RoutingMatchConf{ClientCidrs: []string{"10.0.0.1"}}},
+		{name: "invalid nested", conf: RoutingMatchConf{Any: []RoutingMatchConf{{Source: "tableau"}, {}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := createMatcher(tt.conf)
+			require.Error(t, err)
+		})
+	}
+}
@@ -2,7 +2,10 @@ package configuration
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
 	"github.com/go-redis/redis/v8"
 	"time"
@@ -28,32 +31,88 @@ type RedisSessionStorageOpts struct {
 	MaxTTL time.Duration
 }
 
+type PostgresSessionStorageConfiguration struct {
+	Table           string
+	TTL             time.Duration
+	CleanupInterval time.Duration
+}
+
+// SessionCacheConfiguration configures the in memory cache in front of the session store, when TTL is 0 the
+// entries expire with the ttl of the store
+type SessionCacheConfiguration struct {
+	MaxEntries int
+	Shards     int
+	TTL        time.Duration
+}
+
+const (
+	SessionStorageRedis    = "redis"
+	SessionStoragePostgres = "postgres"
+	SessionStorageMemory   = "memory"
+)
+
 type SessionStorageConfiguration struct {
+	Type       string
 	Standalone RedisSessionStorageConfiguration
 	Sentinel   RedisSentinelSessionStorageConfiguration
 	Opts       RedisSessionStorageOpts
+	Postgres   PostgresSessionStorageConfiguration
+	Cache      SessionCacheConfiguration
 }
 
-func CreateSessionStorage(client redis.UniversalClient, conf SessionStorageConfiguration) (session.Storage, error) {
-	_, err := client.Ping(context.TODO()).Result()
-	if err != nil {
-		return nil, err
+func CreateSessionStorage(conf SessionStorageConfiguration, client redis.UniversalClient, db *sql.DB, logger logging.Logger) (session.Storage, error) {
+	switch conf.Type {
+	case SessionStorageRedis:
+		if client == nil {
+			return nil, errors.New("no redis session storage enabled")
+		}
+
+		_, err := client.Ping(context.TODO()).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		redisStorage := session.NewRedisStorage(client, conf.Opts.Prefix, conf.Opts.MaxTTL)
+		return session.NewStorageCache(redisStorage, createSessionCache(conf.Cache, conf.Opts.MaxTTL)), nil
+	case SessionStoragePostgres:
+		if err := db.PingContext(context.TODO()); err != nil {
+			return nil, err
+		}
+
+		dbStorage := session.NewDatabaseStorage(db, conf.Postgres.Table, conf.Postgres.TTL)
+		go dbStorage.RunCleanup(context.Background(), conf.Postgres.CleanupInterval, logger)
+
+		return session.NewStorageCache(dbStorage, createSessionCache(conf.Cache, conf.Postgres.TTL)), nil
+	case SessionStorageMemory:
+		logger.Warn("using memory session storage, queries can't be shared between multiple proxy instances")
+		return createSessionCache(conf.Cache, 0), nil
 	}
 
-	redisStorage := session.NewRedisStorage(client, conf.Opts.Prefix, conf.Opts.MaxTTL)
-	memoryStorage := session.NewMemoryStorage()
-	return session.NewStorageCache(redisStorage, memoryStorage), nil
+	return nil, fmt.Errorf("session storage for type %s not found", conf.Type)
 }
 
-func CreateRedisStorageClient(conf SessionStorageConfiguration) (redis.UniversalClient, error) {
+func createSessionCache(conf SessionCacheConfiguration, storeTTL time.Duration) *session.BoundedMemory {
+	ttl := conf.TTL
+	if ttl == 0 {
+		ttl = storeTTL
+	}
+
+	return session.NewBoundedMemoryStorage(session.BoundedMemoryConf{
+		MaxEntries: conf.MaxEntries,
+		Shards:     conf.Shards,
+		TTL:        ttl,
+	})
+}
+
+// CreateRedisStorageClient returns nil if neither standalone or sentinel redis are enabled
+func CreateRedisStorageClient(conf SessionStorageConfiguration) redis.UniversalClient {
 
 	if conf.Standalone.Enabled {
 		return redis.NewClient(&redis.Options{
 			Addr:     conf.Standalone.Host,
 			Password: conf.Standalone.Password,
 			DB:       conf.Standalone.DB,
-		}), nil
-
+		})
 	}
 
 	if conf.Sentinel.Enabled {
@@ -62,8 +121,8 @@ func CreateRedisStorageClient(conf SessionStorageConfiguration) (redis.Universal
 			SentinelAddrs: conf.Sentinel.Hosts,
 			DB:            conf.Sentinel.DB,
 			Password:      conf.Sentinel.Password,
-		}), nil
+		})
 	}
 
-	return nil, errors.New("no redis session storage enabled")
+	return nil
 }
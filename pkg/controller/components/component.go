@@ -3,6 +3,7 @@ package components
 import (
 	"context"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 )
 
 type QueryHandler interface {
@@ -25,3 +26,15 @@ func (m MultiQueryComponent) Execute(ctx context.Context, detail trino.QueryDeta
 	}
 	return nil
 }
+
+type clusterContextKey struct{}
+
+// WithCluster returns a context carrying the cluster the query details passed to the handlers belong to
+func WithCluster(ctx context.Context, cluster models.Coordinator) context.Context {
+	return context.WithValue(ctx, clusterContextKey{}, cluster)
+}
+
+func ClusterFromContext(ctx context.Context) (models.Coordinator, bool) {
+	cluster, ok := ctx.Value(clusterContextKey{}).(models.Coordinator)
+	return cluster, ok
+}
@@ -0,0 +1,57 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
+	"net/url"
+)
+
+var (
+	ErrUnknownQueryCluster = errors.New("unable to detect the cluster of the query")
+)
+
+// QueryHistory stores the details of the completed queries in the history storage, the same query can be
+// processed multiple times without creating duplicates
+type QueryHistory struct {
+	storage history.Storage
+	logger  logging.Logger
+}
+
+func NewQueryHistory(storage history.Storage, logger logging.Logger) *QueryHistory {
+	return &QueryHistory{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+func (q *QueryHistory) Execute(ctx context.Context, detail trino.QueryDetail) error {
+	cluster, err := queryCluster(ctx, detail)
+	if err != nil {
+		return err
+	}
+
+	if err := q.storage.Store(ctx, history.NewQuery(cluster, detail)); err != nil {
+		return fmt.Errorf("error storing query %s of %s: %w", detail.QueryID, cluster, err)
+	}
+
+	q.logger.Debug("stored query %s of %s", detail.QueryID, cluster)
+	return nil
+}
+
+// queryCluster returns the cluster set by the controller, falling back to the host of the query uri
+func queryCluster(ctx context.Context, detail trino.QueryDetail) (string, error) {
+	if cluster, ok := ClusterFromContext(ctx); ok {
+		return cluster.Name, nil
+	}
+
+	self, err := url.Parse(detail.Self)
+	if err != nil || len(self.Host) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnknownQueryCluster, detail.QueryID)
+	}
+
+	return self.Host, nil
+}
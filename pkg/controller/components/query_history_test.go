@@ -0,0 +1,56 @@
+package components
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/history"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testQueryDetail() trino.QueryDetail {
+	return trino.QueryDetail{
+		QueryID: "20210101_000000_00001_abcde",
+		Self:    "http://trino-0.local:8080/v1/query/20210101_000000_00001_abcde",
+		Query:   "select count(*) from orders",
+		Session: trino.Session{
+			User: "analyst",
+		},
+	}
+}
+
+func TestQueryHistoryStoresQuery(t *testing.T) {
+	storage := history.NewMemoryStorage()
+	handler := NewQueryHistory(storage, logging.Noop())
+
+	ctx := WithCluster(context.Background(), models.Coordinator{Name: "trino-1"})
+
+	detail := testQueryDetail()
+	require.NoError(t, handler.Execute(ctx, detail))
+
+	// processing the same query again updates the stored one
+	detail.Session.User = "etl"
+	require.NoError(t, handler.Execute(ctx, detail))
+
+	stored, err := storage.Get(ctx, "trino-1", detail.QueryID)
+	require.NoError(t, err)
+	require.Equal(t, "etl", stored.User)
+	require.Equal(t, "select count(*) from orders", stored.Query)
+}
+
+func TestQueryClusterFromContext(t *testing.T) {
+	ctx := WithCluster(context.Background(), models.Coordinator{Name: "trino-1"})
+
+	cluster, err := queryCluster(ctx, testQueryDetail())
+	require.NoError(t, err)
+	require.Equal(t, "trino-1", cluster)
+
+	cluster, err = queryCluster(context.Background(), testQueryDetail())
+	require.NoError(t, err)
+	require.Equal(t, "trino-0.local:8080", cluster)
+
+	_, err = queryCluster(context.Background(), trino.QueryDetail{})
+	require.ErrorIs(t, err, ErrUnknownQueryCluster)
+}
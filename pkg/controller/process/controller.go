@@ -76,6 +76,7 @@ func (c Controller) controlCluster(ctx context.Context, cluster models.Coordinat
 
 	c.logger.Info("%s: retrieved %d queries", cluster.Name, len(completedQueryList))
 
+	clusterCtx := components.WithCluster(ctx, cluster)
 	for _, query := range completedQueryList {
 		queryDetail, err := c.api.QueryDetail(cluster.URL, query.QueryId)
 		if err != nil {
@@ -85,7 +86,7 @@ func (c Controller) controlCluster(ctx context.Context, cluster models.Coordinat
 			return err
 		}
 
-		if err := c.queryHandler.Execute(ctx, queryDetail); err != nil {
+		if err := c.queryHandler.Execute(clusterCtx, queryDetail); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+)
+
+const DefaultEventsChannel = "trino_lb_clusters"
+
+type ChangeType string
+
+const (
+	ClusterAdded   ChangeType = "added"
+	ClusterUpdated ChangeType = "updated"
+	ClusterRemoved ChangeType = "removed"
+	// ClusterResync is emitted by the subscribers when some events may have been lost ( e.g. after a reconnection ),
+	// the whole state must be synced again
+	ClusterResync ChangeType = "resync"
+)
+
+// ChangeEvent notifies a change of a cluster in the storage, the event carries only the cluster name,
+// the new state must be read from the storage
+type ChangeEvent struct {
+	Type    ChangeType `json:"type"`
+	Cluster string     `json:"cluster"`
+}
+
+// Events propagates the changes of the clusters between the instances sharing the same storage
+type Events interface {
+	Publish(context.Context, ChangeEvent) error
+	// Subscribe returns the published events until the context is done, the channel is closed when the
+	// subscription ends
+	Subscribe(context.Context) (<-chan ChangeEvent, error)
+}
+
+// NotifyingStorage publishes an event for every successful change of the wrapped storage. The storage is the
+// source of truth, a failed publish is only logged: the subscribers will receive the change with the next sync
+type NotifyingStorage struct {
+	Storage
+	events Events
+	logger logging.Logger
+}
+
+func NewNotifyingStorage(storage Storage, events Events, logger logging.Logger) *NotifyingStorage {
+	return &NotifyingStorage{
+		Storage: storage,
+		events:  events,
+		logger:  logger,
+	}
+}
+
+func (n *NotifyingStorage) Remove(ctx context.Context, name string) error {
+	if err := n.Storage.Remove(ctx, name); err != nil {
+		return err
+	}
+
+	n.publish(ctx, ChangeEvent{Type: ClusterRemoved, Cluster: name})
+	return nil
+}
+
+func (n *NotifyingStorage) Add(ctx context.Context, coordinator models.Coordinator) error {
+	if err := n.Storage.Add(ctx, coordinator); err != nil {
+		return err
+	}
+
+	n.publish(ctx, ChangeEvent{Type: ClusterAdded, Cluster: coordinator.Name})
+	return nil
+}
+
+func (n *NotifyingStorage) Update(ctx context.Context, name string, req UpdateRequest) error {
+	if err := n.Storage.Update(ctx, name, req); err != nil {
+		return err
+	}
+
+	n.publish(ctx, ChangeEvent{Type: ClusterUpdated, Cluster: name})
+	return nil
+}
+
+func (n *NotifyingStorage) publish(ctx context.Context, event ChangeEvent) {
+	if err := n.events.Publish(ctx, event); err != nil {
+		n.logger.Warn("error publishing %s event for cluster %s: %s", event.Type, event.Cluster, err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package discovery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	listenerMinReconnectInterval = time.Second
+	listenerMaxReconnectInterval = time.Minute
+)
+
+// DatabaseEvents propagates the changes using postgres LISTEN / NOTIFY. The events are published with the
+// shared connection pool while every subscription holds a dedicated connection
+type DatabaseEvents struct {
+	db      *sql.DB
+	connStr string
+	channel string
+	logger  logging.Logger
+}
+
+func NewDatabaseEvents(db *sql.DB, connStr string, channel string, logger logging.Logger) *DatabaseEvents {
+	return &DatabaseEvents{
+		db:      db,
+		connStr: connStr,
+		channel: channel,
+		logger:  logger,
+	}
+}
+
+func (d *DatabaseEvents) Publish(ctx context.Context, event ChangeEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", d.channel, string(payload))
+	return err
+}
+
+func (d *DatabaseEvents) Subscribe(ctx context.Context) (<-chan ChangeEvent, error) {
+	listener := pq.NewListener(d.connStr, listenerMinReconnectInterval, listenerMaxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			d.logger.Warn("cluster events listener error: %s", err.Error())
+		}
+	})
+
+	if err := listener.Listen(d.channel); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	events := make(chan ChangeEvent)
+
+	go func() {
+		defer close(events)
+		defer listener.Close()
+
+		for {
+			var event ChangeEvent
+
+			select {
+			case notification := <-listener.Notify:
+				// the listener sends nil after a reconnection, the notifications sent in the meantime are lost
+				if notification == nil {
+					event = ChangeEvent{Type: ClusterResync}
+				} else if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					d.logger.Warn("invalid cluster event on channel %s: %s", d.channel, err.Error())
+					continue
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+)
+
+const memoryEventsBuffer = 16
+
+// MemoryEvents this is just for single node usage / testing purpose DO NOT use in production
+type MemoryEvents struct {
+	mutex       *sync.Mutex
+	subscribers map[chan ChangeEvent]struct{}
+}
+
+func NewMemoryEvents() *MemoryEvents {
+	return &MemoryEvents{
+		mutex:       &sync.Mutex{},
+		subscribers: make(map[chan ChangeEvent]struct{}),
+	}
+}
+
+// Publish never blocks: when a subscriber is not keeping up its pending events are replaced by a single
+// resync event, so the subscriber reads again the whole state instead of stalling the publishers
+func (m *MemoryEvents) Publish(ctx context.Context, event ChangeEvent) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for subscriber := range m.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			m.resync(subscriber)
+		}
+	}
+
+	return nil
+}
+
+// resync drains the subscriber buffer and replaces the lost events with a resync, the publishers are the only
+// senders and hold the mutex so there is room for the resync once the buffer has been drained
+func (m *MemoryEvents) resync(subscriber chan ChangeEvent) {
+	for drained := false; !drained; {
+		select {
+		case <-subscriber:
+		default:
+			drained = true
+		}
+	}
+
+	subscriber <- ChangeEvent{Type: ClusterResync}
+}
+
+func (m *MemoryEvents) Subscribe(ctx context.Context) (<-chan ChangeEvent, error) {
+	events := make(chan ChangeEvent, memoryEventsBuffer)
+
+	m.mutex.Lock()
+	m.subscribers[events] = struct{}{}
+	m.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.mutex.Lock()
+		delete(m.subscribers, events)
+		close(events)
+		m.mutex.Unlock()
+	}()
+
+	return events, nil
+}
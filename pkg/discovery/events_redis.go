@@ -0,0 +1,76 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisEvents propagates the changes using redis pub/sub, the client reconnects automatically but the events
+// published while disconnected are lost
+type RedisEvents struct {
+	client  redis.UniversalClient
+	channel string
+	logger  logging.Logger
+}
+
+func NewRedisEvents(client redis.UniversalClient, channel string, logger logging.Logger) *RedisEvents {
+	return &RedisEvents{
+		client:  client,
+		channel: channel,
+		logger:  logger,
+	}
+}
+
+func (r *RedisEvents) Publish(ctx context.Context, event ChangeEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, r.channel, payload).Err()
+}
+
+func (r *RedisEvents) Subscribe(ctx context.Context) (<-chan ChangeEvent, error) {
+	pubSub := r.client.Subscribe(ctx, r.channel)
+
+	// wait for the subscription confirmation, the events published before are not received
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return nil, err
+	}
+
+	events := make(chan ChangeEvent)
+
+	go func() {
+		defer close(events)
+		defer pubSub.Close()
+
+		messages := pubSub.Channel()
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event ChangeEvent
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					r.logger.Warn("invalid cluster event on channel %s: %s", r.channel, err.Error())
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
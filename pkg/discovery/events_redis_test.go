@@ -0,0 +1,30 @@
+package discovery
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRedisEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	container, client, err := tests.CreateRedisServer(ctx)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, container.Terminate(context.Background()))
+	}()
+
+	events := NewRedisEvents(client, DefaultEventsChannel, logging.Noop())
+
+	subscription, err := events.Subscribe(ctx)
+	require.NoError(t, err)
+
+	event := ChangeEvent{Type: ClusterUpdated, Cluster: "coord-0"}
+	require.NoError(t, events.Publish(ctx, event))
+	require.Equal(t, event, receiveEvent(t, subscription))
+}
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func receiveEvent(t *testing.T, events <-chan ChangeEvent) ChangeEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	return ChangeEvent{}
+}
+
+func TestNotifyingStoragePublishesChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := NewMemoryEvents()
+	storage := NewNotifyingStorage(NewMemoryStorage(), events, logging.Noop())
+
+	subscription, err := events.Subscribe(ctx)
+	require.NoError(t, err)
+
+	coord := models.Coordinator{
+		Name:    "coord-0",
+		URL:     tests.MustUrl("http://trino.local:8080"),
+		Tags:    map[string]string{},
+		Enabled: true,
+	}
+
+	require.NoError(t, storage.Add(ctx, coord))
+	require.Equal(t, ChangeEvent{Type: ClusterAdded, Cluster: "coord-0"}, receiveEvent(t, subscription))
+
+	enabled := false
+	require.NoError(t, storage.Update(ctx, "coord-0", UpdateRequest{Enabled: &enabled}))
+	require.Equal(t, ChangeEvent{Type: ClusterUpdated, Cluster: "coord-0"}, receiveEvent(t, subscription))
+
+	stored, err := storage.Get(ctx, "coord-0")
+	require.NoError(t, err)
+	require.False(t, stored.Enabled)
+
+	require.NoError(t, storage.Remove(ctx, "coord-0"))
+	require.Equal(t, ChangeEvent{Type: ClusterRemoved, Cluster: "coord-0"}, receiveEvent(t, subscription))
+
+	// failed changes are not published
+	err = storage.Update(ctx, "coord-0", UpdateRequest{Enabled: &enabled})
+	require.True(t, errors.Is(err, ErrClusterNotFound))
+
+	select {
+	case event := <-subscription:
+		require.FailNow(t, "unexpected event", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryEventsSubscriptionEndsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := NewMemoryEvents()
+	subscription, err := events.Subscribe(ctx)
+	require.NoError(t, err)
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		_, open := <-subscription
+		return !open
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, events.Publish(context.Background(), ChangeEvent{Type: ClusterAdded, Cluster: "coord-0"}))
+}
+
+func TestMemoryEventsSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := NewMemoryEvents()
+
+	// the first subscriber never reads its events
+	_, err := events.Subscribe(ctx)
+	require.NoError(t, err)
+
+	subscription, err := events.Subscribe(ctx)
+	require.NoError(t, err)
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < memoryEventsBuffer*2; i++ {
+			if err := events.Publish(ctx, ChangeEvent{Type: ClusterUpdated, Cluster: "coord-0"}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "publish blocked by a subscriber that never reads")
+	}
+
+	// the events exceeding the buffer are replaced by a resync
+	var last ChangeEvent
+	for i := 0; i < memoryEventsBuffer; i++ {
+		last = receiveEvent(t, subscription)
+		if last.Type == ClusterResync {
+			break
+		}
+	}
+	require.Equal(t, ChangeEvent{Type: ClusterResync}, last)
+}
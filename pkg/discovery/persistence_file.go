@@ -0,0 +1,348 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/fsnotify/fsnotify"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileReloadDelay = 100 * time.Millisecond
+
+// FileStorage stores the clusters in a yaml or json file ( chosen by the .json extension ), the file is
+// replaced atomically on every change and reloaded by Watch when it's edited externally
+type FileStorage struct {
+	path   string
+	logger logging.Logger
+	events Events
+
+	mutex    *sync.RWMutex
+	clusters []models.Coordinator
+	// content is the last file content loaded or written, used to ignore the events of our own writes
+	content []byte
+}
+
+type clustersFile struct {
+	Clusters []fileCluster `json:"clusters"`
+}
+
+type fileCluster struct {
+	Name    string            `json:"name"`
+	Url     string            `json:"url"`
+	Tags    map[string]string `json:"tags"`
+	Enabled bool              `json:"enabled"`
+}
+
+// NewFileStorage loads the clusters from path, a missing file is created with the first change
+func NewFileStorage(path string, logger logging.Logger) (*FileStorage, error) {
+	storage := &FileStorage{
+		path:     filepath.Clean(path),
+		logger:   logger,
+		mutex:    &sync.RWMutex{},
+		clusters: make([]models.Coordinator, 0),
+	}
+
+	if _, err := storage.reload(); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// WithEvents publishes a resync event when the file is changed externally
+func (f *FileStorage) WithEvents(events Events) *FileStorage {
+	f.events = events
+	return f
+}
+
+func (f *FileStorage) Remove(ctx context.Context, name string) error {
+	return f.change(func(clusters []models.Coordinator) ([]models.Coordinator, error) {
+		updated := make([]models.Coordinator, 0, len(clusters))
+		for _, c := range clusters {
+			if c.Name != name {
+				updated = append(updated, c)
+			}
+		}
+		return updated, nil
+	})
+}
+
+func (f *FileStorage) Add(ctx context.Context, coordinator models.Coordinator) error {
+	return f.change(func(clusters []models.Coordinator) ([]models.Coordinator, error) {
+		// same as the database storage, adding an existing cluster updates only its tags
+		for i := range clusters {
+			if clusters[i].Name == coordinator.Name {
+				clusters[i].Tags = coordinator.Tags
+				return clusters, nil
+			}
+		}
+		return append(clusters, coordinator), nil
+	})
+}
+
+func (f *FileStorage) Update(ctx context.Context, name string, req UpdateRequest) error {
+	return f.change(func(clusters []models.Coordinator) ([]models.Coordinator, error) {
+		for i := range clusters {
+			if clusters[i].Name == name {
+				if req.Enabled != nil {
+					clusters[i].Enabled = *req.Enabled
+				}
+
+				if req.Tags != nil {
+					clusters[i].Tags = req.Tags
+				}
+				return clusters, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to update cluster %s: %w", name, ErrClusterNotFound)
+	})
+}
+
+func (f *FileStorage) Get(ctx context.Context, name string) (models.Coordinator, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for _, c := range f.clusters {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+
+	return models.Coordinator{}, ErrClusterNotFound
+}
+
+func (f *FileStorage) All(ctx context.Context) ([]models.Coordinator, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	clusters := make([]models.Coordinator, len(f.clusters))
+	copy(clusters, f.clusters)
+	return clusters, nil
+}
+
+// Watch reloads the file when it's changed externally until the context is done. The directory is watched
+// instead of the file to follow the editors and tools that replace the file instead of writing it
+func (f *FileStorage) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(f.path)); err != nil {
+		return err
+	}
+
+	// a single change can emit many events ( e.g. truncate and write ), the file is reloaded when they stop
+	debounce := time.NewTimer(fileReloadDelay)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if filepath.Clean(event.Name) != f.path || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			debounce.Reset(fileReloadDelay)
+		case <-debounce.C:
+			changed, err := f.reload()
+			if err != nil {
+				f.logger.Warn("error reloading clusters from %s, keeping the previous state: %s", f.path, err.Error())
+				continue
+			}
+
+			if changed {
+				f.logger.Info("clusters reloaded from %s", f.path)
+				f.publishResync(ctx)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			f.logger.Warn("error watching %s: %s", f.path, err.Error())
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (f *FileStorage) publishResync(ctx context.Context) {
+	if f.events == nil {
+		return
+	}
+
+	if err := f.events.Publish(ctx, ChangeEvent{Type: ClusterResync}); err != nil {
+		f.logger.Warn("error publishing resync event: %s", err.Error())
+	}
+}
+
+// reload reads the file and returns true if the content changed since the last load or write
+func (f *FileStorage) reload() (bool, error) {
+	// the file is read holding the lock to never replace the state with a content older than our last write
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	content, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// the file is removed and created again by some tools, the next event will reload it
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if f.content != nil && bytes.Equal(content, f.content) {
+		return false, nil
+	}
+
+	// after the first load an empty file is treated as a write in progress and ignored, the clusters are
+	// removed by writing an empty list
+	if f.content != nil && len(bytes.TrimSpace(content)) == 0 {
+		return false, nil
+	}
+
+	clusters, err := decodeClusters(content)
+	if err != nil {
+		return false, fmt.Errorf("invalid clusters file %s: %w", f.path, err)
+	}
+
+	f.clusters = clusters
+	f.content = content
+	return true, nil
+}
+
+func (f *FileStorage) change(apply func([]models.Coordinator) ([]models.Coordinator, error)) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	current := make([]models.Coordinator, len(f.clusters))
+	copy(current, f.clusters)
+
+	updated, err := apply(current)
+	if err != nil {
+		return err
+	}
+
+	content, err := f.encodeClusters(updated)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(f.path, content); err != nil {
+		return err
+	}
+
+	f.clusters = updated
+	f.content = content
+	return nil
+}
+
+func (f *FileStorage) encodeClusters(clusters []models.Coordinator) ([]byte, error) {
+	file := clustersFile{Clusters: make([]fileCluster, len(clusters))}
+	for i, c := range clusters {
+		file.Clusters[i] = fileCluster{
+			Name:    c.Name,
+			Url:     c.URL.String(),
+			Tags:    c.Tags,
+			Enabled: c.Enabled,
+		}
+	}
+
+	if strings.EqualFold(filepath.Ext(f.path), ".json") {
+		return json.MarshalIndent(file, "", "  ")
+	}
+
+	return yaml.Marshal(file)
+}
+
+// decodeClusters parses both yaml and json, json is valid yaml
+func decodeClusters(content []byte) ([]models.Coordinator, error) {
+	var file clustersFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(file.Clusters))
+	clusters := make([]models.Coordinator, 0, len(file.Clusters))
+	for _, c := range file.Clusters {
+		if len(c.Name) == 0 {
+			return nil, errors.New("cluster without name")
+		}
+
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate cluster %s", c.Name)
+		}
+		names[c.Name] = true
+
+		uri, err := url.Parse(c.Url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url for cluster %s: %w", c.Name, err)
+		}
+
+		tags := c.Tags
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+
+		clusters = append(clusters, models.Coordinator{
+			Name:    c.Name,
+			URL:     uri,
+			Tags:    tags,
+			Enabled: c.Enabled,
+		})
+	}
+
+	return clusters, nil
+}
+
+// writeFileAtomic writes the content in a temporary file of the same directory and renames it, the readers
+// see either the old or the new content
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
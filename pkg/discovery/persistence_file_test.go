@@ -0,0 +1,178 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStorage(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "yaml", file: "clusters.yml"},
+		{name: "json", file: "clusters.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+
+			storage, err := NewFileStorage(path, logging.Noop())
+			require.NoError(t, err)
+
+			all, err := storage.All(ctx)
+			require.NoError(t, err)
+			require.Len(t, all, 0)
+
+			coord := testFileCoordinator("coord-0")
+			require.NoError(t, storage.Add(ctx, coord))
+			require.NoError(t, storage.Add(ctx, testFileCoordinator("coord-1")))
+			require.NoError(t, storage.Remove(ctx, "coord-1"))
+
+			enabled := false
+			require.NoError(t, storage.Update(ctx, coord.Name, UpdateRequest{Enabled: &enabled}))
+
+			err = storage.Update(ctx, "not-existing", UpdateRequest{Enabled: &enabled})
+			require.True(t, errors.Is(err, ErrClusterNotFound))
+
+			// the state is persisted, no temporary file is left in the directory
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+
+			reopened, err := NewFileStorage(path, logging.Noop())
+			require.NoError(t, err)
+
+			stored, err := reopened.Get(ctx, coord.Name)
+			require.NoError(t, err)
+			require.Equal(t, coord.Name, stored.Name)
+			require.Equal(t, coord.URL.String(), stored.URL.String())
+			require.Equal(t, coord.Tags, stored.Tags)
+			require.False(t, stored.Enabled)
+
+			_, err = reopened.Get(ctx, "coord-1")
+			require.Equal(t, ErrClusterNotFound, err)
+		})
+	}
+}
+
+func TestFileStorageInvalidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "cluster without name",
+			content: "clusters:\n  - url: http://trino.local:8080\n",
+		},
+		{
+			name:    "duplicate cluster",
+			content: "clusters:\n  - name: coord-0\n    url: http://trino0.local:8080\n  - name: coord-0\n    url: http://trino1.local:8080\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "clusters.yml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			_, err := NewFileStorage(path, logging.Noop())
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestFileStorageReloadsExternalChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "clusters.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+clusters:
+  - name: coord-0
+    url: http://trino0.local:8080
+    enabled: true
+`), 0644))
+
+	events := NewMemoryEvents()
+	subscription, err := events.Subscribe(ctx)
+	require.NoError(t, err)
+
+	storage, err := NewFileStorage(path, logging.Noop())
+	require.NoError(t, err)
+	storage.WithEvents(events)
+
+	go func() {
+		require.NoError(t, storage.Watch(ctx))
+	}()
+
+	require.Eventually(t, func() bool {
+		// the watcher may not be started yet, the file is written until the change is detected. The interval is
+		// longer than the reload delay otherwise the writes would postpone the reload forever
+		require.NoError(t, os.WriteFile(path, []byte(`
+clusters:
+  - name: coord-0
+    url: http://trino0.local:8080
+    enabled: false
+  - name: coord-1
+    url: http://trino1.local:8080
+    enabled: true
+    tags:
+      env: dev
+`), 0644))
+
+		all, err := storage.All(ctx)
+		require.NoError(t, err)
+		return len(all) == 2
+	}, 5*time.Second, 3*fileReloadDelay)
+
+	require.Equal(t, ChangeEvent{Type: ClusterResync}, receiveEvent(t, subscription))
+
+	coord, err := storage.Get(ctx, "coord-1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"env": "dev"}, coord.Tags)
+
+	// an invalid edit keeps the previous state
+	require.NoError(t, os.WriteFile(path, []byte("clusters: [ invalid"), 0644))
+	time.Sleep(3 * fileReloadDelay)
+
+	all, err := storage.All(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	// as well as an edit with duplicate clusters
+	require.NoError(t, os.WriteFile(path, []byte(`
+clusters:
+  - name: coord-0
+    url: http://trino0.local:8080
+  - name: coord-0
+    url: http://trino1.local:8080
+  - name: coord-2
+    url: http://trino2.local:8080
+`), 0644))
+	time.Sleep(3 * fileReloadDelay)
+
+	all, err = storage.All(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+}
+
+func testFileCoordinator(name string) models.Coordinator {
+	return models.Coordinator{
+		Name:    name,
+		URL:     tests.MustUrl("http://trino.local:8080"),
+		Tags:    map[string]string{"env": "test"},
+		Enabled: true,
+	}
+}
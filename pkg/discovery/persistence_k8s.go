@@ -0,0 +1,283 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	"net/url"
+	"strconv"
+)
+
+const (
+	TrinoClusterGroup   = "trino-loadbalancer.io"
+	TrinoClusterVersion = "v1alpha1"
+	TrinoClusterKind    = "TrinoCluster"
+)
+
+// TrinoClusterResource is the TrinoCluster custom resource, see resources/k8s/trinocluster-crd.yaml
+var TrinoClusterResource = schema.GroupVersionResource{
+	Group:    TrinoClusterGroup,
+	Version:  TrinoClusterVersion,
+	Resource: "trinoclusters",
+}
+
+// CrdStorage stores the clusters as TrinoCluster resources of a namespace, the resource name is the cluster name.
+// The weight field of the resource is exposed as the models.TagWeight tag. CrdStorage is also the Events of
+// the clusters: the changes are received watching the resources, publish is not needed
+type CrdStorage struct {
+	client    dynamic.Interface
+	namespace string
+	logger    logging.Logger
+}
+
+func NewCrdStorage(client dynamic.Interface, namespace string, logger logging.Logger) *CrdStorage {
+	return &CrdStorage{
+		client:    client,
+		namespace: namespace,
+		logger:    logger,
+	}
+}
+
+func (k *CrdStorage) Remove(ctx context.Context, name string) error {
+	err := k.resources().Delete(ctx, name, metav1.DeleteOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (k *CrdStorage) Add(ctx context.Context, coordinator models.Coordinator) error {
+	resource, err := coordinatorToResource(coordinator)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.resources().Create(ctx, resource, metav1.CreateOptions{})
+	if !k8serrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// same as the database storage, adding an existing cluster updates only its tags
+	return k.Update(ctx, coordinator.Name, UpdateRequest{Tags: coordinator.Tags})
+}
+
+func (k *CrdStorage) Update(ctx context.Context, name string, req UpdateRequest) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		resource, err := k.resources().Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to update cluster %s: %w", name, ErrClusterNotFound)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		coordinator, err := resourceToCoordinator(resource)
+		if err != nil {
+			return err
+		}
+
+		if req.Enabled != nil {
+			coordinator.Enabled = *req.Enabled
+		}
+
+		if req.Tags != nil {
+			coordinator.Tags = req.Tags
+		}
+
+		if err := setResourceSpec(resource, coordinator); err != nil {
+			return err
+		}
+
+		_, err = k.resources().Update(ctx, resource, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (k *CrdStorage) Get(ctx context.Context, name string) (models.Coordinator, error) {
+	resource, err := k.resources().Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return models.Coordinator{}, ErrClusterNotFound
+	}
+
+	if err != nil {
+		return models.Coordinator{}, err
+	}
+
+	return resourceToCoordinator(resource)
+}
+
+func (k *CrdStorage) All(ctx context.Context) ([]models.Coordinator, error) {
+	list, err := k.resources().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	coordinators := make([]models.Coordinator, 0, len(list.Items))
+	for i := range list.Items {
+		coordinator, err := resourceToCoordinator(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		coordinators = append(coordinators, coordinator)
+	}
+
+	return coordinators, nil
+}
+
+// Publish does nothing, the watchers receive the changes from the api server
+func (k *CrdStorage) Publish(ctx context.Context, event ChangeEvent) error {
+	return nil
+}
+
+// Subscribe watches the TrinoCluster resources, the channel is closed when the api server ends the watch
+func (k *CrdStorage) Subscribe(ctx context.Context) (<-chan ChangeEvent, error) {
+	watcher, err := k.resources().Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan ChangeEvent)
+
+	go func() {
+		defer close(events)
+		defer watcher.Stop()
+
+		for {
+			select {
+			case change, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+
+				event, ok := k.changeEvent(change)
+				if !ok {
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func (k *CrdStorage) changeEvent(change watch.Event) (ChangeEvent, bool) {
+	if change.Type == watch.Error {
+		k.logger.Warn("error watching %s: %s", TrinoClusterResource.Resource, k8serrors.FromObject(change.Object).Error())
+		return ChangeEvent{}, false
+	}
+
+	resource, ok := change.Object.(*unstructured.Unstructured)
+	if !ok {
+		return ChangeEvent{}, false
+	}
+
+	switch change.Type {
+	case watch.Added:
+		return ChangeEvent{Type: ClusterAdded, Cluster: resource.GetName()}, true
+	case watch.Modified:
+		return ChangeEvent{Type: ClusterUpdated, Cluster: resource.GetName()}, true
+	case watch.Deleted:
+		return ChangeEvent{Type: ClusterRemoved, Cluster: resource.GetName()}, true
+	}
+
+	return ChangeEvent{}, false
+}
+
+func (k *CrdStorage) resources() dynamic.ResourceInterface {
+	return k.client.Resource(TrinoClusterResource).Namespace(k.namespace)
+}
+
+func coordinatorToResource(coordinator models.Coordinator) (*unstructured.Unstructured, error) {
+	resource := &unstructured.Unstructured{}
+	resource.SetAPIVersion(TrinoClusterGroup + "/" + TrinoClusterVersion)
+	resource.SetKind(TrinoClusterKind)
+	resource.SetName(coordinator.Name)
+
+	if err := setResourceSpec(resource, coordinator); err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func setResourceSpec(resource *unstructured.Unstructured, coordinator models.Coordinator) error {
+	tags := make(map[string]interface{}, len(coordinator.Tags))
+	spec := map[string]interface{}{
+		"url":     coordinator.URL.String(),
+		"enabled": coordinator.Enabled,
+	}
+
+	for k, v := range coordinator.Tags {
+		if k == models.TagWeight {
+			weight, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid weight for cluster %s: %w", coordinator.Name, err)
+			}
+			spec["weight"] = weight
+			continue
+		}
+		tags[k] = v
+	}
+
+	spec["tags"] = tags
+	return unstructured.SetNestedMap(resource.Object, spec, "spec")
+}
+
+func resourceToCoordinator(resource *unstructured.Unstructured) (models.Coordinator, error) {
+	rawUrl, _, err := unstructured.NestedString(resource.Object, "spec", "url")
+	if err != nil {
+		return models.Coordinator{}, err
+	}
+
+	uri, err := url.Parse(rawUrl)
+	if err != nil {
+		return models.Coordinator{}, fmt.Errorf("invalid url for cluster %s: %w", resource.GetName(), err)
+	}
+
+	enabled, _, err := unstructured.NestedBool(resource.Object, "spec", "enabled")
+	if err != nil {
+		return models.Coordinator{}, err
+	}
+
+	tags, _, err := unstructured.NestedStringMap(resource.Object, "spec", "tags")
+	if err != nil {
+		return models.Coordinator{}, err
+	}
+
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+
+	weight, found, err := unstructured.NestedInt64(resource.Object, "spec", "weight")
+	if err != nil {
+		return models.Coordinator{}, err
+	}
+
+	if found {
+		tags[models.TagWeight] = strconv.FormatInt(weight, 10)
+	}
+
+	return models.Coordinator{
+		Name:    resource.GetName(),
+		URL:     uri,
+		Tags:    tags,
+		Enabled: enabled,
+	}, nil
+}
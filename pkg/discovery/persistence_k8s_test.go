@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"testing"
+)
+
+const testNamespace = "trino"
+
+func fakeDynamicClient(objects ...runtime.Object) *fake.FakeDynamicClient {
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		TrinoClusterResource: TrinoClusterKind + "List",
+	}, objects...)
+}
+
+func trinoClusterResource(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	resource.SetAPIVersion(TrinoClusterGroup + "/" + TrinoClusterVersion)
+	resource.SetKind(TrinoClusterKind)
+	resource.SetNamespace(testNamespace)
+	resource.SetName(name)
+	return resource
+}
+
+func TestCrdStorageReadsResources(t *testing.T) {
+	ctx := context.TODO()
+
+	client := fakeDynamicClient(
+		trinoClusterResource("cluster-0", map[string]interface{}{
+			"url":     "http://trino-0.local:8080",
+			"enabled": true,
+			"weight":  int64(4),
+			"tags":    map[string]interface{}{"env": "prod"},
+		}),
+		trinoClusterResource("cluster-1", map[string]interface{}{
+			"url": "http://trino-1.local:8080",
+		}),
+	)
+
+	storage := NewCrdStorage(client, testNamespace, logging.Noop())
+
+	all, err := storage.All(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	coordinator, err := storage.Get(ctx, "cluster-0")
+	require.NoError(t, err)
+	require.Equal(t, "http://trino-0.local:8080", coordinator.URL.String())
+	require.True(t, coordinator.Enabled)
+	require.Equal(t, map[string]string{"env": "prod", models.TagWeight: "4"}, coordinator.Tags)
+
+	coordinator, err = storage.Get(ctx, "cluster-1")
+	require.NoError(t, err)
+	require.False(t, coordinator.Enabled)
+	require.Equal(t, map[string]string{}, coordinator.Tags)
+
+	_, err = storage.Get(ctx, "not-existing")
+	require.Equal(t, ErrClusterNotFound, err)
+
+	// the resources of other namespaces are ignored
+	all, err = NewCrdStorage(client, "other", logging.Noop()).All(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 0)
+}
+
+func TestCrdStorageWritesResources(t *testing.T) {
+	ctx := context.TODO()
+	client := fakeDynamicClient()
+	storage := NewCrdStorage(client, testNamespace, logging.Noop())
+
+	require.NoError(t, storage.Add(ctx, models.Coordinator{
+		Name:    "cluster-0",
+		URL:     tests.MustUrl("http://trino-0.local:8080"),
+		Tags:    map[string]string{"env": "prod", models.TagWeight: "2"},
+		Enabled: true,
+	}))
+
+	resource, err := client.Resource(TrinoClusterResource).Namespace(testNamespace).Get(ctx, "cluster-0", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	weight, _, err := unstructured.NestedInt64(resource.Object, "spec", "weight")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), weight)
+
+	tags, _, err := unstructured.NestedStringMap(resource.Object, "spec", "tags")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"env": "prod"}, tags)
+
+	disabled := false
+	require.NoError(t, storage.Update(ctx, "cluster-0", UpdateRequest{
+		Enabled: &disabled,
+		Tags:    map[string]string{"env": "prod", models.TagWeight: "8"},
+	}))
+
+	coordinator, err := storage.Get(ctx, "cluster-0")
+	require.NoError(t, err)
+	require.False(t, coordinator.Enabled)
+	require.Equal(t, "8", coordinator.Tags[models.TagWeight])
+
+	err = storage.Update(ctx, "not-existing", UpdateRequest{Enabled: &disabled})
+	require.True(t, errors.Is(err, ErrClusterNotFound))
+
+	err = storage.Add(ctx, models.Coordinator{
+		Name: "cluster-1",
+		URL:  tests.MustUrl("http://trino-1.local:8080"),
+		Tags: map[string]string{models.TagWeight: "heavy"},
+	})
+	require.Error(t, err)
+
+	require.NoError(t, storage.Remove(ctx, "cluster-0"))
+	require.NoError(t, storage.Remove(ctx, "cluster-0"))
+
+	all, err := storage.All(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 0)
+}
+
+func TestCrdStorageWatchesResources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage := NewCrdStorage(fakeDynamicClient(), testNamespace, logging.Noop())
+
+	events, err := storage.Subscribe(ctx)
+	require.NoError(t, err)
+
+	coordinator := models.Coordinator{
+		Name:    "cluster-0",
+		URL:     tests.MustUrl("http://trino-0.local:8080"),
+		Tags:    map[string]string{},
+		Enabled: true,
+	}
+
+	require.NoError(t, storage.Add(ctx, coordinator))
+	require.Equal(t, ChangeEvent{Type: ClusterAdded, Cluster: "cluster-0"}, receiveEvent(t, events))
+
+	disabled := false
+	require.NoError(t, storage.Update(ctx, "cluster-0", UpdateRequest{Enabled: &disabled}))
+	require.Equal(t, ChangeEvent{Type: ClusterUpdated, Cluster: "cluster-0"}, receiveEvent(t, events))
+
+	require.NoError(t, storage.Remove(ctx, "cluster-0"))
+	require.Equal(t, ChangeEvent{Type: ClusterRemoved, Cluster: "cluster-0"}, receiveEvent(t, events))
+}
@@ -27,14 +27,14 @@ func (m *MemoryStorage) Remove(ctx context.Context, name string) error {
 }
 
 func (m *MemoryStorage) Update(ctx context.Context, name string, request UpdateRequest) error {
-	for _, s := range m.status {
-		if s.Name == name {
+	for i := range m.status {
+		if m.status[i].Name == name {
 			if request.Enabled != nil {
-				s.Enabled = *request.Enabled
+				m.status[i].Enabled = *request.Enabled
 			}
 
 			if request.Tags != nil {
-				s.Tags = request.Tags
+				m.status[i].Tags = request.Tags
 			}
 			return nil
 		}
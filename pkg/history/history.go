@@ -0,0 +1,245 @@
+package history
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTableName   = "trino_queries"
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+var (
+	ErrQueryNotFound = errors.New("query not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+type Storage interface {
+	// Store inserts the query or updates the stored one with the same id and cluster
+	Store(context.Context, Query) error
+	// Get returns the most recent query with the given id, an empty cluster matches every cluster
+	Get(ctx context.Context, cluster string, id string) (Query, error)
+	Search(context.Context, SearchRequest) (SearchResult, error)
+	// TopUsersByCpu returns the users with the highest cpu time spent by the queries submitted in the range
+	TopUsersByCpu(ctx context.Context, from time.Time, to time.Time, limit int) ([]UserUsage, error)
+	// HourlyQueries returns the number of queries submitted in the range for every cluster and hour
+	HourlyQueries(ctx context.Context, from time.Time, to time.Time) ([]ClusterHourlyQueries, error)
+}
+
+// Query is a completed query, nil values are not available in the query detail. Durations are serialized
+// in nanoseconds and data sizes in bytes
+type Query struct {
+	ID            string `json:"id"`
+	Cluster       string `json:"cluster"`
+	State         string `json:"state"`
+	Query         string `json:"query"`
+	User          string `json:"user"`
+	Principal     string `json:"principal"`
+	Catalog       string `json:"catalog"`
+	Schema        string `json:"schema"`
+	ClientAddress string `json:"client_address"`
+	ResourceGroup string `json:"resource_group"`
+
+	SubmissionTime *time.Time `json:"submission_time"`
+	CompletionTime *time.Time `json:"completion_time"`
+
+	ElapsedTime   *time.Duration `json:"elapsed_time"`
+	QueuedTime    *time.Duration `json:"queued_time"`
+	AnalysisTime  *time.Duration `json:"analysis_time"`
+	PlanningTime  *time.Duration `json:"planning_time"`
+	ExecutionTime *time.Duration `json:"execution_time"`
+
+	CpuTime               *time.Duration `json:"cpu_time"`
+	ScheduledTime         *time.Duration `json:"scheduled_time"`
+	InputRows             int64          `json:"input_rows"`
+	InputData             *int64         `json:"input_data"`
+	PhysicalInputRows     int64          `json:"physical_input_rows"`
+	PhysicalInputData     *int64         `json:"physical_input_data"`
+	PhysicalInputReadTime *time.Duration `json:"physical_input_read_time"`
+	InternalNetworkRows   int64          `json:"internal_network_rows"`
+	InternalNetworkData   *int64         `json:"internal_network_data"`
+	PeakUserMemory        *int64         `json:"peak_user_memory"`
+	PeakTotalMemory       *int64         `json:"peak_total_memory"`
+	CumulativeUserMemory  *int64         `json:"cumulative_user_memory"`
+	OutputRows            int64          `json:"output_rows"`
+	OutputData            *int64         `json:"output_data"`
+	WrittenRows           int64          `json:"written_rows"`
+	LogicalWrittenData    *int64         `json:"logical_written_data"`
+	PhysicalWrittenData   *int64         `json:"physical_written_data"`
+}
+
+type SearchRequest struct {
+	User          string
+	Cluster       string
+	State         string
+	ResourceGroup string
+	// Text matches the queries containing the text, case insensitive
+	Text string
+	From time.Time
+	To   time.Time
+
+	Limit  int
+	Cursor string
+}
+
+// SearchResult contains the queries sorted by submission time, most recent first. NextCursor is empty
+// when there are no more results
+type SearchResult struct {
+	Queries    []Query `json:"queries"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+type UserUsage struct {
+	User    string        `json:"user"`
+	Queries int64         `json:"queries"`
+	CpuTime time.Duration `json:"cpu_time"`
+}
+
+type ClusterHourlyQueries struct {
+	Cluster string    `json:"cluster"`
+	Hour    time.Time `json:"hour"`
+	Queries int64     `json:"queries"`
+}
+
+// NewQuery maps the query detail to the history record, the values that can't be parsed are left empty
+func NewQuery(cluster string, detail trino.QueryDetail) Query {
+	stats := detail.QueryStats
+
+	return Query{
+		ID:            detail.QueryID,
+		Cluster:       cluster,
+		State:         detail.State,
+		Query:         detail.Query,
+		User:          detail.Session.User,
+		Principal:     detail.Session.Principal,
+		Catalog:       detail.Session.Catalog,
+		Schema:        detail.Session.Schema,
+		ClientAddress: detail.Session.RemoteUserAddress,
+		ResourceGroup: strings.Join(detail.ResourceGroupID, "."),
+
+		SubmissionTime: timestamp(stats.CreateTime),
+		CompletionTime: timestamp(stats.EndTime),
+
+		ElapsedTime:   duration(stats.ElapsedTime),
+		QueuedTime:    duration(stats.QueuedTime),
+		AnalysisTime:  duration(stats.AnalysisTime),
+		PlanningTime:  duration(stats.PlanningTime),
+		ExecutionTime: duration(stats.ExecutionTime),
+
+		CpuTime:               duration(stats.TotalCPUTime),
+		ScheduledTime:         duration(stats.TotalScheduledTime),
+		InputRows:             int64(stats.ProcessedInputPositions),
+		InputData:             dataSize(stats.ProcessedInputDataSize),
+		PhysicalInputRows:     int64(stats.PhysicalInputPositions),
+		PhysicalInputData:     dataSize(stats.PhysicalInputDataSize),
+		PhysicalInputReadTime: duration(stats.PhysicalInputReadTime),
+		InternalNetworkRows:   int64(stats.InternalNetworkInputPositions),
+		InternalNetworkData:   dataSize(stats.InternalNetworkInputDataSize),
+		PeakUserMemory:        dataSize(stats.PeakUserMemoryReservation),
+		PeakTotalMemory:       dataSize(stats.PeakTotalMemoryReservation),
+		CumulativeUserMemory:  cumulativeMemory(stats.CumulativeUserMemory),
+		OutputRows:            int64(stats.OutputPositions),
+		OutputData:            dataSize(stats.OutputDataSize),
+		WrittenRows:           int64(stats.WrittenPositions),
+		LogicalWrittenData:    dataSize(stats.LogicalWrittenDataSize),
+		PhysicalWrittenData:   dataSize(stats.PhysicalWrittenDataSize),
+	}
+}
+
+// cursor is the position of the last returned query in the result ordering
+type cursor struct {
+	SubmissionTime time.Time `json:"t"`
+	Cluster        string    `json:"c"`
+	ID             string    `json:"i"`
+}
+
+func newCursor(query Query) cursor {
+	var submission time.Time
+	if query.SubmissionTime != nil {
+		submission = *query.SubmissionTime
+	}
+	return cursor{SubmissionTime: submission, Cluster: query.Cluster, ID: query.ID}
+}
+
+func (c cursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(raw string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, err.Error())
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, err.Error())
+	}
+	return c, nil
+}
+
+// newSearchResult builds the result from the queries fetched with limit+1, the extra query means that
+// there is another page
+func newSearchResult(queries []Query, limit int) SearchResult {
+	if len(queries) <= limit {
+		return SearchResult{Queries: queries}
+	}
+
+	queries = queries[:limit]
+	return SearchResult{
+		Queries:    queries,
+		NextCursor: newCursor(queries[len(queries)-1]).encode(),
+	}
+}
+
+func searchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+	return limit
+}
+
+func timestamp(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func duration(raw string) *time.Duration {
+	d, err := trino.ParseDuration(raw)
+	if err != nil {
+		return nil
+	}
+	return &d
+}
+
+func dataSize(raw string) *int64 {
+	size, err := trino.ParseDataSize(raw)
+	if err != nil {
+		return nil
+	}
+	return &size
+}
+
+// cumulativeMemory is returned by trino as a number of byte-seconds
+func cumulativeMemory(raw interface{}) *int64 {
+	value, ok := raw.(float64)
+	if !ok {
+		return nil
+	}
+	memory := int64(value)
+	return &memory
+}
@@ -0,0 +1,222 @@
+package history
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func testQueryDetail() trino.QueryDetail {
+	return trino.QueryDetail{
+		QueryID: "20210101_000000_00001_abcde",
+		Self:    "http://trino-0.local:8080/v1/query/20210101_000000_00001_abcde",
+		State:   trino.QueryFinished,
+		Query:   "select count(*) from orders",
+		Session: trino.Session{
+			User:              "analyst",
+			Principal:         "analyst@corp",
+			Catalog:           "hive",
+			Schema:            "sales",
+			RemoteUserAddress: "10.0.0.12",
+		},
+		ResourceGroupID: []string{"global", "adhoc"},
+		QueryStats: trino.QueryStats{
+			CreateTime:                    time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+			EndTime:                       time.Date(2021, 1, 1, 10, 1, 30, 0, time.UTC),
+			ElapsedTime:                   "1.50m",
+			QueuedTime:                    "120.00ms",
+			AnalysisTime:                  "1.20s",
+			PlanningTime:                  "300.00ms",
+			ExecutionTime:                 "1.45m",
+			TotalCPUTime:                  "2.00h",
+			TotalScheduledTime:            "1.00d",
+			ProcessedInputPositions:       1000,
+			ProcessedInputDataSize:        "1.50kB",
+			PhysicalInputPositions:        900,
+			PhysicalInputDataSize:         "1MB",
+			PhysicalInputReadTime:         "5.00s",
+			InternalNetworkInputPositions: 10,
+			InternalNetworkInputDataSize:  "512B",
+			PeakUserMemoryReservation:     "2GB",
+			PeakTotalMemoryReservation:    "3GB",
+			CumulativeUserMemory:          float64(12345),
+			OutputPositions:               1,
+			OutputDataSize:                "9B",
+			WrittenPositions:              0,
+			LogicalWrittenDataSize:        "0B",
+			PhysicalWrittenDataSize:       "0B",
+		},
+	}
+}
+
+func TestNewQuery(t *testing.T) {
+	record := NewQuery("trino-0", testQueryDetail())
+
+	require.Equal(t, "20210101_000000_00001_abcde", record.ID)
+	require.Equal(t, "trino-0", record.Cluster)
+	require.Equal(t, trino.QueryFinished, record.State)
+	require.Equal(t, "select count(*) from orders", record.Query)
+	require.Equal(t, "analyst", record.User)
+	require.Equal(t, "analyst@corp", record.Principal)
+	require.Equal(t, "hive", record.Catalog)
+	require.Equal(t, "sales", record.Schema)
+	require.Equal(t, "10.0.0.12", record.ClientAddress)
+	require.Equal(t, "global.adhoc", record.ResourceGroup)
+
+	require.Equal(t, time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC), *record.SubmissionTime)
+	require.Equal(t, time.Date(2021, 1, 1, 10, 1, 30, 0, time.UTC), *record.CompletionTime)
+
+	require.Equal(t, 90*time.Second, *record.ElapsedTime)
+	require.Equal(t, 120*time.Millisecond, *record.QueuedTime)
+	require.Equal(t, 1200*time.Millisecond, *record.AnalysisTime)
+	require.Equal(t, 300*time.Millisecond, *record.PlanningTime)
+	require.Equal(t, 87*time.Second, *record.ExecutionTime)
+	require.Equal(t, 2*time.Hour, *record.CpuTime)
+	require.Equal(t, 24*time.Hour, *record.ScheduledTime)
+	require.Equal(t, 5*time.Second, *record.PhysicalInputReadTime)
+
+	require.Equal(t, int64(1000), record.InputRows)
+	require.Equal(t, int64(1536), *record.InputData)
+	require.Equal(t, int64(900), record.PhysicalInputRows)
+	require.Equal(t, int64(1<<20), *record.PhysicalInputData)
+	require.Equal(t, int64(10), record.InternalNetworkRows)
+	require.Equal(t, int64(512), *record.InternalNetworkData)
+	require.Equal(t, int64(2<<30), *record.PeakUserMemory)
+	require.Equal(t, int64(3<<30), *record.PeakTotalMemory)
+	require.Equal(t, int64(12345), *record.CumulativeUserMemory)
+	require.Equal(t, int64(1), record.OutputRows)
+	require.Equal(t, int64(9), *record.OutputData)
+	require.Equal(t, int64(0), *record.LogicalWrittenData)
+	require.Equal(t, int64(0), *record.PhysicalWrittenData)
+}
+
+func TestNewQueryMissingValues(t *testing.T) {
+	record := NewQuery("trino-0", trino.QueryDetail{QueryID: "q"})
+
+	require.Nil(t, record.SubmissionTime)
+	require.Nil(t, record.CompletionTime)
+	require.Nil(t, record.ElapsedTime)
+	require.Nil(t, record.InputData)
+	require.Nil(t, record.CumulativeUserMemory)
+	require.Empty(t, record.ResourceGroup)
+}
+
+func TestCursorEncoding(t *testing.T) {
+	submission := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	c := newCursor(Query{ID: "q1", Cluster: "trino-0", SubmissionTime: &submission})
+
+	decoded, err := decodeCursor(c.encode())
+	require.NoError(t, err)
+	require.Equal(t, c, decoded)
+
+	_, err = decodeCursor("not a cursor")
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func storedQuery(cluster string, id string, user string, submission time.Time, cpu time.Duration) Query {
+	return Query{
+		ID:             id,
+		Cluster:        cluster,
+		State:          trino.QueryFinished,
+		Query:          "SELECT * FROM " + id,
+		User:           user,
+		ResourceGroup:  "global." + user,
+		SubmissionTime: &submission,
+		CpuTime:        &cpu,
+	}
+}
+
+// testStorage runs the same scenario against every storage implementation
+func testStorage(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	base := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	queries := []Query{
+		storedQuery("trino-0", "q0", "alice", base, 10*time.Second),
+		storedQuery("trino-0", "q1", "bob", base.Add(10*time.Minute), 30*time.Second),
+		storedQuery("trino-1", "q2", "alice", base.Add(20*time.Minute), 5*time.Second),
+		storedQuery("trino-1", "q3", "carol", base.Add(70*time.Minute), time.Second),
+		storedQuery("trino-0", "q4", "alice", base.Add(80*time.Minute), 40*time.Second),
+	}
+	for _, q := range queries {
+		require.NoError(t, storage.Store(ctx, q))
+	}
+
+	// storing the same query again updates it
+	updated := storedQuery("trino-0", "q4", "alice", base.Add(80*time.Minute), 40*time.Second)
+	updated.State = "FAILED"
+	require.NoError(t, storage.Store(ctx, updated))
+
+	stored, err := storage.Get(ctx, "", "q4")
+	require.NoError(t, err)
+	require.Equal(t, "FAILED", stored.State)
+	require.Equal(t, 40*time.Second, *stored.CpuTime)
+	require.True(t, base.Add(80*time.Minute).Equal(*stored.SubmissionTime))
+
+	_, err = storage.Get(ctx, "trino-1", "q4")
+	require.ErrorIs(t, err, ErrQueryNotFound)
+
+	// pagination returns every query once, most recent first
+	ids := make([]string, 0)
+	req := SearchRequest{Limit: 2}
+	for {
+		result, err := storage.Search(ctx, req)
+		require.NoError(t, err)
+		for _, q := range result.Queries {
+			ids = append(ids, q.ID)
+		}
+		if len(result.NextCursor) == 0 {
+			break
+		}
+		req.Cursor = result.NextCursor
+	}
+	require.Equal(t, []string{"q4", "q3", "q2", "q1", "q0"}, ids)
+
+	tests := []struct {
+		name     string
+		req      SearchRequest
+		expected []string
+	}{
+		{name: "user", req: SearchRequest{User: "alice"}, expected: []string{"q4", "q2", "q0"}},
+		{name: "cluster", req: SearchRequest{Cluster: "trino-1"}, expected: []string{"q3", "q2"}},
+		{name: "state", req: SearchRequest{State: "FAILED"}, expected: []string{"q4"}},
+		{name: "resource group", req: SearchRequest{ResourceGroup: "global.bob"}, expected: []string{"q1"}},
+		{name: "text", req: SearchRequest{Text: "from Q3"}, expected: []string{"q3"}},
+		{name: "range", req: SearchRequest{From: base.Add(10 * time.Minute), To: base.Add(70 * time.Minute)}, expected: []string{"q2", "q1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := storage.Search(ctx, tt.req)
+			require.NoError(t, err)
+			require.Empty(t, result.NextCursor)
+
+			ids := make([]string, len(result.Queries))
+			for i, q := range result.Queries {
+				ids[i] = q.ID
+			}
+			require.Equal(t, tt.expected, ids)
+		})
+	}
+
+	_, err = storage.Search(ctx, SearchRequest{Cursor: "invalid"})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	users, err := storage.TopUsersByCpu(ctx, base, base.Add(2*time.Hour), 2)
+	require.NoError(t, err)
+	require.Equal(t, []UserUsage{
+		{User: "alice", Queries: 3, CpuTime: 55 * time.Second},
+		{User: "bob", Queries: 1, CpuTime: 30 * time.Second},
+	}, users)
+
+	hourly, err := storage.HourlyQueries(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []ClusterHourlyQueries{
+		{Cluster: "trino-0", Hour: base, Queries: 2},
+		{Cluster: "trino-1", Hour: base, Queries: 1},
+		{Cluster: "trino-0", Hour: base.Add(time.Hour), Queries: 1},
+		{Cluster: "trino-1", Hour: base.Add(time.Hour), Queries: 1},
+	}, hourly)
+}
@@ -0,0 +1,368 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var queryColumns = []string{
+	"id", "cluster", "state", "query", `"user"`, "principal", "catalog", "schema", "client_address", "resource_group",
+	"submission_time", "completion_time",
+	"elapsed_time", "queued_time", "analysis_time", "planning_time", "execution_time",
+	"resources_cpu_time", "resources_scheduled_time", "resources_input_rows", "resources_input_data",
+	"resources_physical_input_rows", "resources_physical_input_data", "resources_physical_input_read_time",
+	"resources_internal_network_rows", "resources_internal_network_data", "resources_peak_user_memory",
+	"resources_peak_total_memory", "resources_cumulative_user_memory", "resources_output_rows",
+	"resources_output_data", "resources_written_rows", "resources_logical_written_data",
+	"resources_physical_written_data",
+}
+
+var intervalColumns = map[string]bool{
+	"elapsed_time": true, "queued_time": true, "analysis_time": true, "planning_time": true, "execution_time": true,
+	"resources_cpu_time": true, "resources_scheduled_time": true, "resources_physical_input_read_time": true,
+}
+
+type DatabaseStorage struct {
+	db    *sql.DB
+	table string
+}
+
+func NewDatabaseStorage(db *sql.DB, table string) *DatabaseStorage {
+	return &DatabaseStorage{
+		db:    db,
+		table: table,
+	}
+}
+
+func (d DatabaseStorage) Store(ctx context.Context, q Query) error {
+	placeholders := make([]string, len(queryColumns))
+	updates := make([]string, 0, len(queryColumns))
+	for i, column := range queryColumns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		if column != "id" && column != "cluster" {
+			updates = append(updates, fmt.Sprintf("%[1]s = excluded.%[1]s", column))
+		}
+	}
+
+	query := fmt.Sprintf(`
+INSERT INTO %s (%s) VALUES (%s)
+ON CONFLICT (id, cluster) DO UPDATE SET %s
+`, d.table, strings.Join(queryColumns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+
+	_, err := d.db.ExecContext(ctx, query,
+		q.ID, q.Cluster, q.State, q.Query, q.User, q.Principal, q.Catalog, q.Schema, q.ClientAddress, q.ResourceGroup,
+		utc(q.SubmissionTime), utc(q.CompletionTime),
+		interval(q.ElapsedTime), interval(q.QueuedTime), interval(q.AnalysisTime), interval(q.PlanningTime),
+		interval(q.ExecutionTime),
+		interval(q.CpuTime), interval(q.ScheduledTime), q.InputRows, q.InputData,
+		q.PhysicalInputRows, q.PhysicalInputData, interval(q.PhysicalInputReadTime),
+		q.InternalNetworkRows, q.InternalNetworkData, q.PeakUserMemory,
+		q.PeakTotalMemory, q.CumulativeUserMemory, q.OutputRows,
+		q.OutputData, q.WrittenRows, q.LogicalWrittenData,
+		q.PhysicalWrittenData,
+	)
+
+	return err
+}
+
+func (d DatabaseStorage) Get(ctx context.Context, cluster string, id string) (Query, error) {
+	filter := newFilter()
+	filter.add("id = %s", id)
+	if len(cluster) != 0 {
+		filter.add("cluster = %s", cluster)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY submission_time DESC NULLS LAST LIMIT 1", selectColumns(), d.table, filter.where())
+	queries, err := d.query(ctx, query, filter.args...)
+	if err != nil {
+		return Query{}, err
+	}
+
+	if len(queries) == 0 {
+		return Query{}, ErrQueryNotFound
+	}
+
+	return queries[0], nil
+}
+
+func (d DatabaseStorage) Search(ctx context.Context, req SearchRequest) (SearchResult, error) {
+	filter := newFilter()
+	filter.add("submission_time IS NOT NULL")
+
+	if len(req.User) != 0 {
+		filter.add(`"user" = %s`, req.User)
+	}
+	if len(req.Cluster) != 0 {
+		filter.add("cluster = %s", req.Cluster)
+	}
+	if len(req.State) != 0 {
+		filter.add("state = %s", req.State)
+	}
+	if len(req.ResourceGroup) != 0 {
+		filter.add("resource_group = %s", req.ResourceGroup)
+	}
+	if len(req.Text) != 0 {
+		filter.add("query ILIKE %s", "%"+escapeLike(req.Text)+"%")
+	}
+	filter.addRange(req.From, req.To)
+
+	if len(req.Cursor) != 0 {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		filter.add("(submission_time, cluster, id) < (%s, %s, %s)", c.SubmissionTime.UTC(), c.Cluster, c.ID)
+	}
+
+	limit := searchLimit(req.Limit)
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY submission_time DESC, cluster DESC, id DESC LIMIT %d",
+		selectColumns(), d.table, filter.where(), limit+1)
+
+	queries, err := d.query(ctx, query, filter.args...)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	return newSearchResult(queries, limit), nil
+}
+
+func (d DatabaseStorage) TopUsersByCpu(ctx context.Context, from time.Time, to time.Time, limit int) ([]UserUsage, error) {
+	filter := newFilter()
+	filter.add("TRUE")
+	filter.addRange(from, to)
+
+	query := fmt.Sprintf(`
+SELECT "user", count(*), coalesce((extract(epoch from sum(resources_cpu_time)) * 1000000)::bigint, 0) AS cpu_time
+FROM %s WHERE %s
+GROUP BY "user"
+ORDER BY cpu_time DESC, "user"
+LIMIT %d`, d.table, filter.where(), searchLimit(limit))
+
+	rows, err := d.db.QueryContext(ctx, query, filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usages := make([]UserUsage, 0)
+	for rows.Next() {
+		var usage UserUsage
+		var user sql.NullString
+		var cpuMicros int64
+		if err := rows.Scan(&user, &usage.Queries, &cpuMicros); err != nil {
+			return nil, err
+		}
+		usage.User = user.String
+		usage.CpuTime = time.Duration(cpuMicros) * time.Microsecond
+		usages = append(usages, usage)
+	}
+
+	return usages, rows.Err()
+}
+
+func (d DatabaseStorage) HourlyQueries(ctx context.Context, from time.Time, to time.Time) ([]ClusterHourlyQueries, error) {
+	filter := newFilter()
+	filter.add("submission_time IS NOT NULL")
+	filter.addRange(from, to)
+
+	query := fmt.Sprintf(`
+SELECT cluster, date_trunc('hour', submission_time) AS hour, count(*)
+FROM %s WHERE %s
+GROUP BY cluster, hour
+ORDER BY hour, cluster`, d.table, filter.where())
+
+	rows, err := d.db.QueryContext(ctx, query, filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]ClusterHourlyQueries, 0)
+	for rows.Next() {
+		var count ClusterHourlyQueries
+		if err := rows.Scan(&count.Cluster, &count.Hour, &count.Queries); err != nil {
+			return nil, err
+		}
+		count.Hour = count.Hour.UTC()
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func (d DatabaseStorage) query(ctx context.Context, query string, args ...interface{}) ([]Query, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queries := make([]Query, 0)
+	for rows.Next() {
+		q, err := queryFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+
+	return queries, rows.Err()
+}
+
+func queryFromRow(rows *sql.Rows) (Query, error) {
+	var q Query
+	var state, text, user, principal, catalog, schema, clientAddress, resourceGroup sql.NullString
+	var submission, completion sql.NullTime
+	var elapsed, queued, analysis, planning, execution, cpu, scheduled, readTime sql.NullInt64
+	var inputRows, physicalInputRows, internalNetworkRows, outputRows, writtenRows sql.NullInt64
+	var inputData, physicalInputData, internalNetworkData, peakUserMemory, peakTotalMemory, cumulativeUserMemory,
+		outputData, logicalWrittenData, physicalWrittenData sql.NullInt64
+
+	err := rows.Scan(
+		&q.ID, &q.Cluster, &state, &text, &user, &principal, &catalog, &schema, &clientAddress, &resourceGroup,
+		&submission, &completion,
+		&elapsed, &queued, &analysis, &planning, &execution,
+		&cpu, &scheduled, &inputRows, &inputData,
+		&physicalInputRows, &physicalInputData, &readTime,
+		&internalNetworkRows, &internalNetworkData, &peakUserMemory,
+		&peakTotalMemory, &cumulativeUserMemory, &outputRows,
+		&outputData, &writtenRows, &logicalWrittenData,
+		&physicalWrittenData,
+	)
+	if err != nil {
+		return Query{}, err
+	}
+
+	q.State = state.String
+	q.Query = text.String
+	q.User = user.String
+	q.Principal = principal.String
+	q.Catalog = catalog.String
+	q.Schema = schema.String
+	q.ClientAddress = clientAddress.String
+	q.ResourceGroup = resourceGroup.String
+
+	q.SubmissionTime = nullTime(submission)
+	q.CompletionTime = nullTime(completion)
+
+	q.ElapsedTime = micros(elapsed)
+	q.QueuedTime = micros(queued)
+	q.AnalysisTime = micros(analysis)
+	q.PlanningTime = micros(planning)
+	q.ExecutionTime = micros(execution)
+	q.CpuTime = micros(cpu)
+	q.ScheduledTime = micros(scheduled)
+	q.PhysicalInputReadTime = micros(readTime)
+
+	q.InputRows = inputRows.Int64
+	q.PhysicalInputRows = physicalInputRows.Int64
+	q.InternalNetworkRows = internalNetworkRows.Int64
+	q.OutputRows = outputRows.Int64
+	q.WrittenRows = writtenRows.Int64
+
+	q.InputData = nullInt(inputData)
+	q.PhysicalInputData = nullInt(physicalInputData)
+	q.InternalNetworkData = nullInt(internalNetworkData)
+	q.PeakUserMemory = nullInt(peakUserMemory)
+	q.PeakTotalMemory = nullInt(peakTotalMemory)
+	q.CumulativeUserMemory = nullInt(cumulativeUserMemory)
+	q.OutputData = nullInt(outputData)
+	q.LogicalWrittenData = nullInt(logicalWrittenData)
+	q.PhysicalWrittenData = nullInt(physicalWrittenData)
+
+	return q, nil
+}
+
+// selectColumns returns the query columns, intervals are converted to microseconds
+func selectColumns() string {
+	columns := make([]string, len(queryColumns))
+	for i, column := range queryColumns {
+		if intervalColumns[column] {
+			columns[i] = fmt.Sprintf("(extract(epoch from %s) * 1000000)::bigint", column)
+			continue
+		}
+		columns[i] = column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// filter builds the where clause replacing the %s in the conditions with positional parameters
+type filter struct {
+	conditions []string
+	args       []interface{}
+}
+
+func newFilter() *filter {
+	return &filter{}
+}
+
+func (f *filter) add(condition string, args ...interface{}) {
+	placeholders := make([]interface{}, len(args))
+	for i := range args {
+		placeholders[i] = fmt.Sprintf("$%d", len(f.args)+i+1)
+	}
+	f.conditions = append(f.conditions, fmt.Sprintf(condition, placeholders...))
+	f.args = append(f.args, args...)
+}
+
+func (f *filter) addRange(from time.Time, to time.Time) {
+	if !from.IsZero() {
+		f.add("submission_time >= %s", from.UTC())
+	}
+	if !to.IsZero() {
+		f.add("submission_time < %s", to.UTC())
+	}
+}
+
+func (f *filter) where() string {
+	return strings.Join(f.conditions, " AND ")
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// interval formats the duration as a postgres interval
+func interval(d *time.Duration) *string {
+	if d == nil {
+		return nil
+	}
+	value := fmt.Sprintf("%d microseconds", d.Microseconds())
+	return &value
+}
+
+// utc converts the time before storing it, the timestamp columns have no time zone
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	value := t.UTC()
+	return &value
+}
+
+func micros(value sql.NullInt64) *time.Duration {
+	if !value.Valid {
+		return nil
+	}
+	d := time.Duration(value.Int64) * time.Microsecond
+	return &d
+}
+
+func nullInt(value sql.NullInt64) *int64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int64
+}
+
+func nullTime(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := value.Time.UTC()
+	return &t
+}
@@ -0,0 +1,204 @@
+package history
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type queryKey struct {
+	cluster string
+	id      string
+}
+
+// MemoryStorage this is just for single node usage / testing purpose DO NOT use in production
+type MemoryStorage struct {
+	mutex   *sync.RWMutex
+	queries map[queryKey]Query
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		mutex:   &sync.RWMutex{},
+		queries: make(map[queryKey]Query),
+	}
+}
+
+func (m *MemoryStorage) Store(ctx context.Context, query Query) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.queries[queryKey{cluster: query.Cluster, id: query.ID}] = query
+	return nil
+}
+
+func (m *MemoryStorage) Get(ctx context.Context, cluster string, id string) (Query, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	found := make([]Query, 0)
+	for _, q := range m.queries {
+		if q.ID == id && (len(cluster) == 0 || q.Cluster == cluster) {
+			found = append(found, q)
+		}
+	}
+
+	if len(found) == 0 {
+		return Query{}, ErrQueryNotFound
+	}
+
+	sortQueries(found)
+	return found[0], nil
+}
+
+func (m *MemoryStorage) Search(ctx context.Context, req SearchRequest) (SearchResult, error) {
+	var after *cursor
+	if len(req.Cursor) != 0 {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		after = &c
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	matches := make([]Query, 0)
+	for _, q := range m.queries {
+		if q.SubmissionTime == nil || !inRange(*q.SubmissionTime, req.From, req.To) {
+			continue
+		}
+		if len(req.User) != 0 && q.User != req.User {
+			continue
+		}
+		if len(req.Cluster) != 0 && q.Cluster != req.Cluster {
+			continue
+		}
+		if len(req.State) != 0 && q.State != req.State {
+			continue
+		}
+		if len(req.ResourceGroup) != 0 && q.ResourceGroup != req.ResourceGroup {
+			continue
+		}
+		if len(req.Text) != 0 && !strings.Contains(strings.ToLower(q.Query), strings.ToLower(req.Text)) {
+			continue
+		}
+		if after != nil && !newCursor(q).before(*after) {
+			continue
+		}
+		matches = append(matches, q)
+	}
+
+	sortQueries(matches)
+
+	limit := searchLimit(req.Limit)
+	if len(matches) > limit+1 {
+		matches = matches[:limit+1]
+	}
+
+	return newSearchResult(matches, limit), nil
+}
+
+func (m *MemoryStorage) TopUsersByCpu(ctx context.Context, from time.Time, to time.Time, limit int) ([]UserUsage, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	byUser := make(map[string]*UserUsage)
+	for _, q := range m.queries {
+		if q.SubmissionTime == nil || !inRange(*q.SubmissionTime, from, to) {
+			continue
+		}
+
+		usage, present := byUser[q.User]
+		if !present {
+			usage = &UserUsage{User: q.User}
+			byUser[q.User] = usage
+		}
+
+		usage.Queries++
+		if q.CpuTime != nil {
+			usage.CpuTime += *q.CpuTime
+		}
+	}
+
+	usages := make([]UserUsage, 0, len(byUser))
+	for _, usage := range byUser {
+		usages = append(usages, *usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].CpuTime != usages[j].CpuTime {
+			return usages[i].CpuTime > usages[j].CpuTime
+		}
+		return usages[i].User < usages[j].User
+	})
+
+	if limit = searchLimit(limit); len(usages) > limit {
+		usages = usages[:limit]
+	}
+
+	return usages, nil
+}
+
+func (m *MemoryStorage) HourlyQueries(ctx context.Context, from time.Time, to time.Time) ([]ClusterHourlyQueries, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	type hourKey struct {
+		cluster string
+		hour    time.Time
+	}
+
+	byHour := make(map[hourKey]int64)
+	for _, q := range m.queries {
+		if q.SubmissionTime == nil || !inRange(*q.SubmissionTime, from, to) {
+			continue
+		}
+		byHour[hourKey{cluster: q.Cluster, hour: q.SubmissionTime.UTC().Truncate(time.Hour)}]++
+	}
+
+	counts := make([]ClusterHourlyQueries, 0, len(byHour))
+	for key, count := range byHour {
+		counts = append(counts, ClusterHourlyQueries{Cluster: key.cluster, Hour: key.hour, Queries: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if !counts[i].Hour.Equal(counts[j].Hour) {
+			return counts[i].Hour.Before(counts[j].Hour)
+		}
+		return counts[i].Cluster < counts[j].Cluster
+	})
+
+	return counts, nil
+}
+
+// sortQueries sorts the queries by submission time, cluster and id in descending order
+func sortQueries(queries []Query) {
+	sort.Slice(queries, func(i, j int) bool {
+		return newCursor(queries[j]).before(newCursor(queries[i]))
+	})
+}
+
+// before returns true if c comes before other in ascending order
+func (c cursor) before(other cursor) bool {
+	if !c.SubmissionTime.Equal(other.SubmissionTime) {
+		return c.SubmissionTime.Before(other.SubmissionTime)
+	}
+	if c.Cluster != other.Cluster {
+		return c.Cluster < other.Cluster
+	}
+	return c.ID < other.ID
+}
+
+func inRange(t time.Time, from time.Time, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !t.Before(to) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+package history
+
+import (
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
@@ -0,0 +1,103 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Entry describes the lifecycle of a query routed by the proxy
+type Entry struct {
+	QueryID        string    `json:"queryId"`
+	TransactionID  string    `json:"transactionId"`
+	User           string    `json:"user"`
+	Source         string    `json:"source,omitempty"`
+	ClientTags     []string  `json:"clientTags,omitempty"`
+	Coordinator    string    `json:"coordinator"`
+	RoutingRule    string    `json:"routingRule,omitempty"`
+	UserRule       string    `json:"userRule,omitempty"`
+	SubmittedAt    time.Time `json:"submittedAt"`
+	CompletedAt    time.Time `json:"completedAt"`
+	DurationMillis int64     `json:"durationMillis"`
+	State          string    `json:"state"`
+	ErrorName      string    `json:"errorName,omitempty"`
+	BytesIn        int64     `json:"bytesIn"`
+	BytesOut       int64     `json:"bytesOut"`
+	Query          string    `json:"query,omitempty"`
+}
+
+type Sink interface {
+	Write(Entry) error
+	Close() error
+}
+
+// WriterSink writes one json line for each entry
+type WriterSink struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{
+		writer: writer,
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func (w *WriterSink) Write(entry Entry) error {
+	line, err := marshalLine(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err = w.writer.Write(line)
+	return err
+}
+
+func (w *WriterSink) Close() error {
+	if closer, ok := w.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// MultiSink writes the entries to all the sinks, all the sinks are invoked even when one of them fails
+type MultiSink struct {
+	sinks []Sink
+}
+
+func NewMultiSink(sinks ...Sink) MultiSink {
+	return MultiSink{sinks: sinks}
+}
+
+func (m MultiSink) Write(entry Entry) error {
+	var firstErr error
+	for _, s := range m.sinks {
+		if err := s.Write(entry); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m MultiSink) Close() error {
+	var firstErr error
+	for _, s := range m.sinks {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func marshalLine(entry Entry) ([]byte, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,120 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterSink(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewWriterSink(&buffer)
+
+	require.NoError(t, sink.Write(Entry{QueryID: "q0", User: "user"}))
+	require.NoError(t, sink.Write(Entry{QueryID: "q1", User: "user"}))
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var entry Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	require.Equal(t, "q1", entry.QueryID)
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	sink, err := NewFileSink(path, 500, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sink.Write(Entry{QueryID: "20200924_102554_02623_yi2gi", User: "user"}))
+	}
+	require.NoError(t, sink.Close())
+
+	for _, file := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		require.LessOrEqual(t, info.Size(), int64(500))
+	}
+
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestHttpSink(t *testing.T) {
+	received := make(chan Entry, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token", r.Header.Get("Authorization"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var entry Entry
+		require.NoError(t, json.Unmarshal(body, &entry))
+		received <- entry
+	}))
+	defer srv.Close()
+
+	sink := NewHttpSink(srv.URL, map[string]string{"Authorization": "token"}, time.Second)
+	require.NoError(t, sink.Write(Entry{QueryID: "q0"}))
+	require.Equal(t, "q0", (<-received).QueryID)
+}
+
+func TestHttpSinkErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sink := NewHttpSink(srv.URL, nil, time.Second)
+	require.Error(t, sink.Write(Entry{QueryID: "q0"}))
+}
+
+func TestAsyncSinkFlushOnClose(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewAsyncSink(NewWriterSink(&buffer), 10, logging.Noop())
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sink.Write(Entry{QueryID: "q"}))
+	}
+	require.NoError(t, sink.Close())
+
+	require.Len(t, strings.Split(strings.TrimSpace(buffer.String()), "\n"), 5)
+}
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    "select * from t where name = 'it''s me' and id = 10",
+			expected: "select * from t where name = ? and id = ?",
+		},
+		{
+			query:    "select col1 from table_2021 where amount > 10.5e3",
+			expected: "select col1 from table_2021 where amount > ?",
+		},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, RedactQuery(tt.query))
+	}
+}
+
+func TestTruncateQuery(t *testing.T) {
+	require.Equal(t, "select", TruncateQuery("select 1", 6))
+	require.Equal(t, "select 1", TruncateQuery("select 1", 0))
+	// multi byte characters are not split
+	require.Equal(t, "select '", TruncateQuery("select 'è'", 9))
+}
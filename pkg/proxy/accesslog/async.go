@@ -0,0 +1,58 @@
+package accesslog
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"sync"
+)
+
+// AsyncSink decouples the request handling from slow sinks (eg. files on network storage or http endpoints),
+// when the buffer is full the entries are dropped instead of slowing down the proxied requests
+type AsyncSink struct {
+	sink    Sink
+	logger  logging.Logger
+	entries chan Entry
+	wg      *sync.WaitGroup
+	once    *sync.Once
+}
+
+func NewAsyncSink(sink Sink, bufferSize int, logger logging.Logger) *AsyncSink {
+	async := &AsyncSink{
+		sink:    sink,
+		logger:  logger,
+		entries: make(chan Entry, bufferSize),
+		wg:      &sync.WaitGroup{},
+		once:    &sync.Once{},
+	}
+
+	async.wg.Add(1)
+	go async.run()
+
+	return async
+}
+
+func (a *AsyncSink) Write(entry Entry) error {
+	select {
+	case a.entries <- entry:
+	default:
+		a.logger.Warn("access log buffer full, dropping entry for query %s", entry.QueryID)
+	}
+	return nil
+}
+
+// Close flushes the buffered entries and closes the underlying sink
+func (a *AsyncSink) Close() error {
+	a.once.Do(func() {
+		close(a.entries)
+	})
+	a.wg.Wait()
+	return a.sink.Close()
+}
+
+func (a *AsyncSink) run() {
+	defer a.wg.Done()
+	for entry := range a.entries {
+		if err := a.sink.Write(entry); err != nil {
+			a.logger.Error("error writing access log entry for query %s: %s", entry.QueryID, err.Error())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink writes the entries to a file rotated when it reaches MaxSizeBytes, the rotated files are renamed
+// with an increasing numeric suffix (access.log.1 is the most recent) and only MaxBackups files are kept
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mutex *sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func NewFileSink(path string, maxSizeBytes int64, maxBackups int) (*FileSink, error) {
+	sink := &FileSink{
+		path:       path,
+		maxSize:    maxSizeBytes,
+		maxBackups: maxBackups,
+		mutex:      &sync.Mutex{},
+	}
+
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+func (f *FileSink) Write(entry Entry) error {
+	line, err := marshalLine(entry)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.maxSize > 0 && f.size+int64(len(line)) > f.maxSize && f.size > 0 {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+func (f *FileSink) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
+
+func (f *FileSink) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening access log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *FileSink) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if f.maxBackups > 0 {
+		_ = os.Remove(f.backupPath(f.maxBackups))
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(f.backupPath(i), f.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if err := os.Rename(f.path, f.backupPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func (f *FileSink) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", f.path, index)
+}
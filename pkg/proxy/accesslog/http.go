@@ -0,0 +1,60 @@
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HttpSink sends each entry as a json document with a POST request to the configured endpoint
+type HttpSink struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func NewHttpSink(endpoint string, headers map[string]string, timeout time.Duration) HttpSink {
+	return HttpSink{
+		endpoint: endpoint,
+		headers:  headers,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (h HttpSink) Write(entry Entry) error {
+	body, err := marshalLine(entry)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("access log endpoint returned %d status code", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (h HttpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,34 @@
+package accesslog
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+const RedactedPlaceholder = "?"
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?(?:[eE][+-]?\d+)?\b`)
+)
+
+// RedactQuery replaces the string and numeric literals of a sql statement with a placeholder,
+// the structure of the query is preserved while values that may contain sensitive data are removed
+func RedactQuery(query string) string {
+	redacted := stringLiteral.ReplaceAllString(query, RedactedPlaceholder)
+	return numericLiteral.ReplaceAllString(redacted, RedactedPlaceholder)
+}
+
+// TruncateQuery limits the query length to maxLength bytes without breaking multi byte characters,
+// a maxLength <= 0 disables the truncation
+func TruncateQuery(query string, maxLength int) string {
+	if maxLength <= 0 || len(query) <= maxLength {
+		return query
+	}
+
+	truncated := query[:maxLength]
+	for len(truncated) > 0 && !utf8.ValidString(truncated) {
+		truncated = truncated[:len(truncated)-1]
+	}
+	return truncated
+}
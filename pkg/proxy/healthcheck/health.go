@@ -21,6 +21,13 @@ type HealthCheck interface {
 	Check(*url.URL) (Health, error)
 }
 
+// StatefulHealthCheck is implemented by the health checks keeping a state for each cluster, Forget discards
+// the state of a cluster removed from the pool
+type StatefulHealthCheck interface {
+	HealthCheck
+	Forget(*url.URL)
+}
+
 type Health struct {
 	Status    HealthStatus
 	Message   string
@@ -1,28 +1,65 @@
 package healthcheck
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	_ "github.com/trinodb/trino-go-client/trino"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	defaultTimeout = 15 * time.Second
+	defaultTimeout    = 15 * time.Second
+	defaultMinWorkers = 1
 )
 
+const healthCheckUser = "hc"
+
+type HttpHealthConf struct {
+	Timeout time.Duration
+	// MinWorkers is the minimum number of active workers required to run queries on the cluster
+	MinWorkers int
+	// MinVersion is the minimum trino version of the coordinator, 0 disables the check
+	MinVersion int
+}
+
 type HttpClusterHealth struct {
+	conf   HttpHealthConf
 	client *http.Client
 }
 
+type serverInfo struct {
+	NodeVersion struct {
+		Version string `json:"version"`
+	} `json:"nodeVersion"`
+	Coordinator bool `json:"coordinator"`
+	Starting    bool `json:"starting"`
+}
+
 func NewHttpHealth() *HttpClusterHealth {
 	return NewHttpHealthWithTimeout(defaultTimeout)
 }
 
 func NewHttpHealthWithTimeout(timeout time.Duration) *HttpClusterHealth {
+	return NewHttpHealthWithConf(HttpHealthConf{
+		Timeout:    timeout,
+		MinWorkers: defaultMinWorkers,
+	})
+}
+
+func NewHttpHealthWithConf(conf HttpHealthConf) *HttpClusterHealth {
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
 	return &HttpClusterHealth{
+		conf: conf,
 		client: &http.Client{
 			Timeout: timeout,
 			Transport: &http.Transport{
@@ -39,26 +76,98 @@ func NewHttpHealthWithTimeout(timeout time.Duration) *HttpClusterHealth {
 	}
 }
 
+// Check verifies that the coordinator is up (/v1/status), that it has completed the startup with a supported
+// version (/v1/info) and that there are enough active workers to execute queries (/v1/cluster)
 func (p *HttpClusterHealth) Check(u *url.URL) (Health, error) {
-
-	statusUrl := fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, "v1/status")
-	req, err := http.NewRequest(http.MethodGet, statusUrl, nil)
+	resp, err := p.get(u, "v1/status")
 	if err != nil {
-		return healthFromErr(fmt.Errorf("error creating http request: %w", err)), nil
+		return healthFromErr(err), nil
 	}
+	resp.Body.Close()
 
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return healthFromErr(fmt.Errorf("error executing http request: %w", err)), nil
+	var info serverInfo
+	if err := p.getJson(u, "v1/info", &info); err != nil {
+		return healthFromErr(err), nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return healthFromErr(fmt.Errorf("http request return %d status code", resp.StatusCode)), nil
+	if info.Starting {
+		return healthFromErr(fmt.Errorf("cluster is starting")), nil
+	}
+
+	if p.conf.MinVersion > 0 {
+		version, err := parseVersion(info.NodeVersion.Version)
+		if err != nil {
+			return healthFromErr(err), nil
+		}
+
+		if version < p.conf.MinVersion {
+			return healthFromErr(fmt.Errorf("cluster version %s is lower than the minimum %d", info.NodeVersion.Version, p.conf.MinVersion)), nil
+		}
+	}
+
+	var stats trino.ClusterStatistics
+	if err := p.getJson(u, "v1/cluster", &stats); err != nil {
+		return healthFromErr(err), nil
+	}
+
+	if int(stats.ActiveWorkers) < p.conf.MinWorkers {
+		return healthFromErr(fmt.Errorf("cluster has %d active workers, at least %d required", stats.ActiveWorkers, p.conf.MinWorkers)), nil
 	}
 
 	return Health{
 		Status:    StatusHealthy,
-		Message:   "all checks passed",
+		Message:   fmt.Sprintf("all checks passed (version %s, %d active workers)", info.NodeVersion.Version, stats.ActiveWorkers),
 		Timestamp: time.Now(),
 	}, nil
 }
+
+func (p *HttpClusterHealth) get(u *url.URL, path string) (*http.Response, error) {
+	endpoint := fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, path)
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating http request: %w", err)
+	}
+
+	req.Header.Set("X-Trino-User", healthCheckUser)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error executing http request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("http request to /%s return %d status code", path, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func (p *HttpClusterHealth) getJson(u *url.URL, path string, target interface{}) error {
+	resp, err := p.get(u, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("error decoding /%s response: %w", path, err)
+	}
+
+	return nil
+}
+
+// parseVersion returns the major trino version, vendor builds add a suffix to the version (eg. 351-e.1)
+func parseVersion(version string) (int, error) {
+	major := version
+	if idx := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' }); idx >= 0 {
+		major = version[:idx]
+	}
+
+	parsed, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cluster version %s", version)
+	}
+
+	return parsed, nil
+}
@@ -130,3 +130,90 @@ func TestHttpClusterHealth_Check_FailOnConnectionHang200OK(t *testing.T) {
 	require.False(t, result.IsAvailable())
 	backendSrv.Close()
 }
+
+func fakeCoordinator(t *testing.T, info string, cluster string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body string
+		switch r.URL.Path {
+		case "/v1/status":
+			body = "{}"
+		case "/v1/info":
+			body = info
+		case "/v1/cluster":
+			body = cluster
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, err := w.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+}
+
+func TestHttpClusterHealth_CheckDetails(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      HttpHealthConf
+		info      string
+		cluster   string
+		available bool
+	}{
+		{
+			name:      "healthy",
+			conf:      HttpHealthConf{MinWorkers: 1},
+			info:      `{"nodeVersion":{"version":"351"},"coordinator":true,"starting":false}`,
+			cluster:   `{"activeWorkers":2}`,
+			available: true,
+		},
+		{
+			name:      "starting",
+			conf:      HttpHealthConf{MinWorkers: 1},
+			info:      `{"nodeVersion":{"version":"351"},"coordinator":true,"starting":true}`,
+			cluster:   `{"activeWorkers":2}`,
+			available: false,
+		},
+		{
+			name:      "no workers",
+			conf:      HttpHealthConf{MinWorkers: 1},
+			info:      `{"nodeVersion":{"version":"351"},"coordinator":true,"starting":false}`,
+			cluster:   `{"activeWorkers":0}`,
+			available: false,
+		},
+		{
+			name:      "version lower than minimum",
+			conf:      HttpHealthConf{MinWorkers: 1, MinVersion: 360},
+			info:      `{"nodeVersion":{"version":"351-e.1"},"coordinator":true,"starting":false}`,
+			cluster:   `{"activeWorkers":2}`,
+			available: false,
+		},
+		{
+			name:      "minimum version",
+			conf:      HttpHealthConf{MinWorkers: 1, MinVersion: 351},
+			info:      `{"nodeVersion":{"version":"351-e.1"},"coordinator":true,"starting":false}`,
+			cluster:   `{"activeWorkers":2}`,
+			available: true,
+		},
+		{
+			name:      "invalid info response",
+			conf:      HttpHealthConf{MinWorkers: 1},
+			info:      `not json`,
+			cluster:   `{"activeWorkers":2}`,
+			available: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeCoordinator(t, tt.info, tt.cluster)
+			defer srv.Close()
+
+			uri, err := url.Parse(srv.URL)
+			require.NoError(t, err)
+
+			result, err := NewHttpHealthWithConf(tt.conf).Check(uri)
+			require.NoError(t, err)
+			require.Equal(t, tt.available, result.IsAvailable(), result.Message)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package healthcheck
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// ThresholdHealthCheck adds hysteresis to a HealthCheck: a cluster changes status only after the configured number
+// of consecutive results with the new status, this avoids flapping clusters on a single failed check.
+// The first check of a cluster is reported as is.
+type ThresholdHealthCheck struct {
+	check            HealthCheck
+	failureThreshold int
+	successThreshold int
+	states           map[string]*thresholdState
+	mutex            *sync.Mutex
+}
+
+type thresholdState struct {
+	current     Health
+	consecutive int
+}
+
+func NewThresholdHealthCheck(check HealthCheck, failureThreshold int, successThreshold int) *ThresholdHealthCheck {
+	return &ThresholdHealthCheck{
+		check:            check,
+		failureThreshold: failureThreshold,
+		successThreshold: successThreshold,
+		states:           make(map[string]*thresholdState),
+		mutex:            &sync.Mutex{},
+	}
+}
+
+func (t *ThresholdHealthCheck) Check(u *url.URL) (Health, error) {
+	result, err := t.check.Check(u)
+	if err != nil {
+		return result, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, present := t.states[u.String()]
+	if !present {
+		t.states[u.String()] = &thresholdState{current: result}
+		return result, nil
+	}
+
+	if result.Status == state.current.Status {
+		state.current = result
+		state.consecutive = 0
+		return result, nil
+	}
+
+	state.consecutive++
+
+	threshold := t.successThreshold
+	if result.Status != StatusHealthy {
+		threshold = t.failureThreshold
+	}
+
+	if state.consecutive >= threshold {
+		state.current = result
+		state.consecutive = 0
+		return result, nil
+	}
+
+	// the status change is not confirmed yet, the previous status is kept
+	held := state.current
+	held.Message = fmt.Sprintf("%s (%d/%d consecutive %s checks: %s)", state.current.Message, state.consecutive, threshold, result.Status.String(), result.Message)
+	held.Timestamp = result.Timestamp
+	return held, nil
+}
+
+func (t *ThresholdHealthCheck) Forget(u *url.URL) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.states, u.String())
+}
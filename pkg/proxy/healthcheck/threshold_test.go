@@ -0,0 +1,77 @@
+package healthcheck
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+type sequenceHealthCheck struct {
+	statuses []HealthStatus
+}
+
+func (s *sequenceHealthCheck) Check(*url.URL) (Health, error) {
+	status := s.statuses[0]
+	s.statuses = s.statuses[1:]
+	return Health{Status: status, Message: status.String()}, nil
+}
+
+func TestThresholdHealthCheck(t *testing.T) {
+	check := NewThresholdHealthCheck(&sequenceHealthCheck{
+		statuses: []HealthStatus{
+			StatusHealthy,
+			StatusUnhealthy, StatusHealthy,
+			StatusUnhealthy, StatusUnhealthy, StatusUnhealthy,
+			StatusHealthy, StatusHealthy,
+		},
+	}, 3, 2)
+
+	expected := []HealthStatus{
+		StatusHealthy,
+		// a single failure doesn't change the status and the counter is reset by the next success
+		StatusHealthy, StatusHealthy,
+		StatusHealthy, StatusHealthy, StatusUnhealthy,
+		StatusUnhealthy, StatusHealthy,
+	}
+
+	uri := tests.MustUrl("http://trino.local:8080")
+	for i, status := range expected {
+		result, err := check.Check(uri)
+		require.NoError(t, err)
+		require.Equal(t, status, result.Status, "check %d: %s", i, result.Message)
+	}
+}
+
+func TestThresholdHealthCheckIsolatesClusters(t *testing.T) {
+	check := NewThresholdHealthCheck(&sequenceHealthCheck{
+		statuses: []HealthStatus{StatusHealthy, StatusUnhealthy},
+	}, 3, 2)
+
+	result, err := check.Check(tests.MustUrl("http://trino-0.local:8080"))
+	require.NoError(t, err)
+	require.Equal(t, StatusHealthy, result.Status)
+
+	// the first check of another cluster is not affected by the thresholds
+	result, err = check.Check(tests.MustUrl("http://trino-1.local:8080"))
+	require.NoError(t, err)
+	require.Equal(t, StatusUnhealthy, result.Status)
+}
+
+func TestThresholdHealthCheckForget(t *testing.T) {
+	check := NewThresholdHealthCheck(&sequenceHealthCheck{
+		statuses: []HealthStatus{StatusHealthy, StatusUnhealthy},
+	}, 3, 2)
+
+	uri := tests.MustUrl("http://trino.local:8080")
+	_, err := check.Check(uri)
+	require.NoError(t, err)
+
+	check.Forget(uri)
+	require.Empty(t, check.states)
+
+	// after forget the next check is reported as the first one
+	result, err := check.Check(uri)
+	require.NoError(t, err)
+	require.Equal(t, StatusUnhealthy, result.Status)
+}
@@ -2,22 +2,58 @@ package healthcheck
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/trinodb/trino-go-client/trino"
 	_ "github.com/trinodb/trino-go-client/trino"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
 	queryDefaultTimeout = 15 * time.Second
+	queryDefaultSql     = "select 1"
+	queryDefaultUser    = "hc"
 )
 
+type TLSConf struct {
+	InsecureSkipVerify bool
+	// CAFile is the pem encoded certificate authority used to verify the coordinator certificate
+	CAFile string
+	// CertFile and KeyFile are the client certificate used for mutual tls authentication
+	CertFile string
+	KeyFile  string
+}
+
+type QueryHealthConf struct {
+	Timeout time.Duration
+	Sql     string
+	User    string
+	// Password enables basic authentication, AccessToken enables bearer (JWT) authentication
+	Password    string
+	AccessToken string
+	Catalog     string
+	Schema      string
+	TLS         TLSConf
+	// Expect is an assertion on the first column of the first row returned by the query
+	// with the format '<operator> <value>' (eg. '>= 3'), when empty any result is accepted
+	Expect string
+}
+
 type TrinoQueryClusterHealth struct {
-	client *http.Client
+	conf       QueryHealthConf
+	client     *http.Client
+	clientName string
+	assertion  *resultAssertion
 }
 
 func NewTrinoQueryHealth() *TrinoQueryClusterHealth {
@@ -25,53 +61,276 @@ func NewTrinoQueryHealth() *TrinoQueryClusterHealth {
 }
 
 func NewTrinoQueryHealthWithTimeout(timeout time.Duration) *TrinoQueryClusterHealth {
-	return &TrinoQueryClusterHealth{
-		client: &http.Client{
-			Timeout: timeout,
-			Transport: &http.Transport{
+	return newTrinoQueryHealth(QueryHealthConf{Timeout: timeout}, &tls.Config{}, nil)
+}
+
+func NewTrinoQueryHealthWithConf(conf QueryHealthConf) (*TrinoQueryClusterHealth, error) {
+	tlsConfig, err := tlsConfigFromConf(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var assertion *resultAssertion
+	if len(strings.TrimSpace(conf.Expect)) != 0 {
+		parsed, err := parseResultAssertion(conf.Expect)
+		if err != nil {
+			return nil, err
+		}
+		assertion = &parsed
+	}
+
+	return newTrinoQueryHealth(conf, tlsConfig, assertion), nil
+}
+
+func newTrinoQueryHealth(conf QueryHealthConf, tlsConfig *tls.Config, assertion *resultAssertion) *TrinoQueryClusterHealth {
+	if conf.Timeout == 0 {
+		conf.Timeout = queryDefaultTimeout
+	}
+
+	if len(conf.Sql) == 0 {
+		conf.Sql = queryDefaultSql
+	}
+
+	if len(conf.User) == 0 {
+		conf.User = queryDefaultUser
+	}
+
+	client := &http.Client{
+		Timeout: conf.Timeout,
+		Transport: authTransport{
+			password:    conf.Password,
+			user:        conf.User,
+			accessToken: conf.AccessToken,
+			transport: &http.Transport{
 				Proxy: http.ProxyFromEnvironment,
 				DialContext: (&net.Dialer{
-					Timeout:   timeout,
-					KeepAlive: timeout,
+					Timeout:   conf.Timeout,
+					KeepAlive: conf.Timeout,
 				}).DialContext,
-				IdleConnTimeout:       timeout,
-				TLSHandshakeTimeout:   timeout,
-				ExpectContinueTimeout: timeout,
+				IdleConnTimeout:       conf.Timeout,
+				TLSHandshakeTimeout:   conf.Timeout,
+				ExpectContinueTimeout: conf.Timeout,
+				TLSClientConfig:       tlsConfig,
 			},
 		},
 	}
-}
 
-func (p *TrinoQueryClusterHealth) Check(u *url.URL) (Health, error) {
-	if err := trino.RegisterCustomClient("hc", p.client); err != nil {
-		return Health{}, err
+	// the client is registered once, the name is unique to avoid conflicts between checks with different configurations.
+	// RegisterCustomClient fails only for names that can be parsed as boolean
+	clientName := fmt.Sprintf("hc-%s", uuid.New().String())
+	_ = trino.RegisterCustomClient(clientName, client)
+
+	return &TrinoQueryClusterHealth{
+		conf:       conf,
+		client:     client,
+		clientName: clientName,
+		assertion:  assertion,
 	}
+}
 
-	urlWithName := fmt.Sprintf("%s://hc@%s?custom_client=hc", u.Scheme, u.Host)
-	db, err := sql.Open("trino", urlWithName)
+func (p *TrinoQueryClusterHealth) Check(u *url.URL) (Health, error) {
+	db, err := sql.Open("trino", p.dsn(u))
 	if err != nil {
 		return healthFromErr(fmt.Errorf("error opening sql connection: %w", err)), nil
 	}
+	defer db.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), p.client.Timeout)
 	defer cancel()
 
-	row, err := db.QueryContext(ctx, "select 1")
+	rows, err := db.QueryContext(ctx, p.conf.Sql)
 	if err != nil {
 		return healthFromErr(fmt.Errorf("error executing query: %w", err)), nil
 	}
 
-	defer row.Close()
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return healthFromErr(fmt.Errorf("error reading query results: %w", err)), nil
+		}
+		return healthFromErr(errors.New("query returned no rows")), nil
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return healthFromErr(fmt.Errorf("error reading query results: %w", err)), nil
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
 
-	row.Next()
-	var r int
-	if err := row.Scan(&r); err != nil {
+	if err := rows.Scan(pointers...); err != nil {
 		return healthFromErr(fmt.Errorf("error reading query results: %w", err)), nil
 	}
 
+	if p.assertion != nil {
+		if len(values) == 0 {
+			return healthFromErr(errors.New("query returned no columns")), nil
+		}
+
+		if err := p.assertion.check(values[0]); err != nil {
+			return healthFromErr(err), nil
+		}
+	}
+
 	return Health{
 		Status:    StatusHealthy,
 		Message:   "all checks passed",
 		Timestamp: time.Now(),
 	}, nil
 }
+
+func (p *TrinoQueryClusterHealth) dsn(u *url.URL) string {
+	query := url.Values{}
+	query.Set("custom_client", p.clientName)
+	query.Set("source", "trino-loadbalancer-hc")
+
+	if len(p.conf.Catalog) != 0 {
+		query.Set("catalog", p.conf.Catalog)
+	}
+
+	if len(p.conf.Schema) != 0 {
+		query.Set("schema", p.conf.Schema)
+	}
+
+	dsn := url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		User:     url.User(p.conf.User),
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String()
+}
+
+// authTransport adds the credentials to every request, the trino driver sends the password only over https
+// and doesn't support bearer authentication
+type authTransport struct {
+	user        string
+	password    string
+	accessToken string
+	transport   http.RoundTripper
+}
+
+func (a authTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if len(a.accessToken) == 0 && len(a.password) == 0 {
+		return a.transport.RoundTrip(request)
+	}
+
+	request = request.Clone(request.Context())
+	if len(a.accessToken) != 0 {
+		request.Header.Set("Authorization", "Bearer "+a.accessToken)
+	} else {
+		request.SetBasicAuth(a.user, a.password)
+	}
+
+	return a.transport.RoundTrip(request)
+}
+
+func tlsConfigFromConf(conf TLSConf) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+
+	if len(conf.CAFile) != 0 {
+		ca, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificates in ca file %s", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(conf.CertFile) != 0 || len(conf.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+type resultAssertion struct {
+	operator string
+	value    string
+}
+
+var assertionOperators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+func parseResultAssertion(raw string) (resultAssertion, error) {
+	raw = strings.TrimSpace(raw)
+	for _, op := range assertionOperators {
+		if strings.HasPrefix(raw, op) {
+			value := strings.TrimSpace(strings.TrimPrefix(raw, op))
+			if len(value) == 0 {
+				return resultAssertion{}, fmt.Errorf("invalid result assertion %s: missing value", raw)
+			}
+
+			if op == "=" {
+				op = "=="
+			}
+
+			if op != "==" && op != "!=" {
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					return resultAssertion{}, fmt.Errorf("invalid result assertion %s: %s requires a numeric value", raw, op)
+				}
+			}
+
+			return resultAssertion{operator: op, value: value}, nil
+		}
+	}
+
+	return resultAssertion{}, fmt.Errorf("invalid result assertion %s: unknown operator", raw)
+}
+
+// check compares the result numerically when both values are numbers, otherwise only the equality
+// operators are supported and the string representations are compared
+func (a resultAssertion) check(result interface{}) error {
+	actual := fmt.Sprintf("%v", result)
+
+	actualNumber, actualErr := strconv.ParseFloat(actual, 64)
+	expectedNumber, expectedErr := strconv.ParseFloat(a.value, 64)
+
+	var ok bool
+	if actualErr == nil && expectedErr == nil {
+		switch a.operator {
+		case "==":
+			ok = actualNumber == expectedNumber
+		case "!=":
+			ok = actualNumber != expectedNumber
+		case ">=":
+			ok = actualNumber >= expectedNumber
+		case "<=":
+			ok = actualNumber <= expectedNumber
+		case ">":
+			ok = actualNumber > expectedNumber
+		case "<":
+			ok = actualNumber < expectedNumber
+		}
+	} else {
+		switch a.operator {
+		case "==":
+			ok = actual == a.value
+		case "!=":
+			ok = actual != a.value
+		default:
+			return fmt.Errorf("query result %s is not a number", actual)
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("query result %s doesn't satisfy the assertion %s %s", actual, a.operator, a.value)
+	}
+
+	return nil
+}
@@ -89,3 +89,117 @@ func TestTrinoClusterHealth_Check_FailOnConnectionHang(t *testing.T) {
 	require.False(t, result.IsAvailable())
 	backendSrv.Close()
 }
+
+// fakeTrinoStatementServer answers to every query with a single bigint value
+func fakeTrinoStatementServer(t *testing.T, value int, requests chan<- *http.Request) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			requests <- r.Clone(context.Background())
+		}
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/statement":
+			_, err := fmt.Fprintf(w, `{"id":"q1","nextUri":"%s/v1/statement/executing/q1/1","stats":{"state":"QUEUED"}}`, srv.URL)
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/statement/executing/q1/1":
+			_, err := fmt.Fprintf(w, `{"id":"q1","columns":[{"name":"_col0","type":"bigint","typeSignature":{"rawType":"bigint","arguments":[]}}],"data":[[%d]],"stats":{"state":"FINISHED"}}`, value)
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return srv
+}
+
+func TestTrinoClusterHealth_CheckWithConf(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	srv := fakeTrinoStatementServer(t, 3, requests)
+	defer srv.Close()
+
+	check, err := NewTrinoQueryHealthWithConf(QueryHealthConf{
+		Sql:         "SELECT count(*) FROM system.runtime.nodes",
+		User:        "lb",
+		AccessToken: "token",
+		Catalog:     "system",
+		Schema:      "runtime",
+		Expect:      ">= 3",
+	})
+	require.NoError(t, err)
+
+	result, err := check.Check(tests.MustUrl(srv.URL))
+	require.NoError(t, err)
+	require.True(t, result.IsAvailable(), result.Message)
+
+	submission := <-requests
+	require.Equal(t, "lb", submission.Header.Get("X-Trino-User"))
+	require.Equal(t, "Bearer token", submission.Header.Get("Authorization"))
+	require.Equal(t, "system", submission.Header.Get("X-Trino-Catalog"))
+	require.Equal(t, "runtime", submission.Header.Get("X-Trino-Schema"))
+}
+
+func TestTrinoClusterHealth_CheckBasicAuth(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	srv := fakeTrinoStatementServer(t, 1, requests)
+	defer srv.Close()
+
+	check, err := NewTrinoQueryHealthWithConf(QueryHealthConf{
+		User:     "lb",
+		Password: "secret",
+	})
+	require.NoError(t, err)
+
+	result, err := check.Check(tests.MustUrl(srv.URL))
+	require.NoError(t, err)
+	require.True(t, result.IsAvailable(), result.Message)
+
+	user, password, ok := (<-requests).BasicAuth()
+	require.True(t, ok)
+	require.Equal(t, "lb", user)
+	require.Equal(t, "secret", password)
+}
+
+func TestTrinoClusterHealth_CheckAssertionFailed(t *testing.T) {
+	srv := fakeTrinoStatementServer(t, 1, nil)
+	defer srv.Close()
+
+	check, err := NewTrinoQueryHealthWithConf(QueryHealthConf{
+		Sql:    "SELECT count(*) FROM system.runtime.nodes",
+		Expect: ">= 2",
+	})
+	require.NoError(t, err)
+
+	result, err := check.Check(tests.MustUrl(srv.URL))
+	require.NoError(t, err)
+	require.False(t, result.IsAvailable())
+}
+
+func TestResultAssertion(t *testing.T) {
+	tests := []struct {
+		expect string
+		value  interface{}
+		valid  bool
+	}{
+		{expect: ">= 2", value: int64(2), valid: true},
+		{expect: ">2", value: int64(2), valid: false},
+		{expect: "< 2.5", value: 2.4, valid: true},
+		{expect: "<= 1", value: int64(3), valid: false},
+		{expect: "== 1", value: "1", valid: true},
+		{expect: "= active", value: "active", valid: true},
+		{expect: "!= active", value: "active", valid: false},
+		{expect: ">= 1", value: "active", valid: false},
+	}
+
+	for _, tt := range tests {
+		assertion, err := parseResultAssertion(tt.expect)
+		require.NoError(t, err)
+		require.Equal(t, tt.valid, assertion.check(tt.value) == nil, "%s %v", tt.expect, tt.value)
+	}
+}
+
+func TestResultAssertionInvalid(t *testing.T) {
+	for _, expect := range []string{"2", ">=", "> two", "~ 2"} {
+		_, err := parseResultAssertion(expect)
+		require.Error(t, err, expect)
+	}
+}
@@ -1,9 +1,19 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
+)
+
+var (
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
 )
 
 type Interceptor interface {
@@ -31,6 +41,12 @@ type HttpProxy interface {
 	Handle(http.ResponseWriter, *http.Request) error
 }
 
+// Observer is notified about every request sent to the upstream with the response or the transport error and
+// the time elapsed until the response headers have been received
+type Observer interface {
+	Observe(request *http.Request, response *http.Response, err error, latency time.Duration)
+}
+
 type ReverseProxy struct {
 	proxy *httputil.ReverseProxy
 }
@@ -39,18 +55,107 @@ func NewReverseProxy(target *url.URL, interceptor Interceptor) *ReverseProxy {
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
 	proxy.ModifyResponse = func(response *http.Response) error {
+		if retryStateFromRequest(response.Request) != nil && isUnavailableStatus(response.StatusCode) {
+			return unavailableStatusError{statusCode: response.StatusCode}
+		}
+
 		if interceptor == nil {
 			return nil
 		}
 		return interceptor.Handle(response.Request, response)
 	}
 
+	proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+		if state := retryStateFromRequest(request); state != nil && isRetryableError(err) {
+			// the response is not written so the caller can retry the request on another upstream
+			state.err = err
+			return
+		}
+
+		log.Printf("http: proxy error: %v", err)
+		writer.WriteHeader(http.StatusBadGateway)
+	}
+
 	return &ReverseProxy{
 		proxy: proxy,
 	}
 }
 
+// WithObserver registers an Observer notified about every round trip to the upstream
+func (r *ReverseProxy) WithObserver(observer Observer) *ReverseProxy {
+	transport := r.proxy.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r.proxy.Transport = observedTransport{
+		transport: transport,
+		observer:  observer,
+	}
+	return r
+}
+
+type observedTransport struct {
+	transport http.RoundTripper
+	observer  Observer
+}
+
+func (o observedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := o.transport.RoundTrip(request)
+	o.observer.Observe(request, response, err, time.Since(start))
+	return response, err
+}
+
+// Handle proxies the request to the upstream, if the request has been marked with WithRetry and the upstream is
+// unavailable nothing is written to the ResponseWriter and an error wrapping ErrUpstreamUnavailable is returned
 func (r ReverseProxy) Handle(w http.ResponseWriter, req *http.Request) error {
 	r.proxy.ServeHTTP(w, req)
+
+	if state := retryStateFromRequest(req); state != nil && state.err != nil {
+		return fmt.Errorf("%w: %s", ErrUpstreamUnavailable, state.err.Error())
+	}
+
 	return nil
 }
+
+type retryContextKey struct{}
+
+type retryState struct {
+	err error
+}
+
+// WithRetry marks the request as retryable: connection failures and 502, 503, 504 responses
+// are not written to the client, leaving the caller the possibility to send the request to another upstream
+func WithRetry(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), retryContextKey{}, &retryState{}))
+}
+
+func retryStateFromRequest(req *http.Request) *retryState {
+	state, _ := req.Context().Value(retryContextKey{}).(*retryState)
+	return state
+}
+
+type unavailableStatusError struct {
+	statusCode int
+}
+
+func (u unavailableStatusError) Error() string {
+	return fmt.Sprintf("upstream returned %d status code", u.statusCode)
+}
+
+func isUnavailableStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+}
+
+// isRetryableError returns true only for errors that guarantee that the request has not been processed
+// by the upstream, this avoids submitting the same query twice
+func isRetryableError(err error) bool {
+	var statusErr unavailableStatusError
+	if errors.As(err, &statusErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
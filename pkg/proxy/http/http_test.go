@@ -72,3 +72,51 @@ func TestHttpProxyWithInterceptor(t *testing.T) {
 	require.Equal(t, http.StatusAccepted, resp.StatusCode)
 	require.Equal(t, 1, interceptor.calls)
 }
+
+func TestHttpProxyRetryableUnavailableStatus(t *testing.T) {
+	interceptor := newTestableInterceptor()
+
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backendSrv.Close()
+
+	uri, err := url.Parse(backendSrv.URL)
+	require.NoError(t, err)
+
+	proxy := NewReverseProxy(uri, interceptor)
+
+	rr := httptest.NewRecorder()
+	err = proxy.Handle(rr, WithRetry(httptest.NewRequest(http.MethodPost, "http://localhost/v1/statement", nil)))
+	require.ErrorIs(t, err, ErrUpstreamUnavailable)
+	require.False(t, rr.Flushed)
+	require.Empty(t, rr.Body.Bytes())
+	require.Equal(t, 0, interceptor.calls)
+
+	// requests not marked as retryable receive the upstream response
+	rr = httptest.NewRecorder()
+	err = proxy.Handle(rr, httptest.NewRequest(http.MethodPost, "http://localhost/v1/statement", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, 1, interceptor.calls)
+}
+
+func TestHttpProxyRetryableConnectionRefused(t *testing.T) {
+	backendSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	uri, err := url.Parse(backendSrv.URL)
+	require.NoError(t, err)
+	backendSrv.Close()
+
+	proxy := NewReverseProxy(uri, nil)
+
+	rr := httptest.NewRecorder()
+	err = proxy.Handle(rr, WithRetry(httptest.NewRequest(http.MethodPost, "http://localhost/v1/statement", nil)))
+	require.ErrorIs(t, err, ErrUpstreamUnavailable)
+
+	rr = httptest.NewRecorder()
+	err = proxy.Handle(rr, httptest.NewRequest(http.MethodPost, "http://localhost/v1/statement", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, rr.Code)
+}
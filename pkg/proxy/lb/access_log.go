@@ -0,0 +1,154 @@
+package lb
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/accesslog"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	TrinoHeaderSource     = "X-Trino-Source"
+	TrinoHeaderClientTags = "X-Trino-Client-Tags"
+)
+
+// TrinoQueryStatusCanceled is the final state reported for queries cancelled by the client, the coordinator
+// doesn't return the query state after a cancellation
+const TrinoQueryStatusCanceled = "CANCELED"
+
+type AccessLogConf struct {
+	Enabled bool
+	// CaptureQuery adds the statement text to the entries, RedactQuery removes the literals from the text
+	CaptureQuery   bool
+	RedactQuery    bool
+	MaxQueryLength int
+}
+
+// QueryAccessLog writes an entry to the sink when a query reaches its final state. It's a listener of the
+// QueryTracker, the queries abandoned by the clients are not logged
+type QueryAccessLog struct {
+	conf   AccessLogConf
+	sink   accesslog.Sink
+	logger logging.Logger
+	now    func() time.Time
+}
+
+func NewQueryAccessLog(conf AccessLogConf, sink accesslog.Sink, logger logging.Logger) *QueryAccessLog {
+	return &QueryAccessLog{
+		conf:   conf,
+		sink:   sink,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+func (a *QueryAccessLog) Close() error {
+	return a.sink.Close()
+}
+
+// QueryCompleted writes the access log entry for the query, queries submitted through another proxy instance
+// are logged with the information available in the requests received
+func (a *QueryAccessLog) QueryCompleted(query TrackedQuery, state trino.QueryState, finalState string) {
+	now := a.now()
+
+	entry := accesslog.Entry{
+		QueryID:       query.QueryID,
+		TransactionID: query.TransactionID,
+		User:          query.User,
+		Source:        query.Source,
+		ClientTags:    query.ClientTags,
+		Coordinator:   query.Coordinator,
+		RoutingRule:   query.RoutingRule,
+		UserRule:      query.UserRule,
+		SubmittedAt:   query.SubmittedAt,
+		CompletedAt:   now,
+		State:         finalState,
+		BytesIn:       query.BytesIn,
+		BytesOut:      query.BytesOut,
+	}
+
+	if a.conf.CaptureQuery && len(query.query) != 0 {
+		entry.Query = a.formatQuery(query.query)
+	}
+
+	if !query.SubmittedAt.IsZero() {
+		entry.DurationMillis = now.Sub(query.SubmittedAt).Milliseconds()
+	}
+
+	if state.Error != nil {
+		entry.ErrorName = state.Error.ErrorName
+	}
+
+	if err := a.sink.Write(entry); err != nil {
+		a.logger.Error("error writing access log entry for query %s: %s", query.QueryID, err.Error())
+	}
+}
+
+func (a *QueryAccessLog) formatQuery(query string) string {
+	if a.conf.RedactQuery {
+		query = accesslog.RedactQuery(query)
+	}
+	return accesslog.TruncateQuery(query, a.conf.MaxQueryLength)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	read    int64
+	closed  bool
+	onClose func(read int64)
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+func (c *countingBody) Close() error {
+	err := c.ReadCloser.Close()
+	if !c.closed {
+		c.closed = true
+		c.onClose(c.read)
+	}
+	return err
+}
+
+func clientTagsFromRequest(request *http.Request) []string {
+	raw := request.Header.Get(TrinoHeaderClientTags)
+	if len(raw) == 0 {
+		return nil
+	}
+
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) != 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+type requestTraceContextKey struct{}
+
+// requestTrace collects the information produced while a request is handled by the proxy that are
+// needed by the interceptors of the response
+type requestTrace struct {
+	rule     string
+	userRule string
+	query    string
+	route    string
+}
+
+func withRequestTrace(request *http.Request) (*http.Request, *requestTrace) {
+	trace := &requestTrace{}
+	return request.WithContext(context.WithValue(request.Context(), requestTraceContextKey{}, trace)), trace
+}
+
+func requestTraceFromContext(ctx context.Context) *requestTrace {
+	trace, _ := ctx.Value(requestTraceContextKey{}).(*requestTrace)
+	return trace
+}
@@ -0,0 +1,181 @@
+package lb
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/accesslog"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memorySink struct {
+	entries []accesslog.Entry
+	mutex   sync.Mutex
+}
+
+func (m *memorySink) Write(entry accesslog.Entry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *memorySink) Close() error {
+	return nil
+}
+
+func (m *memorySink) Entries() []accesslog.Entry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]accesslog.Entry{}, m.entries...)
+}
+
+const accessLogQueryID = "20200924_102554_02623_yi2gi"
+
+func fakeStatementCoordinator(t *testing.T, finalState string) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body string
+		switch {
+		case request.Method == http.MethodPost:
+			body = `{"id":"` + accessLogQueryID + `","nextUri":"` + srv.URL + `/v1/statement/executing/` + accessLogQueryID + `/y1/1","stats":{"state":"QUEUED"}}`
+		case request.Method == http.MethodDelete:
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			body = `{"id":"` + accessLogQueryID + `","stats":{"state":"` + finalState + `"},"error":{"errorName":"SYNTAX_ERROR"}}`
+		}
+
+		writer.WriteHeader(http.StatusOK)
+		_, err := writer.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	return srv
+}
+
+func accessLogProxy(t *testing.T, coordinatorURL string, conf AccessLogConf, sink accesslog.Sink) *Proxy {
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+
+	tracker := NewQueryTracker(QueryTrackerConf{AbandonTimeout: time.Hour}, sessStore, logger).
+		WithListener(NewQueryAccessLog(conf, sink, logger))
+	pool := NewPool(PoolConfigTest(), sessStore, healthcheck.NoOp(), trino.Noop(), logger).WithQueryTracker(tracker)
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(coordinatorURL), Enabled: true}))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), routing.RoundRobin())
+
+	proxyConf := ProxyConf{
+		SyncDelay:    time.Hour,
+		CaptureQuery: conf.CaptureQuery,
+	}
+
+	return NewProxy(proxyConf, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+}
+
+func doRequest(t *testing.T, method string, url string, body string, headers map[string]string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+}
+
+func TestAccessLogQueryLifecycle(t *testing.T) {
+	coordinator := fakeStatementCoordinator(t, "FAILED")
+	defer coordinator.Close()
+
+	sink := &memorySink{}
+	proxy := accessLogProxy(t, coordinator.URL, AccessLogConf{
+		Enabled:      true,
+		CaptureQuery: true,
+		RedactQuery:  true,
+	}, sink)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	headers := map[string]string{
+		TrinoHeaderUser:       "user-0",
+		TrinoHeaderSource:     "trino-cli",
+		TrinoHeaderClientTags: "etl, daily",
+	}
+
+	doRequest(t, http.MethodPost, srv.URL+"/v1/statement", "select * from t where id = 10", headers)
+	require.Empty(t, sink.Entries())
+
+	doRequest(t, http.MethodGet, srv.URL+"/v1/statement/executing/"+accessLogQueryID+"/y1/1", "", headers)
+
+	entries := sink.Entries()
+	require.Len(t, entries, 1)
+
+	entry := entries[0]
+	require.Equal(t, accessLogQueryID, entry.QueryID)
+	require.Equal(t, TrinoDefaultTransactionID, entry.TransactionID)
+	require.Equal(t, "user-0", entry.User)
+	require.Equal(t, "trino-cli", entry.Source)
+	require.Equal(t, []string{"etl", "daily"}, entry.ClientTags)
+	require.Equal(t, "cluster-0", entry.Coordinator)
+	require.Equal(t, "round-robin", entry.RoutingRule)
+	require.Equal(t, routing.UserRuleNone, entry.UserRule)
+	require.Equal(t, "FAILED", entry.State)
+	require.Equal(t, "SYNTAX_ERROR", entry.ErrorName)
+	require.Equal(t, "select * from t where id = ?", entry.Query)
+	require.False(t, entry.SubmittedAt.IsZero())
+	require.False(t, entry.CompletedAt.Before(entry.SubmittedAt))
+	require.Equal(t, int64(len("select * from t where id = 10")), entry.BytesIn)
+	require.Greater(t, entry.BytesOut, int64(0))
+}
+
+func TestAccessLogQueryCancelled(t *testing.T) {
+	coordinator := fakeStatementCoordinator(t, "FINISHED")
+	defer coordinator.Close()
+
+	sink := &memorySink{}
+	proxy := accessLogProxy(t, coordinator.URL, AccessLogConf{Enabled: true}, sink)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	doRequest(t, http.MethodPost, srv.URL+"/v1/statement", "select 1", nil)
+	doRequest(t, http.MethodDelete, srv.URL+"/v1/statement/executing/"+accessLogQueryID+"/y1/1", "", nil)
+
+	entries := sink.Entries()
+	require.Len(t, entries, 1)
+	require.Equal(t, TrinoQueryStatusCanceled, entries[0].State)
+	// the query text is not captured by default
+	require.Empty(t, entries[0].Query)
+}
+
+func TestAccessLogSkipsAbandonedQueries(t *testing.T) {
+	sink := &memorySink{}
+	tracker, _, now := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	tracker.WithListener(NewQueryAccessLog(AccessLogConf{Enabled: true}, sink, logging.Noop()))
+	interceptor := tracker.Interceptor("cluster-0")
+
+	response := statementResponse("QUEUED", true, 0)
+	require.NoError(t, interceptor.Handle(submissionRequest(), response))
+	require.NoError(t, response.Body.Close())
+
+	*now = now.Add(2 * time.Minute)
+	tracker.sweep(context.TODO())
+
+	require.Empty(t, tracker.Queries())
+	require.Empty(t, sink.Entries())
+}
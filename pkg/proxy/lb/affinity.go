@@ -0,0 +1,106 @@
+package lb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AffinityQueryParam is the query string parameter added to the uris returned to the clients that
+// contains the signed name of the coordinator running the query
+const AffinityQueryParam = "lb_affinity"
+
+var (
+	ErrInvalidAffinityToken = errors.New("invalid affinity token")
+)
+
+type AffinityConf struct {
+	Enabled bool
+	Secret  string
+	// SessionLinks keeps writing the query links to the session store with the affinity enabled, they are
+	// needed only by the requests without a token like the ones built by the clients from the query id
+	SessionLinks bool
+}
+
+// linksSessions is true when the query links must be written to the session store
+func (c AffinityConf) linksSessions() bool {
+	return !c.Enabled || c.SessionLinks
+}
+
+// AffinitySigner creates and verifies tokens that bind a query to the coordinator running it, the token
+// is signed with a shared secret so every proxy replica is able to route follow-up requests without reading
+// the session storage
+type AffinitySigner struct {
+	secret []byte
+}
+
+func NewAffinitySigner(secret string) AffinitySigner {
+	return AffinitySigner{
+		secret: []byte(secret),
+	}
+}
+
+func (a AffinitySigner) Sign(queryID string, coordinator string) string {
+	name := base64.RawURLEncoding.EncodeToString([]byte(coordinator))
+	signature := base64.RawURLEncoding.EncodeToString(a.mac(queryID, coordinator))
+	return name + "." + signature
+}
+
+func (a AffinitySigner) Verify(queryID string, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidAffinityToken
+	}
+
+	coordinator, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidAffinityToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrInvalidAffinityToken
+	}
+
+	if !hmac.Equal(signature, a.mac(queryID, string(coordinator))) {
+		return "", ErrInvalidAffinityToken
+	}
+
+	return string(coordinator), nil
+}
+
+func (a AffinitySigner) mac(queryID string, coordinator string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(queryID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(coordinator))
+	return mac.Sum(nil)
+}
+
+func withAffinityToken(uri *url.URL, token string) *url.URL {
+	withToken := *uri
+	query := withToken.Query()
+	query.Set(AffinityQueryParam, token)
+	withToken.RawQuery = query.Encode()
+	return &withToken
+}
+
+func affinityToken(req *http.Request) string {
+	return req.URL.Query().Get(AffinityQueryParam)
+}
+
+// removeAffinityToken removes the affinity token from the request, the parameter is meaningful only for
+// the load balancer and must not be forwarded to the coordinator
+func removeAffinityToken(req *http.Request) {
+	query := req.URL.Query()
+	if _, present := query[AffinityQueryParam]; !present {
+		return
+	}
+
+	query.Del(AffinityQueryParam)
+	req.URL.RawQuery = query.Encode()
+}
@@ -0,0 +1,54 @@
+package lb
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestAffinitySignAndVerify(t *testing.T) {
+	signer := NewAffinitySigner("secret")
+
+	token := signer.Sign("20200924_102554_02623_yi2gi", "cluster-0")
+
+	coordinator, err := signer.Verify("20200924_102554_02623_yi2gi", token)
+	require.NoError(t, err)
+	require.Equal(t, "cluster-0", coordinator)
+}
+
+func TestAffinityVerifyInvalidToken(t *testing.T) {
+	signer := NewAffinitySigner("secret")
+
+	token := signer.Sign("20200924_102554_02623_yi2gi", "cluster-0")
+
+	// token issued for another query
+	_, err := signer.Verify("20200924_102554_02624_yi2gi", token)
+	require.ErrorIs(t, err, ErrInvalidAffinityToken)
+
+	// token signed with another secret
+	_, err = NewAffinitySigner("other").Verify("20200924_102554_02623_yi2gi", token)
+	require.ErrorIs(t, err, ErrInvalidAffinityToken)
+
+	// token with tampered coordinator
+	forged := NewAffinitySigner("secret").Sign("20200924_102554_02623_yi2gi", "cluster-1")
+	_, err = signer.Verify("20200924_102554_02623_yi2gi", forged[:len("Y2x1c3Rlci0x")]+token[len("Y2x1c3Rlci0w"):])
+	require.ErrorIs(t, err, ErrInvalidAffinityToken)
+
+	for _, malformed := range []string{"", "abc", "a.b.c", "!!.!!"} {
+		_, err = signer.Verify("20200924_102554_02623_yi2gi", malformed)
+		require.ErrorIs(t, err, ErrInvalidAffinityToken)
+	}
+}
+
+func TestRemoveAffinityToken(t *testing.T) {
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    mustUrl("http://trino.local/v1/statement/executing/20200924_102554_02623_yi2gi/y1/1?lb_affinity=token&other=value"),
+	}
+
+	require.Equal(t, "token", affinityToken(req))
+
+	removeAffinityToken(req)
+	require.Equal(t, "other=value", req.URL.RawQuery)
+	require.Empty(t, affinityToken(req))
+}
@@ -2,12 +2,16 @@ package lb
 
 import (
 	"context"
+	"errors"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/discovery"
 	"sync"
+	"time"
 )
 
+const watchRetryDelay = 5 * time.Second
+
 type PoolSync interface {
 	Sync(pool TrinoPool) error
 }
@@ -80,6 +84,81 @@ func (p *PoolStateSync) Sync(pool TrinoPool) error {
 	return nil
 }
 
+// SyncCluster applies the state of a single cluster from the storage to the pool
+func (p *PoolStateSync) SyncCluster(pool TrinoPool, name string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	current := pool.Fetch(FetchRequest{Name: name})
+
+	expected, err := p.storage.Get(context.Background(), name)
+	if errors.Is(err, discovery.ErrClusterNotFound) {
+		for _, removed := range current {
+			p.logger.Info("cluster %s removed from the pool", name)
+			if err := pool.Remove(removed.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(current) == 0 {
+		p.logger.Info("cluster %s added to the pool", name)
+		return pool.Add(expected)
+	}
+
+	for _, c := range current {
+		if c.Enabled != expected.Enabled {
+			p.logger.Info("cluster %s status: %t", name, expected.Enabled)
+		}
+
+		if err := pool.Update(c.ID, expected); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Watch applies the cluster changes published on events until the context is done. The whole state is synced
+// on every subscription because the events published while not subscribed are lost
+func (p *PoolStateSync) Watch(ctx context.Context, pool TrinoPool, events discovery.Events) {
+	for {
+		changes, err := events.Subscribe(ctx)
+		if err != nil {
+			p.logger.Warn("error subscribing to cluster events: %s", err.Error())
+		} else {
+			if err := p.Sync(pool); err != nil {
+				p.logger.Error("error syncing state: %s", err.Error())
+			}
+
+			for event := range changes {
+				if err := p.apply(pool, event); err != nil {
+					p.logger.Error("error applying %s event for cluster %s: %s", event.Type, event.Cluster, err.Error())
+				}
+			}
+		}
+
+		select {
+		case <-time.After(watchRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *PoolStateSync) apply(pool TrinoPool, event discovery.ChangeEvent) error {
+	if event.Type == discovery.ClusterResync || len(event.Cluster) == 0 {
+		return p.Sync(pool)
+	}
+
+	return p.SyncCluster(pool, event.Cluster)
+}
+
 func getSyncAction(current []CoordinatorRef, state []models.Coordinator) syncAction {
 	toAdd := make([]models.Coordinator, 0)
 	toRemove := make([]CoordinatorRef, 0)
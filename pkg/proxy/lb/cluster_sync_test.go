@@ -9,6 +9,7 @@ import (
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestSyncPoolStatus_AddMissingFromState(t *testing.T) {
@@ -181,3 +182,77 @@ func TestSyncPoolStatus_UpdateEnabledStatus(t *testing.T) {
 	require.Equal(t, coord0FromPool[0].Coordinator, coord0)
 
 }
+
+func TestSyncCluster(t *testing.T) {
+	ctx := context.Background()
+
+	pool := NewMockPool()
+	storage := discovery.NewMemoryStorage()
+	sync := NewPoolStateSync(storage, logging.Noop())
+
+	coord := models.Coordinator{
+		Name:    "test-0",
+		URL:     tests.MustUrl("http://trino.local:8889"),
+		Enabled: true,
+		Tags: map[string]string{
+			"test": "asd",
+		},
+	}
+
+	require.NoError(t, storage.Add(ctx, coord))
+	require.NoError(t, sync.SyncCluster(pool, coord.Name))
+	require.Len(t, pool.Fetch(FetchRequest{}), 1)
+
+	disabled := false
+	require.NoError(t, storage.Update(ctx, coord.Name, discovery.UpdateRequest{Enabled: &disabled}))
+	require.NoError(t, sync.SyncCluster(pool, coord.Name))
+
+	backends := pool.Fetch(FetchRequest{Name: coord.Name})
+	require.Len(t, backends, 1)
+	require.False(t, backends[0].Enabled)
+
+	require.NoError(t, storage.Remove(ctx, coord.Name))
+	require.NoError(t, sync.SyncCluster(pool, coord.Name))
+	require.Len(t, pool.Fetch(FetchRequest{}), 0)
+
+	// unknown clusters are ignored
+	require.NoError(t, sync.SyncCluster(pool, "not-existing"))
+}
+
+func TestSyncPoolStatus_WatchEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := NewMockPool()
+	events := discovery.NewMemoryEvents()
+	storage := discovery.NewNotifyingStorage(discovery.NewMemoryStorage(), events, logging.Noop())
+	sync := NewPoolStateSync(storage, logging.Noop())
+
+	coord := models.Coordinator{
+		Name:    "test-0",
+		URL:     tests.MustUrl("http://trino.local:8889"),
+		Enabled: true,
+		Tags:    map[string]string{},
+	}
+
+	require.NoError(t, storage.Add(ctx, coord))
+
+	go sync.Watch(ctx, pool, events)
+
+	// the full sync runs after the subscription, the next changes are received as events
+	require.Eventually(t, func() bool {
+		return len(pool.Fetch(FetchRequest{Name: coord.Name})) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	disabled := false
+	require.NoError(t, storage.Update(ctx, coord.Name, discovery.UpdateRequest{Enabled: &disabled}))
+	require.Eventually(t, func() bool {
+		backends := pool.Fetch(FetchRequest{Name: coord.Name})
+		return len(backends) == 1 && !backends[0].Enabled
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, storage.Remove(ctx, coord.Name))
+	require.Eventually(t, func() bool {
+		return len(pool.Fetch(FetchRequest{})) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package lb
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyDecay is the decay of the latency moving average used when the pool has none configured
+const DefaultLatencyDecay = 10 * time.Second
+
+// connectionLoad tracks the requests in flight to a coordinator and the exponentially weighted moving average
+// of their latency. The weight of the past latency decays with the time elapsed since the previous observation,
+// so after a quiet period the next observation counts as much as the whole history
+type connectionLoad struct {
+	inFlight int64
+	decay    time.Duration
+	now      func() time.Time
+
+	mutex      *sync.Mutex
+	latency    float64
+	lastUpdate time.Time
+}
+
+func newConnectionLoad(decay time.Duration) *connectionLoad {
+	if decay <= 0 {
+		decay = DefaultLatencyDecay
+	}
+
+	return &connectionLoad{
+		decay: decay,
+		now:   time.Now,
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (c *connectionLoad) begin() {
+	atomic.AddInt64(&c.inFlight, 1)
+}
+
+func (c *connectionLoad) end() {
+	atomic.AddInt64(&c.inFlight, -1)
+}
+
+func (c *connectionLoad) Observe(request *http.Request, response *http.Response, err error, latency time.Duration) {
+	// the client went away, the latency doesn't tell anything about the coordinator
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	c.record(latency)
+}
+
+func (c *connectionLoad) record(latency time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if c.lastUpdate.IsZero() {
+		c.latency = float64(latency)
+		c.lastUpdate = now
+		return
+	}
+
+	weight := math.Exp(-float64(now.Sub(c.lastUpdate)) / float64(c.decay))
+	c.latency = c.latency*weight + float64(latency)*(1-weight)
+	c.lastUpdate = now
+}
+
+// State returns the current load, the latency is zero until the first response
+func (c *connectionLoad) State() routing.ConnectionLoad {
+	c.mutex.Lock()
+	latency := c.latency
+	c.mutex.Unlock()
+
+	return routing.ConnectionLoad{
+		InFlight: atomic.LoadInt64(&c.inFlight),
+		Latency:  time.Duration(latency),
+	}
+}
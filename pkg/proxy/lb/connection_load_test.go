@@ -0,0 +1,77 @@
+package lb
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnectionLoadLatency(t *testing.T) {
+	now := time.Now()
+	load := newConnectionLoad(10 * time.Second)
+	load.now = func() time.Time { return now }
+
+	require.Equal(t, time.Duration(0), load.State().Latency)
+
+	// the first observation is the average
+	load.record(100 * time.Millisecond)
+	require.Equal(t, 100*time.Millisecond, load.State().Latency)
+
+	// observations close in time move the average slowly
+	now = now.Add(10 * time.Millisecond)
+	load.record(time.Second)
+	latency := load.State().Latency
+	require.Greater(t, int64(latency), int64(100*time.Millisecond))
+	require.Less(t, int64(latency), int64(110*time.Millisecond))
+
+	// after a long pause the history has no weight
+	now = now.Add(10 * time.Minute)
+	load.record(20 * time.Millisecond)
+	require.InDelta(t, float64(20*time.Millisecond), float64(load.State().Latency), float64(time.Microsecond))
+
+	// the canceled requests are not observed
+	load.Observe(nil, nil, context.Canceled, time.Minute)
+	require.InDelta(t, float64(20*time.Millisecond), float64(load.State().Latency), float64(time.Microsecond))
+}
+
+func TestPoolConnectionLoad(t *testing.T) {
+	release := make(chan bool)
+	started := make(chan bool)
+	coordinator := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		started <- true
+		<-release
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer coordinator.Close()
+
+	hc := healthcheck.Mock(healthcheck.Health{Status: healthcheck.StatusHealthy, Timestamp: time.Now()}, nil)
+	pool := NewPool(PoolConfigTest(), session.NewMemoryStorage(), hc, trino.Noop(), logging.Noop())
+	require.NoError(t, pool.Add(models.Coordinator{Name: "coord-0", URL: mustUrl(coordinator.URL), Enabled: true}))
+
+	ref := pool.Fetch(FetchRequest{})[0]
+	require.Equal(t, int64(0), ref.Load.InFlight)
+
+	done := make(chan error)
+	go func() {
+		recorder := httptest.NewRecorder()
+		done <- pool.Handle(ref, recorder, httptest.NewRequest(http.MethodGet, "/v1/info", nil))
+	}()
+
+	<-started
+	require.Equal(t, int64(1), pool.Fetch(FetchRequest{})[0].Load.InFlight)
+
+	release <- true
+	require.NoError(t, <-done)
+
+	load := pool.Fetch(FetchRequest{})[0].Load
+	require.Equal(t, int64(0), load.InFlight)
+	require.Greater(t, int64(load.Latency), int64(0))
+}
@@ -0,0 +1,122 @@
+package lb
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"time"
+)
+
+// requestMetrics records the requests proxied to a coordinator
+type requestMetrics struct {
+	coordinator string
+}
+
+func (r requestMetrics) Observe(request *http.Request, response *http.Response, err error, latency time.Duration) {
+	statusCode := 0
+	if err == nil && response != nil {
+		statusCode = response.StatusCode
+	}
+	metrics.ObserveRequest(r.coordinator, statusCode, latency)
+}
+
+var (
+	coordinatorLabels = []string{"coordinator"}
+
+	coordinatorHealthyDesc = prometheus.NewDesc("trino_lb_coordinator_healthy",
+		"Whether the coordinator is healthy according to the last health check.", coordinatorLabels, nil)
+	coordinatorEnabledDesc = prometheus.NewDesc("trino_lb_coordinator_enabled",
+		"Whether the coordinator is enabled.", coordinatorLabels, nil)
+	coordinatorEjectedDesc = prometheus.NewDesc("trino_lb_coordinator_ejected",
+		"Whether the coordinator has been ejected by the outlier detection.", coordinatorLabels, nil)
+	runningQueriesDesc = prometheus.NewDesc("trino_lb_coordinator_running_queries",
+		"Running queries on the coordinator.", coordinatorLabels, nil)
+	queuedQueriesDesc = prometheus.NewDesc("trino_lb_coordinator_queued_queries",
+		"Queued queries on the coordinator.", coordinatorLabels, nil)
+	blockedQueriesDesc = prometheus.NewDesc("trino_lb_coordinator_blocked_queries",
+		"Blocked queries on the coordinator.", coordinatorLabels, nil)
+	activeWorkersDesc = prometheus.NewDesc("trino_lb_coordinator_active_workers",
+		"Active workers of the coordinator cluster.", coordinatorLabels, nil)
+	runningDriversDesc = prometheus.NewDesc("trino_lb_coordinator_running_drivers",
+		"Running drivers on the coordinator cluster.", coordinatorLabels, nil)
+	reservedMemoryDesc = prometheus.NewDesc("trino_lb_coordinator_reserved_memory_bytes",
+		"Memory reserved by the queries running on the coordinator cluster.", coordinatorLabels, nil)
+	inFlightRequestsDesc = prometheus.NewDesc("trino_lb_coordinator_in_flight_requests",
+		"Requests proxied to the coordinator and not completed yet.", coordinatorLabels, nil)
+	latencyEwmaDesc = prometheus.NewDesc("trino_lb_coordinator_latency_ewma_seconds",
+		"Moving average of the latency of the requests proxied to the coordinator.", coordinatorLabels, nil)
+)
+
+// PoolCollector exposes the health and the statistics of the pool members as prometheus gauges
+type PoolCollector struct {
+	pool *Pool
+}
+
+func NewPoolCollector(pool *Pool) PoolCollector {
+	return PoolCollector{pool: pool}
+}
+
+func (p PoolCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- coordinatorHealthyDesc
+	descs <- coordinatorEnabledDesc
+	descs <- coordinatorEjectedDesc
+	descs <- runningQueriesDesc
+	descs <- queuedQueriesDesc
+	descs <- blockedQueriesDesc
+	descs <- activeWorkersDesc
+	descs <- runningDriversDesc
+	descs <- reservedMemoryDesc
+	descs <- inFlightRequestsDesc
+	descs <- latencyEwmaDesc
+}
+
+type collectedConnection struct {
+	coordinator models.Coordinator
+	connection  *coordinatorConnection
+}
+
+func (p PoolCollector) Collect(values chan<- prometheus.Metric) {
+	// the connections are copied under the pool lock and their state is read outside of it, so a scrape
+	// never holds the pool lock while waiting for the state of a coordinator
+	p.pool.rwLock.RLock()
+	connections := make([]collectedConnection, 0, len(p.pool.coordinators))
+	for _, cc := range p.pool.coordinators {
+		connections = append(connections, collectedConnection{coordinator: cc.coordinator, connection: cc})
+	}
+	p.pool.rwLock.RUnlock()
+
+	for _, c := range connections {
+		cc := c.connection
+		state := cc.state()
+		health := state.health
+		stats := state.statistics
+
+		name := c.coordinator.Name
+		gauge := func(desc *prometheus.Desc, value float64) {
+			values <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, name)
+		}
+
+		gauge(coordinatorHealthyDesc, boolToFloat(health.Status == healthcheck.StatusHealthy))
+		gauge(coordinatorEnabledDesc, boolToFloat(c.coordinator.Enabled))
+		gauge(coordinatorEjectedDesc, boolToFloat(cc.ejectionState().Ejected))
+		gauge(runningQueriesDesc, float64(stats.RunningQueries))
+		gauge(queuedQueriesDesc, float64(stats.QueuedQueries))
+		gauge(blockedQueriesDesc, float64(stats.BlockedQueries))
+		gauge(activeWorkersDesc, float64(stats.ActiveWorkers))
+		gauge(runningDriversDesc, float64(stats.RunningDrivers))
+		gauge(reservedMemoryDesc, stats.ReservedMemory)
+
+		load := cc.load.State()
+		gauge(inFlightRequestsDesc, float64(load.InFlight))
+		gauge(latencyEwmaDesc, load.Latency.Seconds())
+	}
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
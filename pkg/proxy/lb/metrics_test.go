@@ -0,0 +1,90 @@
+package lb
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolCollector(t *testing.T) {
+	hc := healthcheck.Mock(healthcheck.Health{
+		Status:    healthcheck.StatusHealthy,
+		Timestamp: time.Now(),
+	}, nil)
+
+	stats := trino.Mock(trino.ClusterStatistics{
+		RunningQueries: 4,
+		ActiveWorkers:  2,
+	}, nil)
+
+	pool := NewPool(PoolConfigTest(), session.NewMemoryStorage(), hc, stats, logging.Noop())
+	require.NoError(t, pool.Add(models.Coordinator{
+		Name:    "coord-0",
+		URL:     mustUrl("http://trino.local:8080"),
+		Enabled: true,
+	}))
+	require.NoError(t, pool.UpdateStatus())
+
+	expected := `
+# HELP trino_lb_coordinator_healthy Whether the coordinator is healthy according to the last health check.
+# TYPE trino_lb_coordinator_healthy gauge
+trino_lb_coordinator_healthy{coordinator="coord-0"} 1
+# HELP trino_lb_coordinator_running_queries Running queries on the coordinator.
+# TYPE trino_lb_coordinator_running_queries gauge
+trino_lb_coordinator_running_queries{coordinator="coord-0"} 4
+# HELP trino_lb_coordinator_active_workers Active workers of the coordinator cluster.
+# TYPE trino_lb_coordinator_active_workers gauge
+trino_lb_coordinator_active_workers{coordinator="coord-0"} 2
+# HELP trino_lb_coordinator_in_flight_requests Requests proxied to the coordinator and not completed yet.
+# TYPE trino_lb_coordinator_in_flight_requests gauge
+trino_lb_coordinator_in_flight_requests{coordinator="coord-0"} 0
+`
+
+	err := testutil.CollectAndCompare(NewPoolCollector(pool), strings.NewReader(expected),
+		"trino_lb_coordinator_healthy", "trino_lb_coordinator_running_queries", "trino_lb_coordinator_active_workers",
+		"trino_lb_coordinator_in_flight_requests")
+	require.NoError(t, err)
+}
+
+// blockingHealthCheck waits for release after the first check, simulating an unresponsive coordinator
+type blockingHealthCheck struct {
+	checks  int32
+	started chan bool
+	release chan bool
+}
+
+func (b *blockingHealthCheck) Check(*url.URL) (healthcheck.Health, error) {
+	if atomic.AddInt32(&b.checks, 1) > 1 {
+		b.started <- true
+		<-b.release
+	}
+	return healthcheck.Health{Status: healthcheck.StatusHealthy, Timestamp: time.Now()}, nil
+}
+
+func TestPoolCollectorDoesNotWaitForHealthChecks(t *testing.T) {
+	hc := &blockingHealthCheck{started: make(chan bool), release: make(chan bool)}
+
+	pool := NewPool(PoolConfigTest(), session.NewMemoryStorage(), hc, trino.Noop(), logging.Noop())
+	require.NoError(t, pool.Add(models.Coordinator{Name: "coord-0", URL: mustUrl("http://trino.local:8080"), Enabled: true}))
+
+	done := make(chan error)
+	go func() {
+		done <- pool.UpdateStatus()
+	}()
+	<-hc.started
+
+	require.Equal(t, 11, testutil.CollectAndCount(NewPoolCollector(pool)))
+	require.Len(t, pool.Fetch(FetchRequest{Health: healthcheck.StatusHealthy}), 1)
+
+	hc.release <- true
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,170 @@
+package lb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type OutlierDetectionConf struct {
+	Enabled bool
+	// Interval is the length of the window used to compute error rate and latency
+	Interval time.Duration
+	// MinRequests is the minimum number of requests in the window required to evaluate the backend
+	MinRequests int
+	// MaxErrorRate is the ratio (0-1) of failed requests that causes the ejection
+	MaxErrorRate float64
+	// MaxLatency is the average latency that causes the ejection, 0 disables the latency check
+	MaxLatency time.Duration
+	// BaseEjectionTime is the ejection duration, it's doubled on every consecutive ejection up to MaxEjectionTime
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+}
+
+// EjectionState describes the passive health of a coordinator computed from the proxied traffic
+type EjectionState struct {
+	Ejected      bool
+	EjectedUntil time.Time
+	Ejections    int
+	Reason       string
+}
+
+// outlierDetector records the outcome of the requests proxied to a coordinator and temporarily ejects it when
+// the error rate or the average latency cross the configured thresholds. Every consecutive ejection doubles the
+// ejection time, the counter is decreased after each window completed without ejections.
+type outlierDetector struct {
+	conf        OutlierDetectionConf
+	coordinator string
+	logger      logging.Logger
+	now         func() time.Time
+
+	mutex        *sync.Mutex
+	windowStart  time.Time
+	requests     int
+	failures     int
+	latency      time.Duration
+	ejections    int
+	ejectedUntil time.Time
+	ejected      bool
+	reason       string
+}
+
+func newOutlierDetector(conf OutlierDetectionConf, coordinator string, logger logging.Logger) *outlierDetector {
+	return &outlierDetector{
+		conf:        conf,
+		coordinator: coordinator,
+		logger:      logger,
+		now:         time.Now,
+		mutex:       &sync.Mutex{},
+	}
+}
+
+func (o *outlierDetector) Observe(request *http.Request, response *http.Response, err error, latency time.Duration) {
+	// the client went away, this doesn't tell anything about the coordinator health
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	failed := err != nil || response.StatusCode >= http.StatusInternalServerError
+	o.record(failed, latency)
+}
+
+func (o *outlierDetector) record(failed bool, latency time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	now := o.now()
+	o.restoreIfExpired(now)
+	o.rollWindow(now)
+
+	o.requests++
+	o.latency += latency
+	if failed {
+		o.failures++
+	}
+
+	if o.ejected || o.requests < o.conf.MinRequests {
+		return
+	}
+
+	errorRate := float64(o.failures) / float64(o.requests)
+	if o.conf.MaxErrorRate > 0 && errorRate >= o.conf.MaxErrorRate {
+		o.eject(now, fmt.Sprintf("error rate %.2f over %d requests", errorRate, o.requests))
+		return
+	}
+
+	avgLatency := o.latency / time.Duration(o.requests)
+	if o.conf.MaxLatency > 0 && avgLatency >= o.conf.MaxLatency {
+		o.eject(now, fmt.Sprintf("average latency %s over %d requests", avgLatency, o.requests))
+	}
+}
+
+func (o *outlierDetector) State() EjectionState {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.restoreIfExpired(o.now())
+
+	return EjectionState{
+		Ejected:      o.ejected,
+		EjectedUntil: o.ejectedUntil,
+		Ejections:    o.ejections,
+		Reason:       o.reason,
+	}
+}
+
+func (o *outlierDetector) eject(now time.Time, reason string) {
+	o.ejections++
+
+	duration := o.conf.BaseEjectionTime
+	for i := 1; i < o.ejections && duration < o.conf.MaxEjectionTime; i++ {
+		duration *= 2
+	}
+
+	if o.conf.MaxEjectionTime > 0 && duration > o.conf.MaxEjectionTime {
+		duration = o.conf.MaxEjectionTime
+	}
+
+	o.ejected = true
+	o.ejectedUntil = now.Add(duration)
+	o.reason = reason
+	o.resetWindow(now)
+
+	o.logger.Warn("%s ejected from the pool for %s: %s", o.coordinator, duration, reason)
+}
+
+func (o *outlierDetector) restoreIfExpired(now time.Time) {
+	if !o.ejected || now.Before(o.ejectedUntil) {
+		return
+	}
+
+	o.ejected = false
+	o.reason = ""
+	o.resetWindow(now)
+
+	o.logger.Info("%s ejection expired, backend restored in the pool", o.coordinator)
+}
+
+func (o *outlierDetector) rollWindow(now time.Time) {
+	if now.Sub(o.windowStart) < o.conf.Interval {
+		return
+	}
+
+	// a full window without ejections decreases the backoff multiplier
+	if !o.ejected && o.ejections > 0 && !o.windowStart.IsZero() {
+		o.ejections--
+	}
+
+	o.resetWindow(now)
+}
+
+func (o *outlierDetector) resetWindow(now time.Time) {
+	o.windowStart = now
+	o.requests = 0
+	o.failures = 0
+	o.latency = 0
+}
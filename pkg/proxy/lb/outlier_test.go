@@ -0,0 +1,122 @@
+package lb
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func outlierConfTest() OutlierDetectionConf {
+	return OutlierDetectionConf{
+		Enabled:          true,
+		Interval:         10 * time.Second,
+		MinRequests:      4,
+		MaxErrorRate:     0.5,
+		BaseEjectionTime: 30 * time.Second,
+		MaxEjectionTime:  90 * time.Second,
+	}
+}
+
+type testClock struct {
+	current time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.current
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.current = c.current.Add(d)
+}
+
+func newTestOutlierDetector(conf OutlierDetectionConf) (*outlierDetector, *testClock) {
+	clock := &testClock{current: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	detector := newOutlierDetector(conf, "coord-0", logging.Noop())
+	detector.now = clock.now
+	return detector, clock
+}
+
+func observeStatus(detector *outlierDetector, status int, times int) {
+	for i := 0; i < times; i++ {
+		detector.Observe(nil, &http.Response{StatusCode: status}, nil, time.Millisecond)
+	}
+}
+
+func TestOutlierDetectorEjectOnErrorRate(t *testing.T) {
+	detector, clock := newTestOutlierDetector(outlierConfTest())
+
+	observeStatus(detector, http.StatusOK, 2)
+	observeStatus(detector, http.StatusServiceUnavailable, 1)
+	require.False(t, detector.State().Ejected)
+
+	observeStatus(detector, http.StatusInternalServerError, 1)
+
+	state := detector.State()
+	require.True(t, state.Ejected)
+	require.Equal(t, clock.current.Add(30*time.Second), state.EjectedUntil)
+	require.NotEmpty(t, state.Reason)
+
+	clock.advance(30 * time.Second)
+	require.False(t, detector.State().Ejected)
+}
+
+func TestOutlierDetectorMinRequests(t *testing.T) {
+	detector, _ := newTestOutlierDetector(outlierConfTest())
+
+	observeStatus(detector, http.StatusBadGateway, 3)
+	require.False(t, detector.State().Ejected)
+}
+
+func TestOutlierDetectorTransportErrors(t *testing.T) {
+	detector, _ := newTestOutlierDetector(outlierConfTest())
+
+	// client cancellations are not considered failures
+	for i := 0; i < 4; i++ {
+		detector.Observe(nil, nil, context.Canceled, time.Millisecond)
+	}
+	require.False(t, detector.State().Ejected)
+
+	for i := 0; i < 4; i++ {
+		detector.Observe(nil, nil, errors.New("connection refused"), time.Millisecond)
+	}
+	require.True(t, detector.State().Ejected)
+}
+
+func TestOutlierDetectorEjectOnLatency(t *testing.T) {
+	conf := outlierConfTest()
+	conf.MaxLatency = time.Second
+	detector, _ := newTestOutlierDetector(conf)
+
+	for i := 0; i < 4; i++ {
+		detector.Observe(nil, &http.Response{StatusCode: http.StatusOK}, nil, 2*time.Second)
+	}
+
+	require.True(t, detector.State().Ejected)
+}
+
+func TestOutlierDetectorExponentialBackoff(t *testing.T) {
+	detector, clock := newTestOutlierDetector(outlierConfTest())
+
+	expected := []time.Duration{30 * time.Second, 60 * time.Second, 90 * time.Second, 90 * time.Second}
+	for _, ejection := range expected {
+		observeStatus(detector, http.StatusServiceUnavailable, 4)
+
+		state := detector.State()
+		require.True(t, state.Ejected)
+		require.Equal(t, clock.current.Add(ejection), state.EjectedUntil)
+
+		clock.advance(ejection)
+	}
+
+	// windows completed without ejections reduce the backoff
+	for i := 0; i < 4; i++ {
+		observeStatus(detector, http.StatusOK, 1)
+		clock.advance(10 * time.Second)
+	}
+	observeStatus(detector, http.StatusOK, 1)
+	require.Equal(t, 0, detector.State().Ejections)
+}
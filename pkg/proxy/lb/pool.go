@@ -8,6 +8,7 @@ import (
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
 	http2 "github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/http"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
 	"github.com/google/uuid"
 	"net/http"
@@ -29,11 +30,23 @@ type coordinatorConnection struct {
 	termHc      chan bool
 	termStats   chan bool
 	stateMutex  *sync.Mutex
+	outliers    *outlierDetector
+
+	// statisticsUpdatedAt is the time of the last successful retrieval of the statistics
+	statisticsUpdatedAt time.Time
+	load                *connectionLoad
 }
 
 type CoordinatorRef struct {
 	ID         CoordinatorConnectionID
 	Statistics trino.ClusterStatistics
+	// StatisticsUpdatedAt is the time of the last retrieval of the statistics, zero if they have never been retrieved
+	StatisticsUpdatedAt time.Time
+	// Load are the requests in flight and the latency observed by the proxy
+	Load routing.ConnectionLoad
+	// Ejection is the passive health state computed from the proxied traffic, an ejected coordinator
+	// is excluded from the results filtered by health
+	Ejection EjectionState
 
 	models.Coordinator
 }
@@ -49,6 +62,10 @@ type TrinoPool interface {
 type PoolConfig struct {
 	HealthCheckDelay time.Duration
 	StatisticsDelay  time.Duration
+	UriRewrite       UriRewriteConf
+	OutlierDetection OutlierDetectionConf
+	// LatencyDecay is the decay of the moving average of the latency observed on the coordinators
+	LatencyDecay time.Duration
 }
 
 type Pool struct {
@@ -58,6 +75,7 @@ type Pool struct {
 	coordinators       map[CoordinatorConnectionID]*coordinatorConnection
 	healthChecker      healthcheck.HealthCheck
 	statisticRetriever trino.Api
+	tracker            *QueryTracker
 	rwLock             *sync.RWMutex
 }
 
@@ -73,6 +91,12 @@ func NewPool(conf PoolConfig, sessionStore session.Storage, hc healthcheck.Healt
 	}
 }
 
+// WithQueryTracker registers the tracker on the coordinators added to the pool from now on
+func (p *Pool) WithQueryTracker(tracker *QueryTracker) *Pool {
+	p.tracker = tracker
+	return p
+}
+
 func (p *Pool) UpdateStatus() error {
 	for _, c := range p.coordinators {
 		p.updateBackendHealth(c)
@@ -107,7 +131,13 @@ func (p *Pool) Fetch(req FetchRequest) []CoordinatorRef {
 			continue
 		}
 
-		if req.Health != 0 && cc.health.Status < req.Health {
+		state := cc.state()
+		if req.Health != 0 && state.health.Status < req.Health {
+			continue
+		}
+
+		ejection := cc.ejectionState()
+		if req.Health != 0 && ejection.Ejected {
 			continue
 		}
 
@@ -120,9 +150,12 @@ func (p *Pool) Fetch(req FetchRequest) []CoordinatorRef {
 		}
 
 		selected = append(selected, CoordinatorRef{
-			ID:          id,
-			Coordinator: cc.coordinator,
-			Statistics:  cc.statistics,
+			ID:                  id,
+			Coordinator:         cc.coordinator,
+			Statistics:          state.statistics,
+			StatisticsUpdatedAt: state.statisticsUpdatedAt,
+			Load:                cc.load.State(),
+			Ejection:            ejection,
 		})
 	}
 
@@ -152,30 +185,63 @@ func (p *Pool) connectionByID(id CoordinatorConnectionID) (*coordinatorConnectio
 }
 
 func (p *Pool) Add(coordinator models.Coordinator) error {
-	p.rwLock.Lock()
-	defer p.rwLock.Unlock()
+	interceptors := make([]http2.Interceptor, 0)
 
-	for _, c := range p.coordinators {
-		if c.coordinator.Name == coordinator.Name {
-			return fmt.Errorf("duplicated backend name: %s", coordinator.Name)
+	// with the affinity the session store is only read for the uris issued before the affinity has been
+	// enabled, their links expire with the store ttl
+	if p.conf.UriRewrite.Affinity.linksSessions() {
+		interceptors = append(interceptors, NewQueryClusterLinker(p.sessionStore, coordinator.Name))
+	}
+
+	if p.conf.UriRewrite.Enabled {
+		rewriter := NewPublicUriRewriter(p.conf.UriRewrite.PublicURL, coordinator.URL)
+		if p.conf.UriRewrite.Affinity.Enabled {
+			rewriter = rewriter.WithAffinity(NewAffinitySigner(p.conf.UriRewrite.Affinity.Secret), coordinator.Name)
 		}
+		interceptors = append(interceptors, rewriter)
+	}
+
+	// the tracker is the last interceptor so it counts the bytes of the body sent to the client
+	if p.tracker != nil {
+		interceptors = append(interceptors, p.tracker.Interceptor(coordinator.Name))
+	}
+
+	load := newConnectionLoad(p.conf.LatencyDecay)
+	proxy := http2.NewReverseProxy(coordinator.URL, http2.NewCompositeInterceptor(interceptors...)).
+		WithObserver(requestMetrics{coordinator: coordinator.Name}).
+		WithObserver(load)
+
+	var outliers *outlierDetector
+	if p.conf.OutlierDetection.Enabled {
+		outliers = newOutlierDetector(p.conf.OutlierDetection, coordinator.Name, p.logger)
+		proxy = proxy.WithObserver(outliers)
 	}
 
 	connectionID := CoordinatorConnectionID(uuid.New().String())
 	backendConn := &coordinatorConnection{
 		coordinator: coordinator,
-		proxy: http2.NewReverseProxy(coordinator.URL, http2.NewCompositeInterceptor(
-			NewQueryClusterLinker(p.sessionStore, coordinator.Name),
-		)),
-		termHc:     make(chan bool),
-		termStats:  make(chan bool),
-		stateMutex: &sync.Mutex{},
+		proxy:       proxy,
+		termHc:      make(chan bool),
+		termStats:   make(chan bool),
+		stateMutex:  &sync.Mutex{},
+		outliers:    outliers,
+		load:        load,
 	}
 
-	p.coordinators[connectionID] = backendConn
-
+	// the first health check is done before taking the pool lock, the pool readers don't wait for the coordinator
 	p.updateBackendHealth(backendConn)
 
+	p.rwLock.Lock()
+	defer p.rwLock.Unlock()
+
+	for _, c := range p.coordinators {
+		if c.coordinator.Name == coordinator.Name {
+			return fmt.Errorf("duplicated backend name: %s", coordinator.Name)
+		}
+	}
+
+	p.coordinators[connectionID] = backendConn
+
 	go p.healthCheck(backendConn)
 	go p.clusterStatistics(backendConn)
 
@@ -185,26 +251,31 @@ func (p *Pool) Add(coordinator models.Coordinator) error {
 
 func (p *Pool) Remove(id CoordinatorConnectionID) error {
 	p.rwLock.Lock()
-	defer p.rwLock.Unlock()
-
 	conn, present := p.coordinators[id]
+	delete(p.coordinators, id)
+	p.rwLock.Unlock()
 
 	if !present {
 		return errors.New("backend not found")
 	}
 
+	// the checks are stopped outside of the pool lock, a check in progress may be waiting for the coordinator
 	conn.termHc <- true
 	conn.termStats <- true
 
+	if stateful, ok := p.healthChecker.(healthcheck.StatefulHealthCheck); ok {
+		stateful.Forget(conn.coordinator.URL)
+	}
+
+	conn.stateMutex.Lock()
 	conn.health = healthcheck.Health{
 		Timestamp: time.Now(),
 		Status:    healthcheck.StatusUnhealthy,
 		Message:   "backend has been removed from the pool",
 	}
+	conn.stateMutex.Unlock()
 
 	p.logger.Info("removed backend from pool: %s ( %s )", conn.coordinator.Name, conn.coordinator)
-
-	delete(p.coordinators, id)
 	return nil
 }
 
@@ -232,9 +303,9 @@ func (p *Pool) healthCheck(b *coordinatorConnection) {
 	}
 }
 
+// updateBackendHealth checks the coordinator health, the state mutex is not held during the check so a slow
+// coordinator doesn't block the readers of its state
 func (p *Pool) updateBackendHealth(b *coordinatorConnection) {
-	b.stateMutex.Lock()
-	defer b.stateMutex.Unlock()
 	result, err := p.healthChecker.Check(b.coordinator.URL)
 	if err != nil {
 		result = healthcheck.Health{
@@ -244,6 +315,9 @@ func (p *Pool) updateBackendHealth(b *coordinatorConnection) {
 		}
 	}
 
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
 	if b.health.Status != result.Status {
 		p.logger.Warn("%s health status changed %s -> %s", b.coordinator.Name, b.health.Status.String(), result.Status.String())
 	}
@@ -252,10 +326,7 @@ func (p *Pool) updateBackendHealth(b *coordinatorConnection) {
 }
 
 func (p *Pool) updateBackendStatistics(b *coordinatorConnection) {
-	b.stateMutex.Lock()
-	defer b.stateMutex.Unlock()
-
-	if !b.health.IsAvailable() {
+	if !b.state().health.IsAvailable() {
 		return
 	}
 
@@ -265,7 +336,11 @@ func (p *Pool) updateBackendStatistics(b *coordinatorConnection) {
 		return
 	}
 
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
 	b.statistics = stats
+	b.statisticsUpdatedAt = time.Now()
 }
 
 func (p *Pool) Handle(coordinator CoordinatorRef, writer http.ResponseWriter, request *http.Request) error {
@@ -273,9 +348,38 @@ func (p *Pool) Handle(coordinator CoordinatorRef, writer http.ResponseWriter, re
 	if err != nil {
 		return err
 	}
+
+	conn.load.begin()
+	defer conn.load.end()
+
 	return conn.proxy.Handle(writer, request)
 }
 
+// connectionState is the health and the statistics of a coordinator
+type connectionState struct {
+	health              healthcheck.Health
+	statistics          trino.ClusterStatistics
+	statisticsUpdatedAt time.Time
+}
+
+func (c *coordinatorConnection) state() connectionState {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	return connectionState{
+		health:              c.health,
+		statistics:          c.statistics,
+		statisticsUpdatedAt: c.statisticsUpdatedAt,
+	}
+}
+
+func (c *coordinatorConnection) ejectionState() EjectionState {
+	if c.outliers == nil {
+		return EjectionState{}
+	}
+	return c.outliers.State()
+}
+
 func matchTags(source map[string]string, match map[string]string) bool {
 	for k, v := range match {
 		if source[k] != v {
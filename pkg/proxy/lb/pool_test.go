@@ -7,6 +7,9 @@ import (
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
 	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -265,3 +268,98 @@ func TestPool_UpdateBackend(t *testing.T) {
 	}, state[0].Coordinator)
 
 }
+
+func TestPool_EjectFailingBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	hc := healthcheck.Mock(healthcheck.Health{
+		Status:    healthcheck.StatusHealthy,
+		Message:   "ok",
+		Timestamp: time.Now(),
+	}, nil)
+
+	conf := PoolConfigTest()
+	conf.OutlierDetection = OutlierDetectionConf{
+		Enabled:          true,
+		Interval:         time.Minute,
+		MinRequests:      2,
+		MaxErrorRate:     0.5,
+		BaseEjectionTime: time.Minute,
+		MaxEjectionTime:  time.Minute,
+	}
+
+	pool := NewPool(conf, session.NewMemoryStorage(), hc, trino.Mock(trino.ClusterStatistics{}, nil), logging.Noop())
+
+	err := pool.Add(models.Coordinator{
+		Name:    "coord-0",
+		URL:     mustUrl(backend.URL),
+		Enabled: true,
+	})
+	require.NoError(t, err)
+
+	healthy := pool.Fetch(FetchRequest{Health: healthcheck.StatusHealthy})
+	require.Len(t, healthy, 1)
+	require.False(t, healthy[0].Ejection.Ejected)
+
+	for i := 0; i < 2; i++ {
+		err = pool.Handle(healthy[0], httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost/v1/info", nil))
+		require.NoError(t, err)
+	}
+
+	require.Empty(t, pool.Fetch(FetchRequest{Health: healthcheck.StatusHealthy}))
+
+	// the ejected backend can still be retrieved by name to serve requests of queries it owns
+	byName := pool.Fetch(FetchRequest{Name: "coord-0"})
+	require.Len(t, byName, 1)
+	require.True(t, byName[0].Ejection.Ejected)
+}
+
+func TestPool_StatisticsUpdatedAt(t *testing.T) {
+	hc := healthcheck.Mock(healthcheck.Health{Status: healthcheck.StatusHealthy, Timestamp: time.Now()}, nil)
+	stats := trino.Mock(trino.ClusterStatistics{RunningQueries: 3, ActiveWorkers: 2}, nil)
+
+	pool := NewPool(PoolConfigTest(), session.NewMemoryStorage(), hc, stats, logging.Noop())
+	require.NoError(t, pool.Add(models.Coordinator{Name: "coord-0", URL: mustUrl("http://trino.local:8080"), Enabled: true}))
+
+	// the statistics are retrieved by the first statistics tick, until then they are missing
+	backends := pool.Fetch(FetchRequest{})
+	require.Len(t, backends, 1)
+	require.True(t, backends[0].StatisticsUpdatedAt.IsZero())
+
+	before := time.Now()
+	require.NoError(t, pool.UpdateStatus())
+
+	backends = pool.Fetch(FetchRequest{})
+	require.Equal(t, int32(3), backends[0].Statistics.RunningQueries)
+	require.False(t, backends[0].StatisticsUpdatedAt.Before(before))
+}
+
+// forgettingHealthCheck records the clusters forgotten by the pool
+type forgettingHealthCheck struct {
+	forgotten []string
+}
+
+func (f *forgettingHealthCheck) Check(*url.URL) (healthcheck.Health, error) {
+	return healthcheck.Health{Status: healthcheck.StatusHealthy, Timestamp: time.Now()}, nil
+}
+
+func (f *forgettingHealthCheck) Forget(u *url.URL) {
+	f.forgotten = append(f.forgotten, u.String())
+}
+
+func TestPool_RemoveBackendForgetsHealthState(t *testing.T) {
+	hc := &forgettingHealthCheck{}
+	pool := NewPool(PoolConfigTest(), session.NewMemoryStorage(), hc, trino.Noop(), logging.Noop())
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "coord-0", URL: mustUrl("http://trino-0.local:8080"), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "coord-1", URL: mustUrl("http://trino-1.local:8080"), Enabled: true}))
+
+	removed := pool.Fetch(FetchRequest{Name: "coord-0"})
+	require.Len(t, removed, 1)
+	require.NoError(t, pool.Remove(removed[0].ID))
+
+	require.Equal(t, []string{"http://trino-0.local:8080"}, hc.forgotten)
+}
@@ -1,19 +1,34 @@
 package lb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	http2 "github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/http"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/metrics"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
 	"github.com/gorilla/mux"
+	"io"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
 type ProxyConf struct {
 	SyncDelay time.Duration
+	Affinity  AffinityConf
+	// SubmissionRetries is the number of times a query submission is sent to another coordinator when
+	// the selected one is unavailable, 0 disables the retries
+	SubmissionRetries int
+	// CaptureQuery keeps the statement of the submitted queries for the access log
+	CaptureQuery bool
+	// RouteHeader adds the explanation of the routing decision to the responses of the routed requests
+	RouteHeader bool
 }
 
 type Proxy struct {
@@ -21,25 +36,45 @@ type Proxy struct {
 	logger          logging.Logger
 	pool            *Pool
 	sessionReader   session.Reader
-	router          routing.Router
+	router          *atomic.Value
 	poolSync        PoolSync
 	termSync        chan bool
 	requestRewriter RequestRewriter
+	affinity        *AffinitySigner
 }
 
 func NewProxy(conf ProxyConf, pool *Pool, sync PoolSync, sessReader session.Reader, router routing.Router, requestRewriter RequestRewriter, logger logging.Logger) *Proxy {
+	var affinity *AffinitySigner
+	if conf.Affinity.Enabled {
+		signer := NewAffinitySigner(conf.Affinity.Secret)
+		affinity = &signer
+	}
+
+	current := &atomic.Value{}
+	current.Store(router)
+
 	return &Proxy{
 		conf:            conf,
 		poolSync:        sync,
-		router:          router,
+		router:          current,
 		logger:          logger,
 		pool:            pool,
 		sessionReader:   sessReader,
 		termSync:        make(chan bool),
 		requestRewriter: requestRewriter,
+		affinity:        affinity,
 	}
 }
 
+// SetQueryRouter replaces the router used for the next queries, the requests in flight are not affected
+func (p *Proxy) SetQueryRouter(router routing.Router) {
+	p.router.Store(router)
+}
+
+func (p *Proxy) queryRouter() routing.Router {
+	return p.router.Load().(routing.Router)
+}
+
 func (p *Proxy) Router() *mux.Router {
 	r := mux.NewRouter()
 
@@ -70,65 +105,145 @@ func (p *Proxy) Serve(addr string) error {
 }
 
 func (p *Proxy) Handle(writer http.ResponseWriter, request *http.Request) {
-	coordinator, err := p.selectCoordinatorForRequest(request)
-	if errors.Is(err, ErrNoBackendsAvailable) {
-		p.logger.Warn("no available backends for request %s", request.URL)
-		writer.WriteHeader(http.StatusServiceUnavailable)
-		if _, err := writer.Write([]byte(err.Error())); err != nil {
-			p.logger.Error("error writing response: %w", err)
+	request, trace := withRequestTrace(request)
+
+	if isQuerySubmission(request) {
+		// the statement is read for the access log and for the statement routing, the body is restored
+		// before being sent to the coordinator
+		if p.conf.CaptureQuery || p.queryRouter().ReadsStatement() {
+			if err := captureQuery(request, trace); err != nil {
+				p.writeSelectionError(writer, request, err)
+				return
+			}
+		}
+
+		if p.conf.SubmissionRetries > 0 {
+			p.handleSubmission(writer, request)
+			return
 		}
-		return
 	}
 
+	coordinator, err := p.selectCoordinatorForRequest(request)
 	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		if _, err := writer.Write([]byte(err.Error())); err != nil {
-			p.logger.Error("error writing response: %w", err)
-		}
+		p.writeSelectionError(writer, request, err)
 		return
 	}
 
+	removeAffinityToken(request)
+	writeRouteHeader(writer, trace)
+
 	if err := p.pool.Handle(coordinator, writer, request); err != nil {
 		p.logger.Error("error handling request %s: %s", request.URL, err.Error())
 	}
 }
 
-func (p *Proxy) selectCoordinatorForRequest(request *http.Request) (CoordinatorRef, error) {
-	// the request is not query related OR the request is a query submission
-	// we can apply the user selected request routing algorithm
-	if !isStatementRequest(request.URL) || isStatementRequest(request.URL) && request.Method == http.MethodPost {
-		request, err := p.requestRewriter.Rewrite(request)
+// handleSubmission sends a query submission to the routed coordinator, if the coordinator is unavailable the
+// submission is routed again excluding the failed coordinators until the retry budget is exhausted.
+// Only submissions are retried: the query doesn't exist yet so there is no coordinator affinity to preserve
+func (p *Proxy) handleSubmission(writer http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		p.writeSelectionError(writer, request, err)
+		return
+	}
+
+	excluded := make([]string, 0)
+	var lastErr error
+
+	for attempt := 0; ; attempt++ {
+		coordinator, err := p.routeRequest(request, excluded)
 		if err != nil {
-			return CoordinatorRef{}, err
+			// all the routable coordinators have been tried, the last failure is returned to the client
+			if lastErr != nil {
+				p.logger.Warn("query submission failed on all the available coordinators: %s", lastErr.Error())
+				writeResponse(writer, http.StatusBadGateway, lastErr.Error(), p.logger)
+				return
+			}
+
+			p.writeSelectionError(writer, request, err)
+			return
 		}
 
-		healthyCoordinators := p.pool.Fetch(FetchRequest{
-			Health: healthcheck.StatusHealthy,
-		})
+		retryable := attempt < p.conf.SubmissionRetries
 
-		if len(healthyCoordinators) == 0 {
-			return CoordinatorRef{}, ErrNoBackendsAvailable
+		attemptRequest := request
+		if retryable {
+			attemptRequest = http2.WithRetry(request)
 		}
 
-		targetCoordinator, err := p.router.Route(routingRequest(healthyCoordinators, request))
-		if err != nil {
-			if errors.Is(err, routing.ErrRouteNotFound) {
-				return CoordinatorRef{}, fmt.Errorf("%s: %w", err.Error(), ErrNoBackendsAvailable)
-			}
-			return CoordinatorRef{}, err
+		attemptRequest.Body = io.NopCloser(bytes.NewReader(body))
+		attemptRequest.ContentLength = int64(len(body))
+		attemptRequest.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+
+		writeRouteHeader(writer, requestTraceFromContext(request.Context()))
+
+		err = p.pool.Handle(coordinator, writer, attemptRequest)
+		if err == nil {
+			return
+		}
+
+		if retryable && errors.Is(err, http2.ErrUpstreamUnavailable) {
+			p.logger.Warn("query submission to %s failed, retrying on another coordinator: %s", coordinator.Name, err.Error())
+			excluded = append(excluded, coordinator.Name)
+			lastErr = err
+			continue
 		}
 
-		return p.coordinatorRefByName(targetCoordinator.Name)
+		p.logger.Error("error handling request %s: %s", request.URL, err.Error())
+		return
+	}
+}
+
+// captureQuery stores the statement in the request trace, the body is restored to be sent to the coordinator
+func captureQuery(request *http.Request, trace *requestTrace) error {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return err
 	}
 
-	// the request is retrieving info about a specific query we must get coordinator with planned the query
-	// so we use the sessionReader to retrieve its name
-	if isStatementRequest(request.URL) && request.Method == http.MethodGet {
+	trace.query = string(body)
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.ContentLength = int64(len(body))
+	return nil
+}
+
+func (p *Proxy) writeSelectionError(writer http.ResponseWriter, request *http.Request, err error) {
+	writeRouteHeader(writer, requestTraceFromContext(request.Context()))
+
+	if errors.Is(err, ErrNoBackendsAvailable) {
+		metrics.ObserveNoBackendsAvailable()
+		p.logger.Warn("no available backends for request %s", request.URL)
+		writeResponse(writer, http.StatusServiceUnavailable, err.Error(), p.logger)
+		return
+	}
+
+	writeResponse(writer, http.StatusInternalServerError, err.Error(), p.logger)
+}
+
+func writeResponse(writer http.ResponseWriter, status int, body string, logger logging.Logger) {
+	writer.WriteHeader(status)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		logger.Error("error writing response: %w", err)
+	}
+}
+
+func (p *Proxy) selectCoordinatorForRequest(request *http.Request) (CoordinatorRef, error) {
+	// the request is retrieving info, cancelling or killing a specific query: we must get the coordinator
+	// that planned the query so we use the sessionReader to retrieve its name
+	if isQueryScopedRequest(request) {
 		queryInfo, err := queryInfoFromRequest(request)
 		if err != nil {
 			return CoordinatorRef{}, err
 		}
 
+		// the affinity token allows to route the request without reading the session storage, that
+		// is used only for uris without a valid token (eg. issued before the affinity has been enabled)
+		if coordinatorName, ok := p.coordinatorFromAffinity(request, queryInfo); ok {
+			return p.coordinatorRefByName(coordinatorName)
+		}
+
 		coordinatorName, err := p.sessionReader.Get(request.Context(), queryInfo)
 		if err != nil {
 			return CoordinatorRef{}, err
@@ -137,9 +252,159 @@ func (p *Proxy) selectCoordinatorForRequest(request *http.Request) (CoordinatorR
 		return p.coordinatorRefByName(coordinatorName)
 	}
 
+	// the request is not query related OR the request is a query submission
+	// we can apply the user selected request routing algorithm
+	if !isStatementRequest(request.URL) || request.Method == http.MethodPost {
+		return p.routeRequest(request, nil)
+	}
+
 	return CoordinatorRef{}, ErrNoBackendsAvailable
 }
 
+// routeRequest applies the routing algorithm to the healthy coordinators, the coordinators with a name
+// contained in excluded are not considered
+func (p *Proxy) routeRequest(request *http.Request, excluded []string) (CoordinatorRef, error) {
+	if p.conf.RouteHeader {
+		coordinator, _, err := p.explainRoute(request, excluded)
+		return coordinator, err
+	}
+
+	request, err := p.requestRewriter.Rewrite(request)
+	if err != nil {
+		return CoordinatorRef{}, err
+	}
+
+	healthyCoordinators := excludeCoordinators(p.pool.Fetch(FetchRequest{
+		Health: healthcheck.StatusHealthy,
+	}), excluded)
+
+	if len(healthyCoordinators) == 0 {
+		return CoordinatorRef{}, ErrNoBackendsAvailable
+	}
+
+	decision, err := p.queryRouter().Decide(routingRequest(healthyCoordinators, request))
+	if err != nil {
+		return CoordinatorRef{}, routingError(err)
+	}
+
+	return p.routed(request, decision)
+}
+
+// explainRoute routes the request like routeRequest and describes the decision, with the route header enabled
+// the explanation is kept in the request trace
+func (p *Proxy) explainRoute(request *http.Request, excluded []string) (CoordinatorRef, RouteExplanation, error) {
+	decision, explanation, err := p.explainDecision(request, excluded, p.queryRouter().Explain)
+	if err != nil {
+		return CoordinatorRef{}, explanation, err
+	}
+
+	coordinator, err := p.routed(request, decision)
+	return coordinator, explanation, err
+}
+
+// explainDecision describes the routing decision taken by explain, the decision is not recorded
+func (p *Proxy) explainDecision(request *http.Request, excluded []string, explain func(routing.Request) (routing.Decision, routing.Explanation, error)) (routing.Decision, RouteExplanation, error) {
+	var explanation RouteExplanation
+
+	request, err := p.requestRewriter.Rewrite(request)
+	if err != nil {
+		return routing.Decision{}, explanation, err
+	}
+
+	all := p.pool.Fetch(FetchRequest{})
+	healthy := p.pool.Fetch(FetchRequest{
+		Health: healthcheck.StatusHealthy,
+	})
+
+	healthyCoordinators := excludeCoordinators(healthy, excluded)
+
+	decision, routingExplanation, err := explain(routingRequest(healthyCoordinators, request))
+	explanation.Explanation = routingExplanation
+	explanation.Excluded = explainExclusions(all, healthy, excluded)
+
+	if trace := requestTraceFromContext(request.Context()); trace != nil {
+		trace.route = explanation.Header()
+	}
+
+	if len(healthyCoordinators) == 0 {
+		return routing.Decision{}, explanation, ErrNoBackendsAvailable
+	}
+
+	if err != nil {
+		return routing.Decision{}, explanation, routingError(err)
+	}
+
+	return decision, explanation, nil
+}
+
+// writeRouteHeader adds the route explanation to the response, the header is set only when the route header
+// is enabled and the request has been routed
+func writeRouteHeader(writer http.ResponseWriter, trace *requestTrace) {
+	if trace != nil && len(trace.route) != 0 {
+		writer.Header().Set(HeaderRoute, trace.route)
+	}
+}
+
+func routingError(err error) error {
+	if errors.Is(err, routing.ErrRouteNotFound) {
+		return fmt.Errorf("%s: %w", err.Error(), ErrNoBackendsAvailable)
+	}
+	return err
+}
+
+func (p *Proxy) routed(request *http.Request, decision routing.Decision) (CoordinatorRef, error) {
+	metrics.ObserveRoutingDecision(decision.Rule, decision.UserRule)
+
+	if trace := requestTraceFromContext(request.Context()); trace != nil {
+		trace.rule = decision.Rule
+		trace.userRule = decision.UserRule
+	}
+
+	return p.coordinatorRefByName(decision.Coordinator.Name)
+}
+
+func excludeCoordinators(coordinators []CoordinatorRef, excluded []string) []CoordinatorRef {
+	if len(excluded) == 0 {
+		return coordinators
+	}
+
+	filtered := make([]CoordinatorRef, 0, len(coordinators))
+	for _, c := range coordinators {
+		if !containsName(excluded, c.Name) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) coordinatorFromAffinity(request *http.Request, queryInfo trino.QueryInfo) (string, bool) {
+	if p.affinity == nil {
+		return "", false
+	}
+
+	token := affinityToken(request)
+	if len(token) == 0 {
+		return "", false
+	}
+
+	coordinatorName, err := p.affinity.Verify(queryInfo.QueryID, token)
+	if err != nil {
+		p.logger.Warn("discarding affinity token for query %s: %s", queryInfo.QueryID, err.Error())
+		return "", false
+	}
+
+	return coordinatorName, true
+}
+
 // retrieve backend by name, if not present force cluster status sync for the pool and then try again to fetch the request backend,
 func (p *Proxy) coordinatorRefByName(name string) (CoordinatorRef, error) {
 	coordinator := p.pool.Fetch(FetchRequest{
@@ -173,15 +438,34 @@ func routingRequest(backends []CoordinatorRef, req *http.Request) routing.Reques
 	coordinatorsWithStatistics := make([]routing.CoordinatorWithStatistics, len(backends))
 	for i, backend := range backends {
 		coordinatorsWithStatistics[i] = routing.CoordinatorWithStatistics{
-			Coordinator: backend.Coordinator,
-			Statistics:  backend.Statistics,
+			Coordinator:         backend.Coordinator,
+			Statistics:          backend.Statistics,
+			StatisticsUpdatedAt: backend.StatisticsUpdatedAt,
+			Load:                backend.Load,
 		}
 	}
 
-	return routing.Request{
-		Coordinators: coordinatorsWithStatistics,
-		User:         req.Header.Get(TrinoHeaderUser),
+	routingReq := routing.Request{
+		Coordinators:  coordinatorsWithStatistics,
+		User:          req.Header.Get(TrinoHeaderUser),
+		Headers:       req.Header,
+		ClientAddress: clientAddress(req),
+	}
+
+	if trace := requestTraceFromContext(req.Context()); trace != nil {
+		routingReq.Statement = trace.query
+	}
+
+	return routingReq
+}
+
+// clientAddress returns the ip of the client connected to the proxy, the forwarded headers are not trusted
+func clientAddress(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
 	}
+	return host
 }
 
 func (p *Proxy) syncPoolState() {
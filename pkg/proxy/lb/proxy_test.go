@@ -1,6 +1,7 @@
 package lb
 
 import (
+	"context"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
@@ -8,9 +9,13 @@ import (
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/statement"
 	"github.com/stretchr/testify/require"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"time"
 
 	"testing"
@@ -101,6 +106,391 @@ func TestProxyRoutingMultiCoordinator(t *testing.T) {
 	}
 }
 
+func TestProxyRoutingQueryCancelToOwningCoordinator(t *testing.T) {
+	const queryID = "20200924_102554_02623_yi2gi"
+
+	fakeCoord0 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fakeCoord0.Close()
+
+	var received []string
+	fakeCoord1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received = append(received, request.Method+" "+request.URL.Path)
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer fakeCoord1.Close()
+
+	sessStore := session.NewMemoryStorage()
+	hc := healthcheck.NoOp()
+	stats := trino.Noop()
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), routing.RoundRobin())
+
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, hc, stats, logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl(fakeCoord1.URL), Enabled: true}))
+
+	proxy := NewProxy(proxyConfig, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	paths := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodHead, "/v1/statement/executing/" + queryID + "/y1/1"},
+		{http.MethodGet, "/v1/query/" + queryID},
+		{http.MethodPut, "/v1/query/" + queryID + "/killed"},
+		{http.MethodDelete, "/v1/statement/executing/" + queryID + "/y1/1"},
+	}
+
+	for _, p := range paths {
+		queryInfo := trino.QueryInfo{QueryID: queryID, User: "test", TransactionID: TrinoDefaultTransactionID}
+		require.NoError(t, sessStore.Link(context.TODO(), queryInfo, "cluster-1"))
+
+		req, err := http.NewRequest(p.method, srv.URL+p.path, nil)
+		require.NoError(t, err)
+		req.Header.Set(TrinoHeaderUser, "test")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+	}
+
+	require.Equal(t, []string{
+		http.MethodHead + " /v1/statement/executing/" + queryID + "/y1/1",
+		http.MethodGet + " /v1/query/" + queryID,
+		http.MethodPut + " /v1/query/" + queryID + "/killed",
+		http.MethodDelete + " /v1/statement/executing/" + queryID + "/y1/1",
+	}, received)
+
+	// the link must be removed after a successful cancel
+	_, err := sessStore.Get(context.TODO(), trino.QueryInfo{QueryID: queryID, TransactionID: TrinoDefaultTransactionID})
+	require.ErrorIs(t, err, session.ErrLinkNotFound)
+}
+
+func TestProxyRoutingWithAffinityToken(t *testing.T) {
+	const queryID = "20200924_102554_02623_yi2gi"
+
+	fakeCoord0 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fakeCoord0.Close()
+
+	var receivedQuery []string
+	fakeCoord1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		receivedQuery = append(receivedQuery, request.URL.RawQuery)
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte(`{"id":"` + queryID + `","nextUri":"http://coordinator.local/v1/statement/executing/` + queryID + `/y1/2"}`))
+	}))
+	defer fakeCoord1.Close()
+
+	// the session store is empty, routing must rely only on the affinity token
+	sessStore := session.NewMemoryStorage()
+	hc := healthcheck.NoOp()
+	stats := trino.Noop()
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), routing.RoundRobin())
+
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, hc, stats, logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl(fakeCoord1.URL), Enabled: true}))
+
+	conf := ProxyConf{
+		SyncDelay: time.Hour,
+		Affinity: AffinityConf{
+			Enabled: true,
+			Secret:  "secret",
+		},
+	}
+
+	proxy := NewProxy(conf, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	token := NewAffinitySigner("secret").Sign(queryID, "cluster-1")
+
+	res, err := http.Get(srv.URL + "/v1/statement/executing/" + queryID + "/y1/1?" + AffinityQueryParam + "=" + token)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, []string{""}, receivedQuery)
+
+	// an invalid token falls back to the session storage
+	res, err = http.Get(srv.URL + "/v1/statement/executing/" + queryID + "/y1/1?" + AffinityQueryParam + "=invalid")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	require.Len(t, receivedQuery, 1)
+}
+
+func TestProxyAffinitySessionLinks(t *testing.T) {
+	const queryID = "20200924_102554_02623_yi2gi"
+
+	fakeCoord := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte(`{"id":"` + queryID + `","nextUri":"http://coordinator.local/v1/statement/queued/` + queryID + `/y1/1"}`))
+	}))
+	defer fakeCoord.Close()
+
+	tests := []struct {
+		name     string
+		affinity AffinityConf
+		linked   bool
+	}{
+		{name: "no affinity", affinity: AffinityConf{}, linked: true},
+		{name: "affinity", affinity: AffinityConf{Enabled: true, Secret: "secret"}, linked: false},
+		{name: "affinity with session links", affinity: AffinityConf{Enabled: true, Secret: "secret", SessionLinks: true}, linked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessStore := session.NewMemoryStorage()
+			logger := logging.Noop()
+
+			poolConf := PoolConfigTest()
+			poolConf.UriRewrite = UriRewriteConf{Enabled: true, Affinity: tt.affinity}
+
+			pool := NewPool(poolConf, sessStore, healthcheck.NoOp(), trino.Noop(), logger)
+			require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord.URL), Enabled: true}))
+
+			router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), routing.RoundRobin())
+			proxy := NewProxy(ProxyConf{SyncDelay: time.Hour, Affinity: tt.affinity}, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+			srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/statement", strings.NewReader("select 1"))
+			require.NoError(t, err)
+			req.Header.Set(TrinoHeaderUser, "user")
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			_, err = sessStore.Get(context.Background(), trino.QueryInfo{QueryID: queryID, User: "user", TransactionID: TrinoDefaultTransactionID})
+			if tt.linked {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, session.ErrLinkNotFound)
+			}
+		})
+	}
+}
+
+func TestProxyPartialCancelWithAffinityToken(t *testing.T) {
+	const queryID = "20200924_102554_02623_yi2gi"
+
+	var otherCalls int
+	fakeCoord0 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		otherCalls++
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fakeCoord0.Close()
+
+	var partialCancels []string
+	fakeCoord1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodDelete {
+			partialCancels = append(partialCancels, request.URL.RequestURI())
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte(`{"id":"` + queryID + `",` +
+			`"nextUri":"http://coordinator.local/v1/statement/executing/` + queryID + `/y1/1",` +
+			`"partialCancelUri":"http://coordinator.local/v1/statement/executing/partialCancel/` + queryID + `/0/y1/1"}`))
+	}))
+	defer fakeCoord1.Close()
+
+	affinity := AffinityConf{Enabled: true, Secret: "secret"}
+
+	// without session links the partial cancel can only be routed through the affinity token
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+
+	poolConf := PoolConfigTest()
+	poolConf.UriRewrite = UriRewriteConf{Enabled: true, Affinity: affinity}
+
+	pool := NewPool(poolConf, sessStore, healthcheck.NoOp(), trino.Noop(), logger)
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl(fakeCoord1.URL), Enabled: true}))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), preferredRule{name: "cluster-1"})
+	proxy := NewProxy(ProxyConf{SyncDelay: time.Hour, Affinity: affinity}, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader("select 1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	state := readState(t, res.Body, false)
+	partialCancelUri, ok := state["partialCancelUri"].(string)
+	require.True(t, ok)
+	require.True(t, strings.HasPrefix(partialCancelUri, srv.URL+"/v1/statement/executing/partialCancel/"+queryID+"/0/y1/1?"))
+
+	req, err := http.NewRequest(http.MethodDelete, partialCancelUri, nil)
+	require.NoError(t, err)
+
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	// the affinity token is removed before forwarding the request to the coordinator
+	require.Equal(t, []string{"/v1/statement/executing/partialCancel/" + queryID + "/0/y1/1"}, partialCancels)
+	require.Zero(t, otherCalls)
+}
+
+// preferredRule routes to the coordinator with the given name when available, otherwise to the first one
+type preferredRule struct {
+	name string
+}
+
+func (p preferredRule) Route(req routing.Request) (models.Coordinator, error) {
+	for _, c := range req.Coordinators {
+		if c.Coordinator.Name == p.name {
+			return c.Coordinator, nil
+		}
+	}
+	return req.Coordinators[0].Coordinator, nil
+}
+
+func TestProxySubmissionFailover(t *testing.T) {
+	const queryID = "20200924_102554_02623_yi2gi"
+
+	var unavailableCalls int
+	fakeCoord0 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		unavailableCalls++
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer fakeCoord0.Close()
+
+	var receivedBody string
+	fakeCoord1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+		receivedBody = string(body)
+
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte(`{"id":"` + queryID + `","nextUri":"http://coordinator.local/v1/statement/queued/` + queryID + `/y1/1"}`))
+	}))
+	defer fakeCoord1.Close()
+
+	sessStore := session.NewMemoryStorage()
+	hc := healthcheck.NoOp()
+	stats := trino.Noop()
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), preferredRule{name: "cluster-0"})
+
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, hc, stats, logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl(fakeCoord1.URL), Enabled: true}))
+
+	conf := ProxyConf{
+		SyncDelay:         time.Hour,
+		SubmissionRetries: 2,
+	}
+
+	proxy := NewProxy(conf, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader("select 1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.Equal(t, 1, unavailableCalls)
+	require.Equal(t, "select 1", receivedBody)
+
+	// the session must be linked to the coordinator that accepted the query
+	coordinator, err := sessStore.Get(context.TODO(), trino.QueryInfo{QueryID: queryID, TransactionID: TrinoDefaultTransactionID})
+	require.NoError(t, err)
+	require.Equal(t, "cluster-1", coordinator)
+}
+
+func TestProxySubmissionFailoverBudgetExhausted(t *testing.T) {
+	var calls int
+	unavailable := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls++
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	fakeCoord0 := httptest.NewServer(unavailable)
+	defer fakeCoord0.Close()
+	fakeCoord1 := httptest.NewServer(unavailable)
+	defer fakeCoord1.Close()
+	fakeCoord2 := httptest.NewServer(unavailable)
+	defer fakeCoord2.Close()
+
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, healthcheck.NoOp(), trino.Noop(), logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl(fakeCoord1.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-2", URL: mustUrl(fakeCoord2.URL), Enabled: true}))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), routing.RoundRobin())
+
+	conf := ProxyConf{
+		SyncDelay:         time.Hour,
+		SubmissionRetries: 1,
+	}
+
+	proxy := NewProxy(conf, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	// the last attempt response is returned to the client
+	res, err := http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader("select 1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	require.Equal(t, 2, calls)
+}
+
+func TestProxyFollowUpRequestsAreNotRetried(t *testing.T) {
+	const queryID = "20200924_102554_02623_yi2gi"
+
+	var calls int
+	fakeCoord0 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls++
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer fakeCoord0.Close()
+
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, healthcheck.NoOp(), trino.Noop(), logger)
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+
+	require.NoError(t, sessStore.Link(context.TODO(), trino.QueryInfo{QueryID: queryID, TransactionID: TrinoDefaultTransactionID}, "cluster-0"))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), routing.RoundRobin())
+	proxy := NewProxy(ProxyConf{SyncDelay: time.Hour, SubmissionRetries: 3}, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodDelete, srv.URL+"/v1/statement/executing/"+queryID+"/y1/1", nil)
+	require.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	require.Equal(t, 1, calls)
+}
+
 func TestProxyWithUnhealthyBackend(t *testing.T) {
 
 	sessStore := session.NewMemoryStorage()
@@ -208,3 +598,97 @@ func TestProxyHealthEndpoint(t *testing.T) {
 	require.Equal(t, res.StatusCode, http.StatusOK)
 
 }
+
+func TestProxySetQueryRouter(t *testing.T) {
+	coordinatorHandler := func(name string, calls *int) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			*calls++
+			writer.WriteHeader(http.StatusOK)
+			_, _ = writer.Write([]byte(`{"id":"` + name + `","nextUri":"http://coordinator.local/v1/statement/queued/` + name + `/y1/1"}`))
+		})
+	}
+
+	var calls0, calls1 int
+	fakeCoord0 := httptest.NewServer(coordinatorHandler("20200924_102554_00000_yi2gi", &calls0))
+	defer fakeCoord0.Close()
+
+	fakeCoord1 := httptest.NewServer(coordinatorHandler("20200924_102554_00001_yi2gi", &calls1))
+	defer fakeCoord1.Close()
+
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, healthcheck.NoOp(), trino.Noop(), logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(fakeCoord0.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl(fakeCoord1.URL), Enabled: true}))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), preferredRule{name: "cluster-0"})
+	proxy := NewProxy(ProxyConf{SyncDelay: time.Hour}, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader("select 1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	proxy.SetQueryRouter(routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), preferredRule{name: "cluster-1"}))
+
+	res, err = http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader("select 1"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.Equal(t, 1, calls0)
+	require.Equal(t, 1, calls1)
+}
+
+func TestProxyStatementRouting(t *testing.T) {
+	bodies := make(map[string]string)
+	coordinatorHandler := func(name string, queryID string) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			body, _ := io.ReadAll(request.Body)
+			bodies[name] = string(body)
+			writer.WriteHeader(http.StatusOK)
+			_, _ = writer.Write([]byte(`{"id":"` + queryID + `","nextUri":"http://coordinator.local/v1/statement/queued/` + queryID + `/y1/1"}`))
+		})
+	}
+
+	adhoc := httptest.NewServer(coordinatorHandler("adhoc-0", "20200924_102554_00000_yi2gi"))
+	defer adhoc.Close()
+
+	etl := httptest.NewServer(coordinatorHandler("etl-0", "20200924_102554_00001_yi2gi"))
+	defer etl.Close()
+
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, healthcheck.NoOp(), trino.Noop(), logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "adhoc-0", URL: mustUrl(adhoc.URL), Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "etl-0", URL: mustUrl(etl.URL), Enabled: true}))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{}), preferredRule{name: "adhoc-0"}).
+		WithStatementRouter(routing.NewStatementRouter([]routing.StatementRule{
+			{
+				Types:   []statement.Type{statement.TypeInsert, statement.TypeCreateTableAsSelect},
+				Cluster: routing.UserAwareClusterMatchRule{Name: regexp.MustCompile("^etl-")},
+			},
+		}))
+
+	proxy := NewProxy(ProxyConf{SyncDelay: time.Hour}, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+
+	srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+	defer srv.Close()
+
+	const insert = "insert into facts select * from staging"
+	res, err := http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader(insert))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	const query = "select * from facts"
+	res, err = http.Post(srv.URL+"/v1/statement", "text/plain", strings.NewReader(query))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the body read by the router is sent to the coordinator
+	require.Equal(t, map[string]string{"etl-0": insert, "adhoc-0": query}, bodies)
+}
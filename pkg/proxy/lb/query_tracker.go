@@ -0,0 +1,401 @@
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	http2 "github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/http"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type QueryTrackerConf struct {
+	Enabled bool
+	// AbandonTimeout is the time without requests after which a query is considered abandoned by the client
+	AbandonTimeout time.Duration
+	SweepInterval  time.Duration
+}
+
+// TrackedQuery is a query in flight through the proxy
+type TrackedQuery struct {
+	QueryID       string    `json:"query_id"`
+	TransactionID string    `json:"transaction_id"`
+	User          string    `json:"user"`
+	Source        string    `json:"source"`
+	ClientTags    []string  `json:"client_tags,omitempty"`
+	Coordinator   string    `json:"coordinator"`
+	RoutingRule   string    `json:"routing_rule,omitempty"`
+	UserRule      string    `json:"user_rule,omitempty"`
+	State         string    `json:"state"`
+	SubmittedAt   time.Time `json:"submitted_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	Requests      int64     `json:"requests"`
+	BytesIn       int64     `json:"bytes_in"`
+	BytesOut      int64     `json:"bytes_out"`
+
+	// query is the statement text, captured only when enabled in the proxy configuration
+	query string
+}
+
+type TrackedQueriesResponse struct {
+	Queries []TrackedQuery `json:"queries"`
+}
+
+// QueryListener is notified when a tracked query reaches its final state, the query includes the bytes of the
+// final response sent to the client
+type QueryListener interface {
+	QueryCompleted(query TrackedQuery, state trino.QueryState, finalState string)
+}
+
+// QueryTracker follows the queries from the submission to the final state: FINISHED, FAILED, CANCELED or
+// abandoned when the client stops polling. The queries submitted through another proxy instance are tracked
+// from the first request received. The session of an abandoned query is evicted from the local cache by the
+// tracker, the other final states are handled by QueryClusterLinker. The completed queries are notified to
+// the listeners ( e.g. the access log ), the abandoned ones are dropped
+type QueryTracker struct {
+	conf         QueryTrackerConf
+	sessionStore session.Storage
+	listeners    []QueryListener
+	logger       logging.Logger
+	now          func() time.Time
+
+	mutex   *sync.Mutex
+	queries map[string]*TrackedQuery
+}
+
+func NewQueryTracker(conf QueryTrackerConf, sessionStore session.Storage, logger logging.Logger) *QueryTracker {
+	return &QueryTracker{
+		conf:         conf,
+		sessionStore: sessionStore,
+		listeners:    make([]QueryListener, 0),
+		logger:       logger,
+		now:          time.Now,
+		mutex:        &sync.Mutex{},
+		queries:      make(map[string]*TrackedQuery),
+	}
+}
+
+// WithListener registers a listener of the completed queries, the listeners must be registered before
+// the tracker is added to the pool
+func (t *QueryTracker) WithListener(listener QueryListener) *QueryTracker {
+	t.listeners = append(t.listeners, listener)
+	return t
+}
+
+// Interceptor returns the interceptor of the responses of the coordinator, it must be the last interceptor
+// so the bytes counted are the ones sent to the client
+func (t *QueryTracker) Interceptor(coordinatorName string) http2.Interceptor {
+	return queryTrackerInterceptor{
+		tracker:     t,
+		coordinator: coordinatorName,
+	}
+}
+
+// Queries returns the queries in flight, most recent first
+func (t *QueryTracker) Queries() []TrackedQuery {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	queries := make([]TrackedQuery, 0, len(t.queries))
+	for _, q := range t.queries {
+		queries = append(queries, *q)
+	}
+
+	sort.Slice(queries, func(i, j int) bool {
+		if !queries[i].SubmittedAt.Equal(queries[j].SubmittedAt) {
+			return queries[i].SubmittedAt.After(queries[j].SubmittedAt)
+		}
+		return queries[i].QueryID < queries[j].QueryID
+	})
+
+	return queries
+}
+
+// Handler serves the queries in flight, it's meant for debugging
+func (t *QueryTracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(TrackedQueriesResponse{Queries: t.Queries()})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			t.logger.Error("error writing response: %s", err.Error())
+		}
+	})
+}
+
+// Run removes the abandoned queries every SweepInterval until the context is done
+func (t *QueryTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.conf.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.sweep(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *QueryTracker) sweep(ctx context.Context) {
+	now := t.now()
+
+	abandoned := make([]TrackedQuery, 0)
+
+	t.mutex.Lock()
+	for id, q := range t.queries {
+		if now.Sub(q.LastSeenAt) > t.conf.AbandonTimeout {
+			abandoned = append(abandoned, *q)
+			delete(t.queries, id)
+		}
+	}
+	t.mutex.Unlock()
+
+	// the query may be still polled through another proxy instance, only the local copy of the link is evicted
+	// and the shared link expires with the store ttl
+	evictor, _ := t.sessionStore.(session.Evictor)
+
+	for _, q := range abandoned {
+		t.logger.Info("query %s on %s abandoned by the client, last request at %s", q.QueryID, q.Coordinator, q.LastSeenAt.Format(time.RFC3339))
+
+		if evictor == nil {
+			continue
+		}
+
+		info := trino.QueryInfo{QueryID: q.QueryID, User: q.User, TransactionID: q.TransactionID}
+		if err := evictor.Evict(ctx, info); err != nil {
+			t.logger.Warn("error evicting the session of abandoned query %s: %s", q.QueryID, err.Error())
+		}
+	}
+}
+
+// newTrackedQuery creates the query from the request, the routing information is available only when the
+// query is submitted through this proxy instance
+func newTrackedQuery(request *http.Request, queryID string, coordinator string, submittedAt time.Time) *TrackedQuery {
+	info := queryInfoWithID(request, queryID)
+	tracked := &TrackedQuery{
+		QueryID:       queryID,
+		TransactionID: info.TransactionID,
+		User:          info.User,
+		Source:        request.Header.Get(TrinoHeaderSource),
+		ClientTags:    clientTagsFromRequest(request),
+		Coordinator:   coordinator,
+		SubmittedAt:   submittedAt,
+	}
+
+	if trace := requestTraceFromContext(request.Context()); trace != nil {
+		tracked.RoutingRule = trace.rule
+		tracked.UserRule = trace.userRule
+		tracked.query = trace.query
+	}
+
+	if request.ContentLength > 0 {
+		tracked.BytesIn = request.ContentLength
+	}
+
+	return tracked
+}
+
+// submitted registers a query submitted through this proxy instance
+func (t *QueryTracker) submitted(request *http.Request, queryID string, coordinator string, state trino.QueryState) *TrackedQuery {
+	now := t.now()
+	tracked := newTrackedQuery(request, queryID, coordinator, now)
+	tracked.LastSeenAt = now
+	tracked.Requests = 1
+	tracked.State = state.Stats.State
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.queries[queryID] = tracked
+	return tracked
+}
+
+// seen registers a request for the query, unknown queries are added to the registry
+func (t *QueryTracker) seen(request *http.Request, queryID string, coordinator string, state trino.QueryState) *TrackedQuery {
+	now := t.now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tracked, present := t.queries[queryID]
+	if !present {
+		submittedAt := now.Add(-time.Duration(state.Stats.ElapsedTimeMillis) * time.Millisecond)
+		tracked = newTrackedQuery(request, queryID, coordinator, submittedAt)
+		t.queries[queryID] = tracked
+	}
+
+	tracked.LastSeenAt = now
+	tracked.Requests++
+	if len(state.Stats.State) != 0 {
+		tracked.State = state.Stats.State
+	}
+	return tracked
+}
+
+// touch registers a request for a query already tracked, it returns nil for unknown queries
+func (t *QueryTracker) touch(queryID string) *TrackedQuery {
+	now := t.now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tracked, present := t.queries[queryID]
+	if !present {
+		return nil
+	}
+
+	tracked.LastSeenAt = now
+	tracked.Requests++
+	return tracked
+}
+
+// cancel removes a query already tracked from the registry, it returns nil for unknown queries so a query
+// canceled more than once is completed only the first time
+func (t *QueryTracker) cancel(queryID string) *TrackedQuery {
+	now := t.now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tracked, present := t.queries[queryID]
+	if !present {
+		return nil
+	}
+	delete(t.queries, queryID)
+
+	tracked.LastSeenAt = now
+	tracked.Requests++
+	return tracked
+}
+
+// remove removes the query in its final state from the registry, the queries submitted through another proxy
+// instance and never seen before are returned with the information available in the final request
+func (t *QueryTracker) remove(request *http.Request, queryID string, coordinator string, state trino.QueryState) *TrackedQuery {
+	now := t.now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tracked, present := t.queries[queryID]
+	if !present {
+		var submittedAt time.Time
+		if state.Stats.ElapsedTimeMillis > 0 {
+			submittedAt = now.Add(-time.Duration(state.Stats.ElapsedTimeMillis) * time.Millisecond)
+		}
+		tracked = newTrackedQuery(request, queryID, coordinator, submittedAt)
+	}
+	delete(t.queries, queryID)
+
+	tracked.LastSeenAt = now
+	tracked.Requests++
+	return tracked
+}
+
+// completed notifies the listeners, the query has already been removed from the registry
+func (t *QueryTracker) completed(tracked *TrackedQuery, state trino.QueryState, finalState string) {
+	t.mutex.Lock()
+	tracked.State = finalState
+	query := *tracked
+	t.mutex.Unlock()
+
+	t.logger.Debug("query %s on %s completed with state %s", query.QueryID, query.Coordinator, finalState)
+
+	for _, listener := range t.listeners {
+		listener.QueryCompleted(query, state, finalState)
+	}
+}
+
+func (t *QueryTracker) addBytes(tracked *TrackedQuery, bytesOut int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tracked.BytesOut += bytesOut
+}
+
+type queryTrackerInterceptor struct {
+	tracker     *QueryTracker
+	coordinator string
+}
+
+func (i queryTrackerInterceptor) Handle(request *http.Request, response *http.Response) error {
+	if isQuerySubmission(request) {
+		if response.StatusCode != http.StatusOK {
+			return nil
+		}
+
+		state, err := queryStateFromResponse(response)
+		if err != nil {
+			return err
+		}
+
+		tracked := i.tracker.submitted(request, state.ID, i.coordinator, state)
+		if isTerminalState(state) {
+			tracked = i.tracker.remove(request, state.ID, i.coordinator, state)
+		}
+
+		i.countResponse(response, tracked, state, isTerminalState(state))
+		return nil
+	}
+
+	if !isQueryScopedRequest(request) {
+		return nil
+	}
+
+	queryID, _ := queryIDFromPath(request.URL.Path)
+
+	if isQueryCancelRequest(request) {
+		if !isSuccessStatusCode(response.StatusCode) {
+			return nil
+		}
+		if tracked := i.tracker.cancel(queryID); tracked != nil {
+			i.tracker.completed(tracked, trino.QueryState{}, TrinoQueryStatusCanceled)
+		}
+		return nil
+	}
+
+	if isStatementRequest(request.URL) && request.Method == http.MethodGet && response.StatusCode == http.StatusOK {
+		state, err := queryStateFromResponse(response)
+		if err != nil {
+			return err
+		}
+
+		if isTerminalState(state) {
+			i.countResponse(response, i.tracker.remove(request, queryID, i.coordinator, state), state, true)
+			return nil
+		}
+
+		i.countResponse(response, i.tracker.seen(request, queryID, i.coordinator, state), state, false)
+		return nil
+	}
+
+	// the other requests ( e.g. query info ) can be sent also for completed queries, they only keep alive
+	// the queries already tracked
+	if tracked := i.tracker.touch(queryID); tracked != nil {
+		i.countResponse(response, tracked, trino.QueryState{}, false)
+	}
+	return nil
+}
+
+// countResponse counts the bytes sent to the client, the final response completes the query when it has been
+// fully proxied so the listeners receive its size
+func (i queryTrackerInterceptor) countResponse(response *http.Response, tracked *TrackedQuery, state trino.QueryState, final bool) {
+	response.Body = &countingBody{
+		ReadCloser: response.Body,
+		onClose: func(read int64) {
+			i.tracker.addBytes(tracked, read)
+			if final {
+				i.tracker.completed(tracked, state, state.Stats.State)
+			}
+		},
+	}
+}
@@ -0,0 +1,274 @@
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const trackedQueryID = "20200924_102554_02623_yi2gi"
+
+func statementResponse(state string, next bool, elapsedMillis int) *http.Response {
+	nextUri := "null"
+	if next {
+		nextUri = fmt.Sprintf(`"http://trino.local:8889/v1/statement/executing/%s/y1/2"`, trackedQueryID)
+	}
+
+	body := fmt.Sprintf(`{"id":"%s","nextUri":%s,"stats":{"state":"%s","elapsedTimeMillis":%d}}`, trackedQueryID, nextUri, state, elapsedMillis)
+	return &http.Response{StatusCode: http.StatusOK, Body: bodyReadCloser(body)}
+}
+
+func trackerRequest(method string, rawUrl string) *http.Request {
+	headers := http.Header{}
+	headers.Add(TrinoHeaderUser, "test-user")
+	headers.Add(TrinoHeaderTransaction, "test-tx")
+	headers.Add(TrinoHeaderSource, "test-source")
+
+	return &http.Request{Method: method, URL: mustUrl(rawUrl), Header: headers}
+}
+
+func submissionRequest() *http.Request {
+	return trackerRequest(http.MethodPost, "http://trino.local:8889/v1/statement")
+}
+
+func pollingRequest() *http.Request {
+	return trackerRequest(http.MethodGet, fmt.Sprintf("http://trino.local:8889/v1/statement/executing/%s/y1/1", trackedQueryID))
+}
+
+func testTracker(conf QueryTrackerConf) (*QueryTracker, session.Storage, *time.Time) {
+	storage := session.NewMemoryStorage()
+	tracker := NewQueryTracker(conf, storage, logging.Noop())
+
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	return tracker, storage, &now
+}
+
+func TestQueryTrackerFollowsQueryToTerminalState(t *testing.T) {
+	tests := []struct {
+		name       string
+		finalState string
+	}{
+		{name: "finished", finalState: TrinoQueryStatusFinished},
+		{name: "failed", finalState: TrinoQueryStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, _, now := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+			interceptor := tracker.Interceptor("coordinator-0")
+
+			require.NoError(t, interceptor.Handle(submissionRequest(), statementResponse("QUEUED", true, 0)))
+
+			*now = now.Add(time.Second)
+			require.NoError(t, interceptor.Handle(pollingRequest(), statementResponse("RUNNING", true, 1000)))
+
+			queries := tracker.Queries()
+			require.Len(t, queries, 1)
+			require.Equal(t, TrackedQuery{
+				QueryID:       trackedQueryID,
+				TransactionID: "test-tx",
+				User:          "test-user",
+				Source:        "test-source",
+				Coordinator:   "coordinator-0",
+				State:         "RUNNING",
+				SubmittedAt:   time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+				LastSeenAt:    time.Date(2021, 1, 1, 10, 0, 1, 0, time.UTC),
+				Requests:      2,
+			}, queries[0])
+
+			require.NoError(t, interceptor.Handle(pollingRequest(), statementResponse(tt.finalState, false, 2000)))
+			require.Empty(t, tracker.Queries())
+		})
+	}
+}
+
+func TestQueryTrackerCancel(t *testing.T) {
+	tracker, _, _ := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	interceptor := tracker.Interceptor("coordinator-0")
+
+	require.NoError(t, interceptor.Handle(submissionRequest(), statementResponse("QUEUED", true, 0)))
+	require.Len(t, tracker.Queries(), 1)
+
+	cancel := trackerRequest(http.MethodDelete, fmt.Sprintf("http://trino.local:8889/v1/statement/executing/%s/y1/1", trackedQueryID))
+	require.NoError(t, interceptor.Handle(cancel, &http.Response{StatusCode: http.StatusNoContent, Body: bodyReadCloser("")}))
+	require.Empty(t, tracker.Queries())
+}
+
+func TestQueryTrackerAdoptsUnknownQueries(t *testing.T) {
+	tracker, _, _ := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	interceptor := tracker.Interceptor("coordinator-1")
+
+	// the query info requests don't register unknown queries, they are sent also for completed queries
+	info := trackerRequest(http.MethodGet, fmt.Sprintf("http://trino.local:8889/v1/query/%s", trackedQueryID))
+	require.NoError(t, interceptor.Handle(info, &http.Response{StatusCode: http.StatusOK, Body: bodyReadCloser("{}")}))
+	require.Empty(t, tracker.Queries())
+
+	// the query was submitted through another proxy instance, the submission time is estimated from the elapsed time
+	require.NoError(t, interceptor.Handle(pollingRequest(), statementResponse("RUNNING", true, 30000)))
+
+	queries := tracker.Queries()
+	require.Len(t, queries, 1)
+	require.Equal(t, "coordinator-1", queries[0].Coordinator)
+	require.Equal(t, time.Date(2021, 1, 1, 9, 59, 30, 0, time.UTC), queries[0].SubmittedAt)
+
+	require.NoError(t, interceptor.Handle(info, &http.Response{StatusCode: http.StatusOK, Body: bodyReadCloser("{}")}))
+	require.Equal(t, int64(2), tracker.Queries()[0].Requests)
+}
+
+func TestQueryTrackerSweepEvictsAbandonedQueries(t *testing.T) {
+	tracker, storage, now := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	interceptor := tracker.Interceptor("coordinator-0")
+	ctx := context.TODO()
+
+	info := trino.QueryInfo{QueryID: trackedQueryID, TransactionID: "test-tx", User: "test-user"}
+	require.NoError(t, storage.Link(ctx, info, "coordinator-0"))
+
+	require.NoError(t, interceptor.Handle(submissionRequest(), statementResponse("QUEUED", true, 0)))
+
+	*now = now.Add(time.Minute)
+	tracker.sweep(ctx)
+	require.Len(t, tracker.Queries(), 1)
+
+	*now = now.Add(time.Second)
+	tracker.sweep(ctx)
+	require.Empty(t, tracker.Queries())
+
+	_, err := storage.Get(ctx, info)
+	require.True(t, errors.Is(err, session.ErrLinkNotFound))
+}
+
+func TestQueryTrackerSweepKeepsSharedLinks(t *testing.T) {
+	shared := session.NewMemoryStorage()
+	cache := session.NewMemoryStorage()
+	tracker := NewQueryTracker(QueryTrackerConf{AbandonTimeout: time.Minute}, session.NewStorageCache(shared, cache), logging.Noop())
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	info := trino.QueryInfo{QueryID: trackedQueryID, TransactionID: "test-tx", User: "test-user"}
+	require.NoError(t, tracker.sessionStore.Link(ctx, info, "coordinator-0"))
+
+	require.NoError(t, tracker.Interceptor("coordinator-0").Handle(submissionRequest(), statementResponse("QUEUED", true, 0)))
+
+	now = now.Add(2 * time.Minute)
+	tracker.sweep(ctx)
+	require.Empty(t, tracker.Queries())
+
+	_, err := cache.Get(ctx, info)
+	require.True(t, errors.Is(err, session.ErrLinkNotFound))
+
+	// the query can be still polled through another proxy instance
+	coordinator, err := shared.Get(ctx, info)
+	require.NoError(t, err)
+	require.Equal(t, "coordinator-0", coordinator)
+}
+
+type recordingListener struct {
+	queries []TrackedQuery
+	states  []string
+}
+
+func (r *recordingListener) QueryCompleted(query TrackedQuery, state trino.QueryState, finalState string) {
+	r.queries = append(r.queries, query)
+	r.states = append(r.states, finalState)
+}
+
+func TestQueryTrackerNotifiesListeners(t *testing.T) {
+	listener := &recordingListener{}
+	tracker, _, now := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	tracker.WithListener(listener)
+	interceptor := tracker.Interceptor("coordinator-0")
+
+	response := statementResponse("RUNNING", true, 0)
+	require.NoError(t, interceptor.Handle(submissionRequest(), response))
+	require.NoError(t, response.Body.Close())
+
+	*now = now.Add(time.Second)
+	response = statementResponse(TrinoQueryStatusFinished, false, 1000)
+	require.NoError(t, interceptor.Handle(pollingRequest(), response))
+	require.Empty(t, tracker.Queries())
+
+	// the listeners are notified when the final response has been sent to the client
+	require.Empty(t, listener.queries)
+	content, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+
+	require.Len(t, listener.queries, 1)
+	require.Equal(t, []string{TrinoQueryStatusFinished}, listener.states)
+
+	query := listener.queries[0]
+	require.Equal(t, trackedQueryID, query.QueryID)
+	require.Equal(t, int64(2), query.Requests)
+	require.Equal(t, int64(len(content)), query.BytesOut)
+	require.Equal(t, time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC), query.SubmittedAt)
+}
+
+func TestQueryTrackerNotifiesCancelOnce(t *testing.T) {
+	listener := &recordingListener{}
+	tracker, _, _ := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	tracker.WithListener(listener)
+	interceptor := tracker.Interceptor("coordinator-0")
+
+	response := statementResponse("RUNNING", true, 0)
+	require.NoError(t, interceptor.Handle(submissionRequest(), response))
+	require.NoError(t, response.Body.Close())
+
+	cancel := trackerRequest(http.MethodDelete, fmt.Sprintf("http://trino.local:8889/v1/statement/executing/%s/y1/1", trackedQueryID))
+	require.NoError(t, interceptor.Handle(cancel, &http.Response{StatusCode: http.StatusNoContent, Body: bodyReadCloser("")}))
+	require.Equal(t, []string{TrinoQueryStatusCanceled}, listener.states)
+
+	// the query is no longer tracked, a second cancel must not be notified again
+	kill := trackerRequest(http.MethodPut, fmt.Sprintf("http://trino.local:8889/v1/query/%s/killed", trackedQueryID))
+	require.NoError(t, interceptor.Handle(kill, &http.Response{StatusCode: http.StatusOK, Body: bodyReadCloser("")}))
+	require.Len(t, listener.queries, 1)
+	require.Empty(t, tracker.Queries())
+}
+
+func TestQueryTrackerHandler(t *testing.T) {
+	tracker, _, _ := testTracker(QueryTrackerConf{AbandonTimeout: time.Minute})
+	interceptor := tracker.Interceptor("coordinator-0")
+
+	require.NoError(t, interceptor.Handle(submissionRequest(), statementResponse("QUEUED", true, 0)))
+
+	recorder := httptest.NewRecorder()
+	tracker.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/proxy/queries", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var response TrackedQueriesResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Len(t, response.Queries, 1)
+	require.Equal(t, trackedQueryID, response.Queries[0].QueryID)
+	require.Equal(t, "QUEUED", response.Queries[0].State)
+}
+
+func TestQueryClusterLinkerUnlinksFailedQueries(t *testing.T) {
+	storage := session.NewMemoryStorage()
+	linker := NewQueryClusterLinker(storage, "coordinator-0")
+	ctx := context.TODO()
+
+	info := trino.QueryInfo{QueryID: trackedQueryID, TransactionID: "test-tx", User: "test-user"}
+	require.NoError(t, storage.Link(ctx, info, "coordinator-0"))
+
+	require.NoError(t, linker.Handle(pollingRequest().WithContext(ctx), statementResponse("RUNNING", true, 1000)))
+	_, err := storage.Get(ctx, info)
+	require.NoError(t, err)
+
+	require.NoError(t, linker.Handle(pollingRequest().WithContext(ctx), statementResponse(TrinoQueryStatusFailed, false, 2000)))
+	_, err = storage.Get(ctx, info)
+	require.True(t, errors.Is(err, session.ErrLinkNotFound))
+}
@@ -0,0 +1,167 @@
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// HeaderRoute contains the explanation of the routing decision when the route header is enabled
+	HeaderRoute = "X-Trino-LB-Route"
+
+	ExclusionUnhealthy = "unhealthy"
+	ExclusionEjected   = "ejected"
+	// ExclusionRetried is reported for the coordinators that already failed the submission
+	ExclusionRetried = "retried"
+)
+
+type CoordinatorExclusion struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// RouteExplanation describes the routing of a request, the coordinators of the pool not considered by
+// the router are reported with the exclusion reason
+type RouteExplanation struct {
+	routing.Explanation
+	Excluded []CoordinatorExclusion `json:"excluded"`
+}
+
+// Header formats the explanation as a single line
+func (e RouteExplanation) Header() string {
+	excluded := make([]string, len(e.Excluded))
+	for i, exclusion := range e.Excluded {
+		excluded[i] = exclusion.Name + ":" + exclusion.Reason
+	}
+
+	parts := []string{
+		"user_rule=" + e.UserRule,
+		"candidates=" + strings.Join(e.Candidates, ","),
+		"matching=" + strings.Join(e.Matching, ","),
+		"excluded=" + strings.Join(excluded, ","),
+		fmt.Sprintf("default_fallback=%t", e.DefaultFallback),
+	}
+
+	if len(e.StatementRule) != 0 {
+		parts = append(parts,
+			"statement_rule="+e.StatementRule,
+			"statement_matching="+strings.Join(e.StatementMatching, ","),
+			fmt.Sprintf("statement_fallback=%t", e.StatementFallback),
+		)
+	}
+
+	parts = append(parts, "rule="+e.Rule)
+
+	if len(e.Scores) != 0 {
+		scores := make([]string, len(e.Scores))
+		for i, score := range e.Scores {
+			scores[i] = fmt.Sprintf("%s:%.3f", score.Name, score.Score)
+			if score.Stale {
+				scores[i] += ":stale"
+			}
+		}
+		parts = append(parts, "scores="+strings.Join(scores, ","))
+	}
+
+	parts = append(parts, "coordinator="+e.Coordinator)
+
+	if len(e.Error) != 0 {
+		parts = append(parts, "error="+e.Error)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+type ExplainRequest struct {
+	User          string            `json:"user"`
+	Headers       map[string]string `json:"headers"`
+	Statement     string            `json:"statement"`
+	ClientAddress string            `json:"client_address"`
+}
+
+// explainExclusions returns the coordinators of the pool excluded from the routing and the reason
+func explainExclusions(all []CoordinatorRef, healthy []CoordinatorRef, retried []string) []CoordinatorExclusion {
+	exclusions := make([]CoordinatorExclusion, 0)
+	for _, c := range all {
+		switch {
+		case containsName(retried, c.Name):
+			exclusions = append(exclusions, CoordinatorExclusion{Name: c.Name, Reason: ExclusionRetried})
+		case c.Ejection.Ejected:
+			exclusions = append(exclusions, CoordinatorExclusion{Name: c.Name, Reason: ExclusionEjected})
+		case !containsRef(healthy, c.Name):
+			exclusions = append(exclusions, CoordinatorExclusion{Name: c.Name, Reason: ExclusionUnhealthy})
+		}
+	}
+
+	sort.Slice(exclusions, func(i, j int) bool {
+		return exclusions[i].Name < exclusions[j].Name
+	})
+	return exclusions
+}
+
+func containsRef(refs []CoordinatorRef, name string) bool {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ExplainHandler routes a simulated query submission with the current router and pool and returns the
+// explanation of the decision, the query is not sent to the coordinator
+func (p *Proxy) ExplainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ExplainRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		submission, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/v1/statement", strings.NewReader(req.Statement))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for name, value := range req.Headers {
+			submission.Header.Set(name, value)
+		}
+
+		if len(req.User) != 0 {
+			submission.Header.Set(TrinoHeaderUser, req.User)
+		}
+
+		submission.RemoteAddr = req.ClientAddress
+
+		submission, trace := withRequestTrace(submission)
+		trace.query = req.Statement
+
+		// the simulation doesn't update the state of the routing rule and it's not recorded in the metrics
+		_, explanation, _ := p.explainDecision(submission, nil, p.queryRouter().Simulate)
+		writeJson(w, explanation, p.logger)
+	})
+}
+
+func writeJson(w http.ResponseWriter, value interface{}, logger logging.Logger) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		logger.Error("error writing response: %s", err.Error())
+	}
+}
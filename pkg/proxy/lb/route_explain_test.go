@@ -0,0 +1,160 @@
+package lb
+
+import (
+	"encoding/json"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/healthcheck"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/metrics"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/routing"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unhealthyHosts reports as unhealthy the coordinators with the given hosts
+type unhealthyHosts []string
+
+func (u unhealthyHosts) Check(coordinator *url.URL) (healthcheck.Health, error) {
+	status := healthcheck.StatusHealthy
+	if containsName(u, coordinator.Host) {
+		status = healthcheck.StatusUnhealthy
+	}
+	return healthcheck.Health{Status: status, Timestamp: time.Now()}, nil
+}
+
+func explainTestProxy(t *testing.T, conf ProxyConf, coordinatorURL string) *Proxy {
+	sessStore := session.NewMemoryStorage()
+	logger := logging.Noop()
+	pool := NewPool(PoolConfigTest(), sessStore, unhealthyHosts{"trino-2.local:8080"}, trino.Noop(), logger)
+
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-0", URL: mustUrl(coordinatorURL), Tags: map[string]string{"workload": "etl"}, Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-1", URL: mustUrl("http://trino-1.local:8080"), Tags: map[string]string{"workload": "bi"}, Enabled: true}))
+	require.NoError(t, pool.Add(models.Coordinator{Name: "cluster-2", URL: mustUrl("http://trino-2.local:8080"), Tags: map[string]string{"workload": "etl"}, Enabled: true}))
+
+	router := routing.New(routing.NewUserAwareRouter(routing.UserAwareRoutingConf{
+		Default: routing.UserAwareDefault{Behaviour: routing.NoMatchBehaviourForbid},
+		Rules: []routing.UserAwareRoutingRule{
+			{User: regexp.MustCompile("etl-(.+)"), Cluster: routing.UserAwareClusterMatchRule{Tags: map[string]string{"workload": "etl"}}},
+		},
+	}), routing.RoundRobin())
+
+	return NewProxy(conf, pool, NoOpSync{}, sessStore, router, RequestReWriters(), logger)
+}
+
+func explain(t *testing.T, proxy *Proxy, body string) RouteExplanation {
+	recorder := httptest.NewRecorder()
+	proxy.ExplainHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/routing/explain", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var explanation RouteExplanation
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &explanation))
+	return explanation
+}
+
+func TestProxyExplainHandler(t *testing.T) {
+	proxy := explainTestProxy(t, ProxyConf{SyncDelay: time.Hour}, "http://trino-0.local:8080")
+
+	explanation := explain(t, proxy, `{"user": "etl-daily", "headers": {"X-Trino-Source": "airflow"}, "statement": "select 1"}`)
+
+	require.Equal(t, "etl-daily", explanation.User)
+	require.Equal(t, "etl-(.+)", explanation.UserRule)
+	require.Equal(t, []string{"cluster-0", "cluster-1"}, explanation.Candidates)
+	require.Equal(t, []string{"cluster-0"}, explanation.Matching)
+	require.Equal(t, []CoordinatorExclusion{{Name: "cluster-2", Reason: ExclusionUnhealthy}}, explanation.Excluded)
+	require.Equal(t, "round-robin", explanation.Rule)
+	require.Equal(t, "cluster-0", explanation.Coordinator)
+	require.Empty(t, explanation.Error)
+
+	// the routing errors are part of the explanation
+	explanation = explain(t, proxy, `{"user": "analyst"}`)
+	require.Equal(t, "", explanation.Coordinator)
+	require.Contains(t, explanation.Error, routing.ErrForbiddenRouting.Error())
+
+	recorder := httptest.NewRecorder()
+	proxy.ExplainHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/routing/explain", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	proxy.ExplainHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/routing/explain", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func routingDecisionsTotal(t *testing.T) float64 {
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != "trino_lb_routing_decisions_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue()
+		}
+	}
+	return total
+}
+
+func TestProxyExplainHandlerIsNotRecorded(t *testing.T) {
+	proxy := explainTestProxy(t, ProxyConf{SyncDelay: time.Hour}, "http://trino-0.local:8080")
+
+	before := routingDecisionsTotal(t)
+	explanation := explain(t, proxy, `{"user": "etl-daily"}`)
+	require.Equal(t, "cluster-0", explanation.Coordinator)
+	require.Equal(t, before, routingDecisionsTotal(t))
+}
+
+func TestProxyRouteHeader(t *testing.T) {
+	coordinator := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte(`{"id":"20200924_102554_00000_yi2gi","nextUri":"http://coordinator.local/v1/statement/queued/20200924_102554_00000_yi2gi/y1/1"}`))
+	}))
+	defer coordinator.Close()
+
+	for _, enabled := range []bool{true, false} {
+		proxy := explainTestProxy(t, ProxyConf{SyncDelay: time.Hour, RouteHeader: enabled}, coordinator.URL)
+
+		srv := httptest.NewServer(http.HandlerFunc(proxy.Handle))
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/statement", strings.NewReader("select 1"))
+		require.NoError(t, err)
+		req.Header.Set(TrinoHeaderUser, "etl-daily")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		if enabled {
+			require.Equal(t, "user_rule=etl-(.+); candidates=cluster-0,cluster-1; matching=cluster-0; excluded=cluster-2:unhealthy; default_fallback=false; rule=round-robin; coordinator=cluster-0",
+				res.Header.Get(HeaderRoute))
+		} else {
+			require.Empty(t, res.Header.Get(HeaderRoute))
+		}
+
+		srv.Close()
+	}
+}
+
+func TestRouteExplanationHeaderScores(t *testing.T) {
+	explanation := RouteExplanation{
+		Explanation: routing.Explanation{
+			UserRule:    "default",
+			Candidates:  []string{"cluster-0", "cluster-1"},
+			Matching:    []string{"cluster-0", "cluster-1"},
+			Rule:        "load-score",
+			Scores:      []routing.CoordinatorScore{{Name: "cluster-0", Score: 0.25}, {Name: "cluster-1", Score: 1000, Stale: true}},
+			Coordinator: "cluster-0",
+		},
+	}
+
+	require.Equal(t, "user_rule=default; candidates=cluster-0,cluster-1; matching=cluster-0,cluster-1; excluded=; default_fallback=false; rule=load-score; scores=cluster-0:0.250,cluster-1:1000.000:stale; coordinator=cluster-0",
+		explanation.Header())
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/session"
 	"io"
@@ -21,6 +23,13 @@ const (
 const (
 	TrinoDefaultTransactionID = "NONE"
 	TrinoQueryStatusFinished  = "FINISHED"
+	TrinoQueryStatusFailed    = "FAILED"
+)
+
+const partialCancelSegment = "partialCancel"
+
+var (
+	ErrInvalidQueryRequest = errors.New("unable to extract query id from request")
 )
 
 type QueryClusterLinker struct {
@@ -48,105 +57,224 @@ func (q QueryClusterLinker) Handle(request *http.Request, response *http.Respons
 		return q.storage.Link(request.Context(), queryInfo, q.coordinatorName)
 	}
 
-	// todo we can simplify this nested if with a fail fast
-	if isStatementRequest(request.URL) && request.Method == http.MethodGet {
-		state, err := queryStateFromResponse(response)
+	// a successfully cancelled query will never be requested again, we can remove its link
+	if isQueryCancelRequest(request) && isSuccessStatusCode(response.StatusCode) {
+		queryInfo, err := queryInfoFromRequest(request)
 		if err != nil {
 			return err
 		}
 
-		if state.NextURI == nil {
-			queryInfo, err := QueryInfoFromResponse(request, response)
-			if err != nil {
-				return err
-			}
-
-			if state.Stats.State == TrinoQueryStatusFinished {
-				err = q.storage.Unlink(request.Context(), queryInfo)
-				return err
-			}
-			return nil
-		}
+		return q.storage.Unlink(request.Context(), queryInfo)
 	}
 
-	return nil
-}
+	if !isStatementRequest(request.URL) || request.Method != http.MethodGet || response.StatusCode != http.StatusOK {
+		return nil
+	}
 
-func QueryInfoFromResponse(req *http.Request, res *http.Response) (trino.QueryInfo, error) {
-	user := req.Header.Get(TrinoHeaderUser)
-	tx := req.Header.Get(TrinoHeaderTransaction)
+	state, err := queryStateFromResponse(response)
+	if err != nil {
+		return err
+	}
 
-	if len(tx) == 0 {
-		tx = TrinoDefaultTransactionID
+	// the response without a next uri is the last one of the query whatever is the final state
+	// ( FINISHED, FAILED, CANCELED ), the query will never be requested again
+	if !isTerminalState(state) {
+		return nil
 	}
 
+	return q.storage.Unlink(request.Context(), queryInfoWithID(request, state.ID))
+}
+
+func isTerminalState(state trino.QueryState) bool {
+	return state.NextURI == nil
+}
+
+func QueryInfoFromResponse(req *http.Request, res *http.Response) (trino.QueryInfo, error) {
 	queryState, err := queryStateFromResponse(res)
 	if err != nil {
 		return trino.QueryInfo{}, err
 	}
 
+	return queryInfoWithID(req, queryState.ID), nil
+}
+
+func queryInfoWithID(req *http.Request, queryID string) trino.QueryInfo {
+	tx := req.Header.Get(TrinoHeaderTransaction)
+	if len(tx) == 0 {
+		tx = TrinoDefaultTransactionID
+	}
+
 	return trino.QueryInfo{
-		QueryID:       queryState.ID,
-		User:          user,
+		QueryID:       queryID,
+		User:          req.Header.Get(TrinoHeaderUser),
 		TransactionID: tx,
-	}, nil
+	}
 }
 
 func queryStateFromResponse(res *http.Response) (trino.QueryState, error) {
-	resp, err := io.ReadAll(res.Body)
+	body, err := decodeResponse(res)
 	if err != nil {
 		return trino.QueryState{}, err
 	}
+	return body.state, nil
+}
 
-	var jsonBody = resp
-	if isGzip(jsonBody) {
-		reader, err := gzip.NewReader(bytes.NewBuffer(jsonBody))
-		if err != nil {
-			return trino.QueryState{}, err
-		}
+// decodedBody is a response body already decoded by an interceptor, the following interceptors of the same
+// response reuse the decoded content instead of reading and parsing the body again
+type decodedBody struct {
+	io.Reader
+	// content is the body as received, json is its uncompressed content
+	content []byte
+	json    []byte
+	state   trino.QueryState
+}
 
-		jsonBody, err = io.ReadAll(reader)
-		if err != nil {
-			return trino.QueryState{}, err
-		}
+func newDecodedBody(content []byte, json []byte, state trino.QueryState) *decodedBody {
+	return &decodedBody{
+		Reader:  bytes.NewReader(content),
+		content: content,
+		json:    json,
+		state:   state,
+	}
+}
+
+func (d *decodedBody) Close() error {
+	return nil
+}
+
+// decodeResponse reads the query state from the response body, the body is replaced with a decodedBody
+// so it can be read again by the client and shared with the other interceptors
+func decodeResponse(res *http.Response) (*decodedBody, error) {
+	if body, ok := res.Body.(*decodedBody); ok {
+		return body, nil
+	}
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBody, err := decodeBody(content)
+	if err != nil {
+		return nil, err
 	}
 
 	var queryState trino.QueryState
 	if err := json.Unmarshal(jsonBody, &queryState); err != nil {
-		return trino.QueryState{}, err
+		return nil, err
 	}
 
-	// Reset response Body ReadCloser to be read again, this should be transparent but we may need
-	// to do further checks or better way to reset a ReadCloser
-	res.Body = io.NopCloser(bytes.NewBuffer(resp))
-	return queryState, nil
+	body := newDecodedBody(content, jsonBody, queryState)
+	res.Body = body
+	return body, nil
+}
+
+// decodeBody returns the uncompressed content of a response body, gzip compressed bodies are detected
+// using the content magic number so we don't rely on the Content-Encoding header
+func decodeBody(content []byte) ([]byte, error) {
+	if !isGzip(content) {
+		return content, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewBuffer(content))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(reader)
 }
 
 func queryInfoFromRequest(req *http.Request) (trino.QueryInfo, error) {
-	user := req.Header.Get(TrinoHeaderUser)
-	tx := req.Header.Get(TrinoHeaderTransaction)
+	queryID, ok := queryIDFromPath(req.URL.Path)
+	if !ok {
+		return trino.QueryInfo{}, fmt.Errorf("%w: %s", ErrInvalidQueryRequest, req.URL.Path)
+	}
 
-	if len(tx) == 0 {
-		tx = TrinoDefaultTransactionID
+	return queryInfoWithID(req, queryID), nil
+}
+
+// queryIDFromPath extract the query id from both /v1/statement/{queued|executing}/{id}/... and /v1/query/{id}/... paths,
+// the partial cancel paths /v1/statement/[executing/]partialCancel/{id}/... are supported as well
+func queryIDFromPath(path string) (string, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 4 {
+		return "", false
 	}
 
-	path := strings.Split(req.URL.Path, "/")
-	var queryID = path[3]
+	var next = 4
+	var queryID = parts[3]
 	if queryID == "queued" || queryID == "executing" {
-		queryID = path[4]
+		if len(parts) <= next {
+			return "", false
+		}
+		queryID = parts[next]
+		next++
 	}
 
-	return trino.QueryInfo{
-		QueryID:       queryID,
-		User:          user,
-		TransactionID: tx,
-	}, nil
+	if queryID == partialCancelSegment {
+		if len(parts) <= next {
+			return "", false
+		}
+		queryID = parts[next]
+	}
+
+	return queryID, len(queryID) != 0
+}
+
+// isPartialCancelRequest returns true for the partial cancel of a query stage, the query itself keeps running
+func isPartialCancelRequest(url *url.URL) bool {
+	if !isStatementRequest(url) {
+		return false
+	}
+
+	parts := strings.Split(url.Path, "/")
+	return (len(parts) > 3 && parts[3] == partialCancelSegment) ||
+		(len(parts) > 4 && parts[3] == "executing" && parts[4] == partialCancelSegment)
 }
 
 func isStatementRequest(url *url.URL) bool {
 	return strings.HasPrefix(url.Path, "/v1/statement")
 }
 
+func isQuerySubmission(req *http.Request) bool {
+	return req.Method == http.MethodPost && strings.TrimSuffix(req.URL.Path, "/") == "/v1/statement"
+}
+
+func isQueryRequest(url *url.URL) bool {
+	return strings.HasPrefix(url.Path, "/v1/query/")
+}
+
+// isQueryScopedRequest returns true if the request refers to an already submitted query, those requests
+// must be served by the coordinator that is running the query
+func isQueryScopedRequest(req *http.Request) bool {
+	if isStatementRequest(req.URL) {
+		if req.Method == http.MethodPost {
+			return false
+		}
+		_, ok := queryIDFromPath(req.URL.Path)
+		return ok
+	}
+
+	if isQueryRequest(req.URL) {
+		_, ok := queryIDFromPath(req.URL.Path)
+		return ok
+	}
+
+	return false
+}
+
+func isQueryCancelRequest(req *http.Request) bool {
+	if req.Method == http.MethodDelete {
+		return isQueryScopedRequest(req) && !isPartialCancelRequest(req.URL)
+	}
+
+	return req.Method == http.MethodPut && isQueryRequest(req.URL) && strings.HasSuffix(req.URL.Path, "/killed")
+}
+
+func isSuccessStatusCode(code int) bool {
+	return code >= 200 && code < 300
+}
+
 func isGzip(content []byte) bool {
 	if len(content) < 2 {
 		return false
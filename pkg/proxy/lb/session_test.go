@@ -55,6 +55,97 @@ func TestExtractQueryInfoFromRequest(t *testing.T) {
 	}
 }
 
+func TestIsQueryScopedRequest(t *testing.T) {
+	scoped := []*http.Request{
+		{Method: http.MethodGet, URL: mustUrl("http://trino.local:8889/v1/statement/executing/20200924_102554_02623_yi2gi/y1/1")},
+		{Method: http.MethodHead, URL: mustUrl("http://trino.local:8889/v1/statement/queued/20200924_102554_02623_yi2gi/y1/1")},
+		{Method: http.MethodDelete, URL: mustUrl("http://trino.local:8889/v1/statement/executing/20200924_102554_02623_yi2gi/y1/1")},
+		{Method: http.MethodGet, URL: mustUrl("http://trino.local:8889/v1/query/20200924_102554_02623_yi2gi")},
+		{Method: http.MethodDelete, URL: mustUrl("http://trino.local:8889/v1/query/20200924_102554_02623_yi2gi")},
+		{Method: http.MethodPut, URL: mustUrl("http://trino.local:8889/v1/query/20200924_102554_02623_yi2gi/killed")},
+	}
+
+	notScoped := []*http.Request{
+		{Method: http.MethodPost, URL: mustUrl("http://trino.local:8889/v1/statement")},
+		{Method: http.MethodGet, URL: mustUrl("http://trino.local:8889/v1/statement")},
+		{Method: http.MethodGet, URL: mustUrl("http://trino.local:8889/v1/query")},
+		{Method: http.MethodGet, URL: mustUrl("http://trino.local:8889/v1/query/")},
+		{Method: http.MethodGet, URL: mustUrl("http://trino.local:8889/v1/info")},
+	}
+
+	for _, r := range scoped {
+		require.True(t, isQueryScopedRequest(r), r.URL.String())
+	}
+	for _, r := range notScoped {
+		require.False(t, isQueryScopedRequest(r), r.URL.String())
+	}
+}
+
+func TestIsQueryCancelRequest(t *testing.T) {
+	require.True(t, isQueryCancelRequest(&http.Request{Method: http.MethodDelete, URL: mustUrl("http://trino.local/v1/statement/executing/20200924_102554_02623_yi2gi/y1/1")}))
+	require.True(t, isQueryCancelRequest(&http.Request{Method: http.MethodDelete, URL: mustUrl("http://trino.local/v1/query/20200924_102554_02623_yi2gi")}))
+	require.True(t, isQueryCancelRequest(&http.Request{Method: http.MethodPut, URL: mustUrl("http://trino.local/v1/query/20200924_102554_02623_yi2gi/killed")}))
+	require.False(t, isQueryCancelRequest(&http.Request{Method: http.MethodGet, URL: mustUrl("http://trino.local/v1/query/20200924_102554_02623_yi2gi")}))
+	require.False(t, isQueryCancelRequest(&http.Request{Method: http.MethodDelete, URL: mustUrl("http://trino.local/v1/statement")}))
+}
+
+func TestPartialCancelRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{
+			name: "executing partial cancel",
+			url:  "http://trino.local/v1/statement/executing/partialCancel/20200924_102554_02623_yi2gi/1/y1/1",
+		},
+		{
+			name: "legacy partial cancel",
+			url:  "http://trino.local/v1/statement/partialCancel/20200924_102554_02623_yi2gi/1/y1/1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{Method: http.MethodDelete, URL: mustUrl(tt.url)}
+
+			queryID, ok := queryIDFromPath(req.URL.Path)
+			require.True(t, ok)
+			require.Equal(t, "20200924_102554_02623_yi2gi", queryID)
+
+			require.True(t, isPartialCancelRequest(req.URL))
+			require.True(t, isQueryScopedRequest(req))
+			require.False(t, isQueryCancelRequest(req))
+		})
+	}
+}
+
+func TestExtractQueryInfoFromQueryRequest(t *testing.T) {
+	urls := []string{
+		"http://trino.local:8889/v1/query/20200924_102554_02623_yi2gi",
+		"http://trino.local:8889/v1/query/20200924_102554_02623_yi2gi/killed",
+		"http://trino.local:8889/v1/statement/queued/20200924_102554_02623_yi2gi/y1/1",
+		"http://trino.local:8889/v1/statement/executing/20200924_102554_02623_yi2gi/y1/1",
+	}
+
+	for _, u := range urls {
+		queryInfo, err := queryInfoFromRequest(&http.Request{
+			Method: http.MethodDelete,
+			URL:    mustUrl(u),
+			Header: http.Header{},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "20200924_102554_02623_yi2gi", queryInfo.QueryID)
+		require.Equal(t, TrinoDefaultTransactionID, queryInfo.TransactionID)
+	}
+
+	_, err := queryInfoFromRequest(&http.Request{
+		Method: http.MethodGet,
+		URL:    mustUrl("http://trino.local:8889/v1/statement"),
+		Header: http.Header{},
+	})
+	require.ErrorIs(t, err, ErrInvalidQueryRequest)
+}
+
 func TestExtractQueryInfoFromResponse(t *testing.T) {
 
 	body := `{"id":"20200924_095706_01798_yi2gi","infoUri":"http://localhost:8080/ui/query.html?20200924_095706_01798_yi2gi","nextUri":"http://localhost:8080/v1/statement/20200924_095706_01798_yi2gi/1?slug=xc7951ca2b9124141a6baa68448edb219","stats":{"state":"QUEUED","queued":true,"scheduled":false,"nodes":0,"totalSplits":0,"queuedSplits":0,"runningSplits":0,"completedSplits":0,"cpuTimeMillis":0,"wallTimeMillis":0,"queuedTimeMillis":0,"elapsedTimeMillis":0,"processedRows":0,"processedBytes":0,"peakMemoryBytes":0,"spilledBytes":0},"warnings":[]}`
@@ -82,6 +173,39 @@ func TestExtractQueryInfoFromResponse(t *testing.T) {
 
 }
 
+func TestQueryStateDecodedOncePerResponse(t *testing.T) {
+	body := `{"id":"20200924_095706_01798_yi2gi","stats":{"state":"RUNNING"}}`
+	source := &countingReadCloser{ReadCloser: bodyReadCloser(body)}
+	res := &http.Response{StatusCode: http.StatusOK, Body: source}
+
+	first, err := queryStateFromResponse(res)
+	require.NoError(t, err)
+
+	second, err := queryStateFromResponse(res)
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.Equal(t, "RUNNING", second.Stats.State)
+
+	// the body has been read once from the coordinator and it's still readable by the client
+	require.Equal(t, 1, source.reads)
+	content, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(content))
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	reads int
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if err == io.EOF {
+		c.reads++
+	}
+	return n, err
+}
+
 func mustUrl(raw string) *url.URL {
 	parsed, err := url.Parse(raw)
 	if err != nil {
@@ -0,0 +1,240 @@
+package lb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	HeaderForwardedProto = "X-Forwarded-Proto"
+	HeaderForwardedHost  = "X-Forwarded-Host"
+	HeaderForwardedPort  = "X-Forwarded-Port"
+	HeaderLocation       = "Location"
+)
+
+// query state fields that contain an uri pointing to the coordinator
+var queryStateUriFields = []string{"nextUri", "infoUri", "partialCancelUri"}
+
+// query state fields that contain an uri used by the client to interact with the query
+var queryStateAffinityFields = map[string]bool{"nextUri": true, "partialCancelUri": true}
+
+type UriRewriteConf struct {
+	Enabled bool
+	// PublicURL is the address used by the clients to reach the load balancer, when nil the address is
+	// built from the X-Forwarded-* headers or from the request Host
+	PublicURL *url.URL
+	// Affinity when enabled adds a signed coordinator token to the query uris
+	Affinity AffinityConf
+}
+
+// PublicUriRewriter Intercepts call to HttpProxy and rewrites the uris returned by the coordinator to the load balancer
+// public address, this way clients always come back through the load balancer even if the coordinator is reachable
+// from them.
+type PublicUriRewriter struct {
+	publicURL       *url.URL
+	coordinator     *url.URL
+	coordinatorName string
+	affinity        *AffinitySigner
+}
+
+func NewPublicUriRewriter(publicURL *url.URL, coordinator *url.URL) PublicUriRewriter {
+	return PublicUriRewriter{
+		publicURL:   publicURL,
+		coordinator: coordinator,
+	}
+}
+
+// WithAffinity returns a rewriter that adds to the query uris a token signed with the provided signer that binds
+// the query to the coordinator
+func (p PublicUriRewriter) WithAffinity(signer AffinitySigner, coordinatorName string) PublicUriRewriter {
+	p.affinity = &signer
+	p.coordinatorName = coordinatorName
+	return p
+}
+
+func (p PublicUriRewriter) Handle(request *http.Request, response *http.Response) error {
+	public := p.publicAddress(request)
+	if public == nil {
+		return nil
+	}
+
+	if location := response.Header.Get(HeaderLocation); len(location) != 0 {
+		rewritten, err := p.rewriteLocation(location, public)
+		if err != nil {
+			return err
+		}
+		response.Header.Set(HeaderLocation, rewritten)
+	}
+
+	if !isStatementRequest(request.URL) || response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	return p.rewriteQueryState(response, public)
+}
+
+// rewriteLocation rewrites only redirects to the coordinator itself, redirects to other hosts (eg. oauth providers)
+// are left untouched
+func (p PublicUriRewriter) rewriteLocation(location string, public *url.URL) (string, error) {
+	uri, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	if !uri.IsAbs() || p.coordinator == nil || uri.Host != p.coordinator.Host {
+		return location, nil
+	}
+
+	return rewriteUri(uri, public).String(), nil
+}
+
+func (p PublicUriRewriter) rewriteQueryState(response *http.Response, public *url.URL) error {
+	decoded, err := decodeResponse(response)
+	if err != nil {
+		return err
+	}
+
+	// the state is parsed again as raw fields to rewrite the uris keeping the fields unknown to the proxy
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(decoded.json, &state); err != nil {
+		return err
+	}
+
+	queryID := decoded.state.ID
+
+	changed := false
+	for _, field := range queryStateUriFields {
+		value, present := state[field]
+		if !present {
+			continue
+		}
+
+		var rawUri *string
+		if err := json.Unmarshal(value, &rawUri); err != nil {
+			return err
+		}
+
+		if rawUri == nil {
+			continue
+		}
+
+		uri, err := url.Parse(*rawUri)
+		if err != nil {
+			return err
+		}
+
+		if !uri.IsAbs() {
+			continue
+		}
+
+		uri = rewriteUri(uri, public)
+		if p.affinity != nil && queryStateAffinityFields[field] && len(queryID) != 0 {
+			uri = withAffinityToken(uri, p.affinity.Sign(queryID, p.coordinatorName))
+		}
+
+		rewritten, err := json.Marshal(uri.String())
+		if err != nil {
+			return err
+		}
+
+		state[field] = rewritten
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	rewritten, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	body := rewritten
+	if isGzip(decoded.content) {
+		if body, err = gzipContent(rewritten); err != nil {
+			return err
+		}
+	}
+
+	// the decoded state keeps the coordinator uris, the other interceptors only check if they are present
+	response.Body = newDecodedBody(body, rewritten, decoded.state)
+	response.ContentLength = int64(len(body))
+	response.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func (p PublicUriRewriter) publicAddress(request *http.Request) *url.URL {
+	if p.publicURL != nil {
+		return p.publicURL
+	}
+
+	return forwardedAddress(request)
+}
+
+// forwardedAddress retrieves the address used by the client from the X-Forwarded-* headers falling back
+// to the request Host when no header is present
+func forwardedAddress(request *http.Request) *url.URL {
+	scheme := firstHeaderValue(request.Header.Get(HeaderForwardedProto))
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+
+	host := firstHeaderValue(request.Header.Get(HeaderForwardedHost))
+	if len(host) == 0 {
+		host = request.Host
+	}
+
+	if len(host) == 0 {
+		return nil
+	}
+
+	port := firstHeaderValue(request.Header.Get(HeaderForwardedPort))
+	if _, _, err := net.SplitHostPort(host); err != nil && len(port) != 0 && !isDefaultPort(scheme, port) {
+		host = net.JoinHostPort(host, port)
+	}
+
+	return &url.URL{
+		Scheme: scheme,
+		Host:   host,
+	}
+}
+
+func rewriteUri(uri *url.URL, public *url.URL) *url.URL {
+	rewritten := *uri
+	rewritten.Scheme = public.Scheme
+	rewritten.Host = public.Host
+	if prefix := strings.TrimSuffix(public.Path, "/"); len(prefix) != 0 {
+		rewritten.Path = prefix + uri.Path
+		rewritten.RawPath = ""
+	}
+	return &rewritten
+}
+
+func firstHeaderValue(value string) string {
+	return strings.TrimSpace(strings.Split(value, ",")[0])
+}
+
+func isDefaultPort(scheme string, port string) bool {
+	return scheme == "http" && port == "80" || scheme == "https" && port == "443"
+}
+
+func gzipContent(content []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,208 @@
+package lb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+const queryStateBody = `{"id":"20200924_095706_01798_yi2gi","infoUri":"http://coordinator.internal:8080/ui/query.html?20200924_095706_01798_yi2gi","nextUri":"http://coordinator.internal:8080/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1","partialCancelUri":null,"stats":{"state":"QUEUED"},"warnings":[]}`
+
+func TestPublicUriRewriterConfiguredAddress(t *testing.T) {
+	rewriter := NewPublicUriRewriter(mustUrl("https://trino.example.com"), mustUrl("http://coordinator.internal:8080"))
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    mustUrl("http://coordinator.internal:8080/v1/statement"),
+		Host:   "lb.local:8998",
+		Header: http.Header{},
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       bodyReadCloser(queryStateBody),
+	}
+
+	require.NoError(t, rewriter.Handle(req, res))
+
+	state := readState(t, res.Body, false)
+	require.Equal(t, "https://trino.example.com/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1", state["nextUri"])
+	require.Equal(t, "https://trino.example.com/ui/query.html?20200924_095706_01798_yi2gi", state["infoUri"])
+	require.Nil(t, state["partialCancelUri"])
+	require.Equal(t, "20200924_095706_01798_yi2gi", state["id"])
+}
+
+func TestPublicUriRewriterWithAffinity(t *testing.T) {
+	signer := NewAffinitySigner("secret")
+	rewriter := NewPublicUriRewriter(mustUrl("https://trino.example.com"), mustUrl("http://coordinator.internal:8080")).
+		WithAffinity(signer, "cluster-0")
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    mustUrl("http://coordinator.internal:8080/v1/statement"),
+		Header: http.Header{},
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       bodyReadCloser(queryStateBody),
+	}
+
+	require.NoError(t, rewriter.Handle(req, res))
+
+	state := readState(t, res.Body, false)
+
+	nextUri := mustUrl(state["nextUri"].(string))
+	require.Equal(t, "trino.example.com", nextUri.Host)
+
+	coordinator, err := signer.Verify("20200924_095706_01798_yi2gi", nextUri.Query().Get(AffinityQueryParam))
+	require.NoError(t, err)
+	require.Equal(t, "cluster-0", coordinator)
+
+	// the ui uri doesn't need the affinity token
+	require.Equal(t, "https://trino.example.com/ui/query.html?20200924_095706_01798_yi2gi", state["infoUri"])
+}
+
+func TestPublicUriRewriterForwardedHeaders(t *testing.T) {
+	rewriter := NewPublicUriRewriter(nil, mustUrl("http://coordinator.internal:8080"))
+
+	headers := http.Header{}
+	headers.Set(HeaderForwardedProto, "https")
+	headers.Set(HeaderForwardedHost, "trino.example.com, lb.local")
+	headers.Set(HeaderForwardedPort, "8443")
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    mustUrl("http://coordinator.internal:8080/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1"),
+		Host:   "lb.local:8998",
+		Header: headers,
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       bodyReadCloser(queryStateBody),
+	}
+
+	require.NoError(t, rewriter.Handle(req, res))
+
+	state := readState(t, res.Body, false)
+	require.Equal(t, "https://trino.example.com:8443/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1", state["nextUri"])
+}
+
+func TestPublicUriRewriterRequestHost(t *testing.T) {
+	rewriter := NewPublicUriRewriter(nil, mustUrl("http://coordinator.internal:8080"))
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    mustUrl("http://coordinator.internal:8080/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1"),
+		Host:   "lb.local:8998",
+		Header: http.Header{},
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       bodyReadCloser(queryStateBody),
+	}
+
+	require.NoError(t, rewriter.Handle(req, res))
+
+	state := readState(t, res.Body, false)
+	require.Equal(t, "http://lb.local:8998/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1", state["nextUri"])
+}
+
+func TestPublicUriRewriterGzipBody(t *testing.T) {
+	rewriter := NewPublicUriRewriter(mustUrl("https://trino.example.com/trino"), mustUrl("http://coordinator.internal:8080"))
+
+	compressed, err := gzipContent([]byte(queryStateBody))
+	require.NoError(t, err)
+
+	req := &http.Request{
+		Method: http.MethodPost,
+		URL:    mustUrl("http://coordinator.internal:8080/v1/statement"),
+		Header: http.Header{},
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBuffer(compressed)),
+	}
+
+	require.NoError(t, rewriter.Handle(req, res))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(body)), res.ContentLength)
+	require.Equal(t, strconv.Itoa(len(body)), res.Header.Get("Content-Length"))
+
+	state := readState(t, bytes.NewBuffer(body), true)
+	require.Equal(t, "https://trino.example.com/trino/v1/statement/queued/20200924_095706_01798_yi2gi/y1/1", state["nextUri"])
+}
+
+func TestPublicUriRewriterLocationHeader(t *testing.T) {
+	rewriter := NewPublicUriRewriter(mustUrl("https://trino.example.com"), mustUrl("http://coordinator.internal:8080"))
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    mustUrl("http://coordinator.internal:8080/ui/"),
+		Header: http.Header{},
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusSeeOther,
+		Header:     http.Header{},
+		Body:       bodyReadCloser(""),
+	}
+	res.Header.Set(HeaderLocation, "http://coordinator.internal:8080/ui/login.html")
+
+	require.NoError(t, rewriter.Handle(req, res))
+	require.Equal(t, "https://trino.example.com/ui/login.html", res.Header.Get(HeaderLocation))
+
+	// redirects to other hosts are not rewritten
+	res.Header.Set(HeaderLocation, "https://idp.example.com/oauth2/authorize")
+	require.NoError(t, rewriter.Handle(req, res))
+	require.Equal(t, "https://idp.example.com/oauth2/authorize", res.Header.Get(HeaderLocation))
+}
+
+func TestPublicUriRewriterIgnoreNonStatementRequests(t *testing.T) {
+	rewriter := NewPublicUriRewriter(mustUrl("https://trino.example.com"), mustUrl("http://coordinator.internal:8080"))
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    mustUrl("http://coordinator.internal:8080/v1/info"),
+		Header: http.Header{},
+	}
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       bodyReadCloser(queryStateBody),
+	}
+
+	require.NoError(t, rewriter.Handle(req, res))
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, queryStateBody, string(body))
+}
+
+func readState(t *testing.T, body io.Reader, compressed bool) map[string]interface{} {
+	if compressed {
+		reader, err := gzip.NewReader(body)
+		require.NoError(t, err)
+		body = reader
+	}
+
+	var state map[string]interface{}
+	require.NoError(t, json.NewDecoder(body).Decode(&state))
+	return state
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "trino_lb"
+
+const (
+	StatusError = "error"
+
+	SessionCacheHit  = "hit"
+	SessionCacheMiss = "miss"
+
+	SessionCacheEvictionCapacity = "capacity"
+	SessionCacheEvictionExpired  = "expired"
+)
+
+// Registry contains all the proxy metrics, it's exposed by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests proxied to the coordinators.",
+	}, []string{"coordinator", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time elapsed until the coordinator response headers have been received.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"coordinator", "code"})
+
+	routingDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "routing_decisions_total",
+		Help:      "Requests routed by routing rule and matched user rule.",
+	}, []string{"rule", "user_rule"})
+
+	noBackendsAvailable = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "no_backends_available_total",
+		Help:      "Requests rejected because no coordinator was available.",
+	})
+
+	sessionCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_cache_lookups_total",
+		Help:      "Session cache lookups by result.",
+	}, []string{"result"})
+
+	sessionCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_cache_evictions_total",
+		Help:      "Session cache entries evicted by reason.",
+	}, []string{"reason"})
+
+	sessionStoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "session_store_duration_seconds",
+		Help:      "Latency of the cached session store operations.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		requests,
+		requestDuration,
+		routingDecisions,
+		noBackendsAvailable,
+		sessionCacheLookups,
+		sessionCacheEvictions,
+		sessionStoreDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the OpenMetrics text format, or in the prometheus text format for
+// clients not supporting it
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	})
+}
+
+// ObserveRequest records a request proxied to the coordinator, statusCode 0 means that no response was received
+func ObserveRequest(coordinator string, statusCode int, latency time.Duration) {
+	code := StatusError
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+
+	requests.WithLabelValues(coordinator, code).Inc()
+	requestDuration.WithLabelValues(coordinator, code).Observe(latency.Seconds())
+}
+
+func ObserveRoutingDecision(rule string, userRule string) {
+	routingDecisions.WithLabelValues(rule, userRule).Inc()
+}
+
+func ObserveNoBackendsAvailable() {
+	noBackendsAvailable.Inc()
+}
+
+func ObserveSessionCacheLookup(result string) {
+	sessionCacheLookups.WithLabelValues(result).Inc()
+}
+
+func ObserveSessionCacheEviction(reason string) {
+	sessionCacheEvictions.WithLabelValues(reason).Inc()
+}
+
+func ObserveSessionStoreOperation(operation string, latency time.Duration) {
+	sessionStoreDuration.WithLabelValues(operation).Observe(latency.Seconds())
+}
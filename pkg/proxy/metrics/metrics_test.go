@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest("coord-0", http.StatusOK, 10*time.Millisecond)
+	ObserveRequest("coord-0", 0, time.Second)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(requests.WithLabelValues("coord-0", "200")))
+	require.Equal(t, float64(1), testutil.ToFloat64(requests.WithLabelValues("coord-0", StatusError)))
+}
+
+func TestHandlerOpenMetrics(t *testing.T) {
+	ObserveNoBackendsAvailable()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rr := httptest.NewRecorder()
+
+	Handler().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.True(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "application/openmetrics-text"))
+
+	body, err := io.ReadAll(rr.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "trino_lb_no_backends_available_total")
+	require.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+}
@@ -0,0 +1,157 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNoFreshStatistics = errors.New("no coordinator with fresh statistics")
+
+const gib = 1024 * 1024 * 1024
+
+type StaleStatisticsBehaviour string
+
+const (
+	// StaleStatisticsExclude never routes to the coordinators with stale statistics
+	StaleStatisticsExclude StaleStatisticsBehaviour = "exclude"
+	// StaleStatisticsPenalize adds the stale penalty to the score of the coordinators with stale statistics
+	StaleStatisticsPenalize StaleStatisticsBehaviour = "penalize"
+)
+
+func ParseStaleStatisticsBehaviour(raw string) (StaleStatisticsBehaviour, error) {
+	switch StaleStatisticsBehaviour(strings.ToLower(raw)) {
+	case StaleStatisticsExclude:
+		return StaleStatisticsExclude, nil
+	case StaleStatisticsPenalize:
+		return StaleStatisticsPenalize, nil
+	default:
+		return "", fmt.Errorf("invalid stale statistics behaviour: %s", raw)
+	}
+}
+
+// LoadScoreConf contains the coefficients of the load score of a coordinator:
+//
+//	(running * Running + queued * Queued + blocked * Blocked + reserved memory GiB * Memory) / active workers
+//
+// the clusters without active workers are scored as if they had one
+type LoadScoreConf struct {
+	Running float64
+	Queued  float64
+	Blocked float64
+	Memory  float64
+	// MaxStatisticsAge is the age after which the statistics are stale, 0 disables the check. The statistics
+	// never retrieved are always stale
+	MaxStatisticsAge time.Duration
+	Stale            StaleStatisticsBehaviour
+	StalePenalty     float64
+}
+
+// CoordinatorScore is the load score computed for a coordinator, the lowest score is selected
+type CoordinatorScore struct {
+	Name     string  `json:"name"`
+	Score    float64 `json:"score"`
+	Stale    bool    `json:"stale,omitempty"`
+	Excluded bool    `json:"excluded,omitempty"`
+}
+
+// ScoredRule is implemented by the rules selecting the coordinator by score, the scores are reported
+// in the routing explanation
+type ScoredRule interface {
+	Scores(Request) []CoordinatorScore
+}
+
+func LoadScore(conf LoadScoreConf) LoadScoreRule {
+	return LoadScoreRule{conf: conf}
+}
+
+// LoadScoreRule selects the coordinator with the lowest load score
+type LoadScoreRule struct {
+	conf LoadScoreConf
+}
+
+func (r LoadScoreRule) Route(request Request) (models.Coordinator, error) {
+	scores := r.Scores(request)
+
+	selected := -1
+	for i, score := range scores {
+		if score.Excluded {
+			continue
+		}
+
+		if selected == -1 || score.Score < scores[selected].Score {
+			selected = i
+		}
+	}
+
+	if selected == -1 {
+		return models.Coordinator{}, ErrNoFreshStatistics
+	}
+
+	for _, c := range request.Coordinators {
+		if c.Coordinator.Name == scores[selected].Name {
+			return c.Coordinator, nil
+		}
+	}
+	return models.Coordinator{}, ErrRouteNotFound
+}
+
+// Scores returns the scores of the coordinators sorted by name
+func (r LoadScoreRule) Scores(request Request) []CoordinatorScore {
+	now := time.Now()
+
+	scores := make([]CoordinatorScore, len(request.Coordinators))
+	for i, c := range request.Coordinators {
+		score := CoordinatorScore{
+			Name:  c.Coordinator.Name,
+			Score: r.score(c),
+			Stale: r.stale(c, now),
+		}
+
+		if score.Stale {
+			switch r.conf.Stale {
+			case StaleStatisticsExclude:
+				score.Excluded = true
+			default:
+				score.Score += r.conf.StalePenalty
+			}
+		}
+
+		scores[i] = score
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Name < scores[j].Name
+	})
+	return scores
+}
+
+func (r LoadScoreRule) score(c CoordinatorWithStatistics) float64 {
+	stats := c.Statistics
+
+	workers := float64(stats.ActiveWorkers)
+	if workers < 1 {
+		workers = 1
+	}
+
+	load := float64(stats.RunningQueries)*r.conf.Running +
+		float64(stats.QueuedQueries)*r.conf.Queued +
+		float64(stats.BlockedQueries)*r.conf.Blocked +
+		stats.ReservedMemory/gib*r.conf.Memory
+
+	return load / workers
+}
+
+func (r LoadScoreRule) stale(c CoordinatorWithStatistics, now time.Time) bool {
+	if c.StatisticsUpdatedAt.IsZero() {
+		return true
+	}
+	return r.conf.MaxStatisticsAge > 0 && now.Sub(c.StatisticsUpdatedAt) > r.conf.MaxStatisticsAge
+}
+
+func (r LoadScoreRule) Name() string {
+	return "load-score"
+}
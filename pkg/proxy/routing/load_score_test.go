@@ -0,0 +1,188 @@
+package routing
+
+import (
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func scoredCoordinator(name string, stats trino.ClusterStatistics, updatedAt time.Time) CoordinatorWithStatistics {
+	return CoordinatorWithStatistics{
+		Coordinator:         models.Coordinator{Name: name},
+		Statistics:          stats,
+		StatisticsUpdatedAt: updatedAt,
+	}
+}
+
+func TestLoadScoreRouting(t *testing.T) {
+	now := time.Now()
+
+	conf := LoadScoreConf{
+		Running:          1,
+		Queued:           2,
+		Blocked:          0.5,
+		Memory:           1,
+		MaxStatisticsAge: time.Minute,
+		Stale:            StaleStatisticsPenalize,
+		StalePenalty:     100,
+	}
+
+	tests := []struct {
+		name         string
+		conf         LoadScoreConf
+		coordinators []CoordinatorWithStatistics
+		expected     string
+		err          error
+	}{
+		{
+			name: "workers",
+			conf: conf,
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("small", trino.ClusterStatistics{RunningQueries: 10, ActiveWorkers: 10}, now),
+				scoredCoordinator("large", trino.ClusterStatistics{RunningQueries: 20, ActiveWorkers: 40}, now),
+			},
+			expected: "large",
+		},
+		{
+			name: "queued",
+			conf: conf,
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("queued", trino.ClusterStatistics{RunningQueries: 5, QueuedQueries: 5, ActiveWorkers: 10}, now),
+				scoredCoordinator("running", trino.ClusterStatistics{RunningQueries: 12, ActiveWorkers: 10}, now),
+			},
+			expected: "running",
+		},
+		{
+			name: "memory",
+			conf: conf,
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("pressure", trino.ClusterStatistics{RunningQueries: 1, ReservedMemory: 50 * gib, ActiveWorkers: 10}, now),
+				scoredCoordinator("idle", trino.ClusterStatistics{RunningQueries: 4, ActiveWorkers: 10}, now),
+			},
+			expected: "idle",
+		},
+		{
+			name: "no workers",
+			conf: conf,
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("empty", trino.ClusterStatistics{QueuedQueries: 3}, now),
+				scoredCoordinator("busy", trino.ClusterStatistics{RunningQueries: 30, ActiveWorkers: 10}, now),
+			},
+			expected: "busy",
+		},
+		{
+			name: "stale penalized",
+			conf: conf,
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("stale", trino.ClusterStatistics{ActiveWorkers: 10}, now.Add(-time.Hour)),
+				scoredCoordinator("missing", trino.ClusterStatistics{}, time.Time{}),
+				scoredCoordinator("fresh", trino.ClusterStatistics{RunningQueries: 50, ActiveWorkers: 10}, now),
+			},
+			expected: "fresh",
+		},
+		{
+			name: "stale penalized only stale",
+			conf: conf,
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("stale-busy", trino.ClusterStatistics{RunningQueries: 50, ActiveWorkers: 10}, now.Add(-time.Hour)),
+				scoredCoordinator("stale-idle", trino.ClusterStatistics{ActiveWorkers: 10}, now.Add(-time.Hour)),
+			},
+			expected: "stale-idle",
+		},
+		{
+			name: "stale excluded",
+			conf: LoadScoreConf{Running: 1, MaxStatisticsAge: time.Minute, Stale: StaleStatisticsExclude},
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("stale", trino.ClusterStatistics{ActiveWorkers: 10}, now.Add(-time.Hour)),
+				scoredCoordinator("fresh", trino.ClusterStatistics{RunningQueries: 50, ActiveWorkers: 10}, now),
+			},
+			expected: "fresh",
+		},
+		{
+			name: "all stale excluded",
+			conf: LoadScoreConf{Running: 1, MaxStatisticsAge: time.Minute, Stale: StaleStatisticsExclude},
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("stale", trino.ClusterStatistics{ActiveWorkers: 10}, now.Add(-time.Hour)),
+				scoredCoordinator("missing", trino.ClusterStatistics{}, time.Time{}),
+			},
+			err: ErrNoFreshStatistics,
+		},
+		{
+			name: "age check disabled",
+			conf: LoadScoreConf{Running: 1, Stale: StaleStatisticsExclude},
+			coordinators: []CoordinatorWithStatistics{
+				scoredCoordinator("old", trino.ClusterStatistics{ActiveWorkers: 10}, now.Add(-time.Hour)),
+				scoredCoordinator("fresh", trino.ClusterStatistics{RunningQueries: 50, ActiveWorkers: 10}, now),
+			},
+			expected: "old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coordinator, err := LoadScore(tt.conf).Route(Request{Coordinators: tt.coordinators})
+			if tt.err != nil {
+				require.True(t, errors.Is(err, tt.err))
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, coordinator.Name)
+		})
+	}
+}
+
+func TestLoadScoreScores(t *testing.T) {
+	now := time.Now()
+	rule := LoadScore(LoadScoreConf{
+		Running:          1,
+		Queued:           2,
+		Blocked:          1,
+		Memory:           0.5,
+		MaxStatisticsAge: time.Minute,
+		Stale:            StaleStatisticsPenalize,
+		StalePenalty:     100,
+	})
+
+	scores := rule.Scores(Request{
+		Coordinators: []CoordinatorWithStatistics{
+			scoredCoordinator("b", trino.ClusterStatistics{RunningQueries: 4, QueuedQueries: 2, BlockedQueries: 2, ReservedMemory: 8 * gib, ActiveWorkers: 4}, now),
+			scoredCoordinator("a", trino.ClusterStatistics{RunningQueries: 2}, time.Time{}),
+		},
+	})
+
+	require.Equal(t, []CoordinatorScore{
+		{Name: "a", Score: 102, Stale: true},
+		{Name: "b", Score: 3.5},
+	}, scores)
+}
+
+func TestRouterExplainScores(t *testing.T) {
+	router := New(NewUserAwareRouter(UserAwareRoutingConf{
+		Default: UserAwareDefault{
+			Behaviour: NoMatchBehaviourDefault,
+			Cluster:   UserAwareClusterMatchRule{Name: regexp.MustCompile(".*")},
+		},
+	}), LoadScore(LoadScoreConf{Running: 1, Stale: StaleStatisticsExclude}))
+
+	_, explanation, err := router.Explain(Request{
+		User: "test",
+		Coordinators: []CoordinatorWithStatistics{
+			scoredCoordinator("busy", trino.ClusterStatistics{RunningQueries: 8, ActiveWorkers: 2}, time.Now()),
+			scoredCoordinator("idle", trino.ClusterStatistics{RunningQueries: 1, ActiveWorkers: 2}, time.Now()),
+			scoredCoordinator("new", trino.ClusterStatistics{}, time.Time{}),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "idle", explanation.Coordinator)
+	require.Equal(t, "load-score", explanation.Rule)
+	require.Equal(t, []CoordinatorScore{
+		{Name: "busy", Score: 4},
+		{Name: "idle", Score: 0.5},
+		{Name: "new", Score: 0, Stale: true, Excluded: true},
+	}, explanation.Scores)
+}
@@ -0,0 +1,218 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+const (
+	HeaderSource       = "X-Trino-Source"
+	HeaderClientTags   = "X-Trino-Client-Tags"
+	HeaderRoutingGroup = "X-Trino-Routing-Group"
+)
+
+// Matcher tests a condition on the routing request
+type Matcher interface {
+	Match(Request) bool
+	String() string
+}
+
+type userMatcher struct {
+	re *regexp.Regexp
+}
+
+// MatchUser matches the requests with a user matching the pattern
+func MatchUser(re *regexp.Regexp) Matcher {
+	return userMatcher{re: re}
+}
+
+func (m userMatcher) Match(req Request) bool {
+	return m.re.MatchString(req.User)
+}
+
+func (m userMatcher) String() string {
+	return "user=~" + m.re.String()
+}
+
+type headerMatcher struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// MatchHeader matches the requests with the header value matching the pattern, a missing header is
+// matched as an empty value
+func MatchHeader(name string, re *regexp.Regexp) Matcher {
+	return headerMatcher{name: name, re: re}
+}
+
+// MatchSource matches the X-Trino-Source header
+func MatchSource(re *regexp.Regexp) Matcher {
+	return headerMatcher{name: HeaderSource, re: re}
+}
+
+func (m headerMatcher) Match(req Request) bool {
+	return m.re.MatchString(req.Headers.Get(m.name))
+}
+
+func (m headerMatcher) String() string {
+	if m.name == HeaderSource {
+		return "source=~" + m.re.String()
+	}
+	return fmt.Sprintf("header[%s]=~%s", m.name, m.re.String())
+}
+
+type routingGroupMatcher struct {
+	group string
+}
+
+// MatchRoutingGroup matches the requests asking explicitly for a routing group with the X-Trino-Routing-Group header
+func MatchRoutingGroup(group string) Matcher {
+	return routingGroupMatcher{group: group}
+}
+
+func (m routingGroupMatcher) Match(req Request) bool {
+	return strings.EqualFold(strings.TrimSpace(req.Headers.Get(HeaderRoutingGroup)), m.group)
+}
+
+func (m routingGroupMatcher) String() string {
+	return "routing_group=" + m.group
+}
+
+type clientTagsMatcher struct {
+	tags []string
+}
+
+// MatchClientTags matches the requests with all the tags in the X-Trino-Client-Tags header
+func MatchClientTags(tags []string) Matcher {
+	return clientTagsMatcher{tags: tags}
+}
+
+func (m clientTagsMatcher) Match(req Request) bool {
+	present := ClientTags(req)
+	for _, tag := range m.tags {
+		if !containsString(present, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m clientTagsMatcher) String() string {
+	return "client_tags=" + strings.Join(m.tags, ",")
+}
+
+type clientCidrMatcher struct {
+	networks []*net.IPNet
+}
+
+// MatchClientCidr matches the requests with a client address contained in one of the networks
+func MatchClientCidr(networks []*net.IPNet) Matcher {
+	return clientCidrMatcher{networks: networks}
+}
+
+func (m clientCidrMatcher) Match(req Request) bool {
+	ip := net.ParseIP(req.ClientAddress)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range m.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m clientCidrMatcher) String() string {
+	networks := make([]string, len(m.networks))
+	for i, network := range m.networks {
+		networks[i] = network.String()
+	}
+	return "client_cidr=" + strings.Join(networks, ",")
+}
+
+type allMatcher struct {
+	matchers []Matcher
+}
+
+// MatchAll matches the requests matching all the matchers, without matchers every request is matched
+func MatchAll(matchers ...Matcher) Matcher {
+	if len(matchers) == 1 {
+		return matchers[0]
+	}
+	return allMatcher{matchers: matchers}
+}
+
+func (m allMatcher) Match(req Request) bool {
+	for _, matcher := range m.matchers {
+		if !matcher.Match(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m allMatcher) String() string {
+	return joinMatchers(m.matchers, " && ")
+}
+
+type anyMatcher struct {
+	matchers []Matcher
+}
+
+// MatchAny matches the requests matching at least one of the matchers, without matchers no request is matched
+func MatchAny(matchers ...Matcher) Matcher {
+	if len(matchers) == 1 {
+		return matchers[0]
+	}
+	return anyMatcher{matchers: matchers}
+}
+
+func (m anyMatcher) Match(req Request) bool {
+	for _, matcher := range m.matchers {
+		if matcher.Match(req) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m anyMatcher) String() string {
+	return joinMatchers(m.matchers, " || ")
+}
+
+func joinMatchers(matchers []Matcher, separator string) string {
+	parts := make([]string, len(matchers))
+	for i, matcher := range matchers {
+		parts[i] = matcher.String()
+	}
+	return "(" + strings.Join(parts, separator) + ")"
+}
+
+// ClientTags returns the tags of the X-Trino-Client-Tags header
+func ClientTags(req Request) []string {
+	raw := req.Headers.Get(HeaderClientTags)
+	if len(raw) == 0 {
+		return nil
+	}
+
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) != 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package routing
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func mustCidr(t *testing.T, raw string) *net.IPNet {
+	_, network, err := net.ParseCIDR(raw)
+	require.NoError(t, err)
+	return network
+}
+
+func TestMatchers(t *testing.T) {
+	req := Request{
+		User: "bi-service",
+		Headers: http.Header{
+			HeaderSource:       []string{"tableau-server"},
+			HeaderClientTags:   []string{"dashboard, finance"},
+			HeaderRoutingGroup: []string{"Reporting"},
+			"X-Team":           []string{"finance"},
+		},
+		ClientAddress: "10.1.2.3",
+	}
+
+	tests := []struct {
+		name    string
+		matcher Matcher
+		match   bool
+		desc    string
+	}{
+		{name: "user", matcher: MatchUser(regexp.MustCompile("bi-(.+)")), match: true, desc: "user=~bi-(.+)"},
+		{name: "source", matcher: MatchSource(regexp.MustCompile("^tableau")), match: true, desc: "source=~^tableau"},
+		{name: "source mismatch", matcher: MatchSource(regexp.MustCompile("^superset")), match: false},
+		{name: "client tags", matcher: MatchClientTags([]string{"finance", "dashboard"}), match: true, desc: "client_tags=finance,dashboard"},
+		{name: "missing client tag", matcher: MatchClientTags([]string{"finance", "etl"}), match: false},
+		{name: "routing group", matcher: MatchRoutingGroup("reporting"), match: true, desc: "routing_group=reporting"},
+		{name: "header", matcher: MatchHeader("X-Team", regexp.MustCompile("^finance$")), match: true, desc: "header[X-Team]=~^finance$"},
+		{name: "missing header", matcher: MatchHeader("X-Other", regexp.MustCompile(".+")), match: false},
+		{name: "cidr", matcher: MatchClientCidr([]*net.IPNet{mustCidr(t, "192.168.0.0/16"), mustCidr(t, "10.0.0.0/8")}), match: true, desc: "client_cidr=192.168.0.0/16,10.0.0.0/8"},
+		{name: "cidr mismatch", matcher: MatchClientCidr([]*net.IPNet{mustCidr(t, "192.168.0.0/16")}), match: false},
+		{
+			name:    "all",
+			matcher: MatchAll(MatchUser(regexp.MustCompile("bi-(.+)")), MatchSource(regexp.MustCompile("^superset"))),
+			match:   false,
+			desc:    "(user=~bi-(.+) && source=~^superset)",
+		},
+		{
+			name:    "any",
+			matcher: MatchAny(MatchSource(regexp.MustCompile("^superset")), MatchClientTags([]string{"finance"})),
+			match:   true,
+			desc:    "(source=~^superset || client_tags=finance)",
+		},
+		{name: "empty any", matcher: MatchAny(), match: false},
+		{name: "empty all", matcher: MatchAll(), match: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.match, tt.matcher.Match(req))
+			if len(tt.desc) != 0 {
+				require.Equal(t, tt.desc, tt.matcher.String())
+			}
+		})
+	}
+}
+
+func TestMatchClientCidrInvalidAddress(t *testing.T) {
+	matcher := MatchClientCidr([]*net.IPNet{mustCidr(t, "0.0.0.0/0")})
+	require.False(t, matcher.Match(Request{ClientAddress: "unknown"}))
+	require.True(t, matcher.Match(Request{ClientAddress: "172.16.0.1"}))
+}
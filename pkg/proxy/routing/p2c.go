@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// ConnectionLoad is the load of a coordinator observed by the proxy on its own requests, it's updated on
+// every request unlike the statistics polled from the coordinator
+type ConnectionLoad struct {
+	// InFlight is the number of requests sent to the coordinator and not completed yet
+	InFlight int64
+	// Latency is the exponentially weighted moving average of the response latency
+	Latency time.Duration
+}
+
+// cost is the expected latency of a new request: the latency is multiplied by the requests in flight, the
+// coordinators never observed have no latency and are preferred until the first response
+func (l ConnectionLoad) cost() float64 {
+	return float64(l.Latency) / float64(time.Millisecond) * float64(l.InFlight+1)
+}
+
+func PowerOfTwoChoices() PowerOfTwoChoicesRule {
+	return PowerOfTwoChoicesRule{
+		intn: rand.Intn,
+	}
+}
+
+// PowerOfTwoChoicesRule samples two random coordinators and selects the one with the lowest cost, sampling
+// avoids that every proxy replica sends the burst of queries to the same coordinator
+type PowerOfTwoChoicesRule struct {
+	intn func(int) int
+}
+
+func (r PowerOfTwoChoicesRule) Route(request Request) (models.Coordinator, error) {
+	coordinators := request.Coordinators
+	if len(coordinators) == 1 {
+		return coordinators[0].Coordinator, nil
+	}
+
+	first := r.intn(len(coordinators))
+	// the second choice is sampled among the other coordinators
+	second := r.intn(len(coordinators) - 1)
+	if second >= first {
+		second++
+	}
+
+	if coordinators[second].Load.cost() < coordinators[first].Load.cost() {
+		return coordinators[second].Coordinator, nil
+	}
+	return coordinators[first].Coordinator, nil
+}
+
+// Scores returns the cost of every coordinator sorted by name, only two of them are compared by the routing
+func (r PowerOfTwoChoicesRule) Scores(request Request) []CoordinatorScore {
+	scores := make([]CoordinatorScore, len(request.Coordinators))
+	for i, c := range request.Coordinators {
+		scores[i] = CoordinatorScore{Name: c.Coordinator.Name, Score: c.Load.cost()}
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Name < scores[j].Name
+	})
+	return scores
+}
+
+func (r PowerOfTwoChoicesRule) Name() string {
+	return "p2c"
+}
@@ -0,0 +1,86 @@
+package routing
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func loadedCoordinator(name string, inFlight int64, latency time.Duration) CoordinatorWithStatistics {
+	return CoordinatorWithStatistics{
+		Coordinator: models.Coordinator{Name: name},
+		Load:        ConnectionLoad{InFlight: inFlight, Latency: latency},
+	}
+}
+
+// sequence returns the values in order, it's used to choose the sampled coordinators
+func sequence(values ...int) func(int) int {
+	i := 0
+	return func(n int) int {
+		v := values[i%len(values)]
+		i++
+		return v % n
+	}
+}
+
+func TestPowerOfTwoChoicesRouting(t *testing.T) {
+	coordinators := []CoordinatorWithStatistics{
+		loadedCoordinator("slow", 0, 200*time.Millisecond),
+		loadedCoordinator("busy", 10, 20*time.Millisecond),
+		loadedCoordinator("fast", 1, 20*time.Millisecond),
+		loadedCoordinator("new", 0, 0),
+	}
+
+	tests := []struct {
+		name     string
+		samples  []int
+		expected string
+	}{
+		{name: "latency", samples: []int{0, 1}, expected: "fast"},
+		{name: "in flight", samples: []int{1, 1}, expected: "fast"},
+		{name: "latency times in flight", samples: []int{0, 0}, expected: "slow"},
+		{name: "never observed", samples: []int{2, 2}, expected: "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := PowerOfTwoChoicesRule{intn: sequence(tt.samples...)}
+			coordinator, err := rule.Route(Request{Coordinators: coordinators})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, coordinator.Name)
+		})
+	}
+}
+
+func TestPowerOfTwoChoicesDistinctSamples(t *testing.T) {
+	rule := PowerOfTwoChoices()
+	request := Request{
+		Coordinators: []CoordinatorWithStatistics{
+			loadedCoordinator("busy", 100, time.Second),
+			loadedCoordinator("idle", 0, time.Millisecond),
+		},
+	}
+
+	// with two coordinators both are always sampled so the least loaded is always selected
+	for i := 0; i < 100; i++ {
+		coordinator, err := rule.Route(request)
+		require.NoError(t, err)
+		require.Equal(t, "idle", coordinator.Name)
+	}
+
+	coordinator, err := rule.Route(Request{Coordinators: request.Coordinators[:1]})
+	require.NoError(t, err)
+	require.Equal(t, "busy", coordinator.Name)
+}
+
+func TestPowerOfTwoChoicesScores(t *testing.T) {
+	scores := PowerOfTwoChoices().Scores(Request{
+		Coordinators: []CoordinatorWithStatistics{
+			loadedCoordinator("b", 3, 10*time.Millisecond),
+			loadedCoordinator("a", 0, 0),
+		},
+	})
+
+	require.Equal(t, []CoordinatorScore{{Name: "a", Score: 0}, {Name: "b", Score: 40}}, scores)
+}
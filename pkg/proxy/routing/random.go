@@ -17,3 +17,7 @@ func (r RandomRouter) Route(request Request) (models.Coordinator, error) {
 	n := rand.Int31n(int32(max))
 	return request.Coordinators[n].Coordinator, nil
 }
+
+func (r RandomRouter) Name() string {
+	return "random"
+}
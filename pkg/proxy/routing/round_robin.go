@@ -34,3 +34,17 @@ func (r *RoundRobinRule) Route(request Request) (models.Coordinator, error) {
 	r.index = (r.index + 1) % r.coordinators
 	return selected, nil
 }
+
+func (r *RoundRobinRule) Peek(request Request) (models.Coordinator, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.coordinators != len(request.Coordinators) {
+		return request.Coordinators[0].Coordinator, nil
+	}
+	return request.Coordinators[r.index].Coordinator, nil
+}
+
+func (r *RoundRobinRule) Name() string {
+	return "round-robin"
+}
@@ -5,24 +5,43 @@ import (
 	"fmt"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"net/http"
+	"sort"
+	"time"
 )
 
 type Rule interface {
 	Route(Request) (models.Coordinator, error)
 }
 
+// PeekingRule is implemented by the rules with a selection state, Peek returns the coordinator selected by
+// the next Route without updating the state
+type PeekingRule interface {
+	Peek(Request) (models.Coordinator, error)
+}
+
 type CoordinatorWithStatistics struct {
 	Coordinator models.Coordinator
 	Statistics  trino.ClusterStatistics
+	// StatisticsUpdatedAt is the time of the last retrieval of the statistics, zero if they have never been retrieved
+	StatisticsUpdatedAt time.Time
+	Load                ConnectionLoad
 }
 
 type Request struct {
-	User         string
-	Coordinators []CoordinatorWithStatistics
+	User string
+	// Headers and Statement are the headers and the sql of the routed request, the statement is
+	// empty when it's not available to the proxy
+	Headers   http.Header
+	Statement string
+	// ClientAddress is the ip address of the client connected to the proxy
+	ClientAddress string
+	Coordinators  []CoordinatorWithStatistics
 }
 
 type Router struct {
 	UserAwareRouter UserAwareRouter
+	StatementRouter StatementRouter
 	Rule            Rule
 }
 
@@ -33,19 +52,182 @@ func New(userAwareRouter UserAwareRouter, rule Rule) Router {
 	}
 }
 
+// WithStatementRouter filters the coordinators left by the user aware router using the submitted statement
+func (r Router) WithStatementRouter(statementRouter StatementRouter) Router {
+	r.StatementRouter = statementRouter
+	return r
+}
+
+// ReadsStatement is true when the routing needs the statement of the submitted queries
+func (r Router) ReadsStatement() bool {
+	return r.StatementRouter.ReadsStatement()
+}
+
+// Decision describes how a request has been routed
+type Decision struct {
+	Coordinator models.Coordinator
+	// Rule is the name of the rule that selected the coordinator
+	Rule string
+	// UserRule is the user aware routing rule that matched the request user
+	UserRule string
+}
+
 func (r Router) Route(req Request) (models.Coordinator, error) {
+	decision, err := r.Decide(req)
+	if err != nil {
+		return models.Coordinator{}, err
+	}
+	return decision.Coordinator, nil
+}
+
+func (r Router) Decide(req Request) (Decision, error) {
+	return r.decide(req, nil, false)
+}
+
+// Explanation describes the steps of a routing decision
+type Explanation struct {
+	User string `json:"user"`
+	// UserRule is the user aware routing rule that matched the request user
+	UserRule string `json:"user_rule"`
+	// Candidates are the coordinators considered before the user aware filtering
+	Candidates []string `json:"candidates"`
+	// Matching are the coordinators left by the user aware filtering
+	Matching []string `json:"matching"`
+	// DefaultFallback is true when the matched user rule had no coordinator and the default cluster is used
+	DefaultFallback bool `json:"default_fallback"`
+	// StatementType and Tables are the result of the analysis of the statement, they are set only when
+	// statement rules are configured
+	StatementType string   `json:"statement_type,omitempty"`
+	Tables        []string `json:"tables,omitempty"`
+	// StatementRule is the statement rule that matched the statement and StatementMatching are the coordinators
+	// left by the rule
+	StatementRule     string   `json:"statement_rule,omitempty"`
+	StatementMatching []string `json:"statement_matching,omitempty"`
+	StatementFallback bool     `json:"statement_fallback,omitempty"`
+	Rule              string   `json:"rule"`
+	// Scores are the scores computed by the rule, they are set only for the scored rules
+	Scores      []CoordinatorScore `json:"scores,omitempty"`
+	Coordinator string             `json:"coordinator"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// Explain routes the request like Decide and describes how the decision has been taken
+func (r Router) Explain(req Request) (Decision, Explanation, error) {
+	return r.explain(req, false)
+}
+
+// Simulate describes the decision that Explain would take without updating the state of the rule, the
+// following requests are routed as if the simulation never happened
+func (r Router) Simulate(req Request) (Decision, Explanation, error) {
+	return r.explain(req, true)
+}
+
+func (r Router) explain(req Request, simulated bool) (Decision, Explanation, error) {
+	explanation := Explanation{
+		User:       req.User,
+		Candidates: coordinatorNames(req.Coordinators),
+		Matching:   []string{},
+	}
+
+	decision, err := r.decide(req, &explanation, simulated)
+	if err != nil {
+		explanation.Error = err.Error()
+	}
+
+	return decision, explanation, err
+}
+
+func (r Router) decide(req Request, explanation *Explanation, simulated bool) (Decision, error) {
 	if len(req.Coordinators) == 0 {
-		return models.Coordinator{}, errors.New("unable to handle routing with no available coordinators")
+		return Decision{}, errors.New("unable to handle routing with no available coordinators")
 	}
 
-	req, err := r.UserAwareRouter.Route(req)
+	req, match, err := r.UserAwareRouter.route(req)
 	if err != nil {
-		return models.Coordinator{}, fmt.Errorf("error routing request: %w", err)
+		return Decision{}, fmt.Errorf("error routing request: %w", err)
+	}
+
+	if explanation != nil {
+		explanation.UserRule = match.Rule
+		explanation.DefaultFallback = match.DefaultFallback
+		explanation.Matching = coordinatorNames(req.Coordinators)
 	}
 
 	if len(req.Coordinators) == 0 {
-		return models.Coordinator{}, ErrRouteNotFound
+		return Decision{}, ErrRouteNotFound
 	}
 
-	return r.Rule.Route(req)
+	req, statementMatch := r.StatementRouter.route(req)
+	if explanation != nil {
+		explainStatement(explanation, statementMatch, req)
+	}
+
+	if len(req.Coordinators) == 0 {
+		return Decision{}, ErrRouteNotFound
+	}
+
+	if scored, ok := r.Rule.(ScoredRule); ok && explanation != nil {
+		explanation.Scores = scored.Scores(req)
+	}
+
+	route := r.Rule.Route
+	if peeking, ok := r.Rule.(PeekingRule); ok && simulated {
+		route = peeking.Peek
+	}
+
+	coordinator, err := route(req)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	decision := Decision{
+		Coordinator: coordinator,
+		Rule:        RuleName(r.Rule),
+		UserRule:    match.Rule,
+	}
+
+	if explanation != nil {
+		explanation.Rule = decision.Rule
+		explanation.Coordinator = coordinator.Name
+	}
+
+	return decision, nil
+}
+
+func explainStatement(explanation *Explanation, match StatementMatch, req Request) {
+	if len(match.Analysis.Type) != 0 {
+		explanation.StatementType = string(match.Analysis.Type)
+		explanation.Tables = make([]string, len(match.Analysis.Tables))
+		for i, table := range match.Analysis.Tables {
+			explanation.Tables[i] = table.String()
+		}
+	}
+
+	if len(match.Rule) != 0 {
+		explanation.StatementRule = match.Rule
+		explanation.StatementMatching = coordinatorNames(req.Coordinators)
+		explanation.StatementFallback = match.Fallback
+	}
+}
+
+// coordinatorNames returns the sorted names of the coordinators
+func coordinatorNames(coordinators []CoordinatorWithStatistics) []string {
+	names := make([]string, len(coordinators))
+	for i, c := range coordinators {
+		names[i] = c.Coordinator.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamedRule is implemented by the rules that provide a name used in metrics and logs
+type NamedRule interface {
+	Name() string
+}
+
+func RuleName(rule Rule) string {
+	if named, ok := rule.(NamedRule); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", rule)
 }
@@ -1,8 +1,10 @@
 package routing
 
 import (
+	"errors"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/stretchr/testify/require"
+	"regexp"
 	"testing"
 )
 
@@ -26,3 +28,125 @@ func TestRouterHandleEmptyCoordinators(t *testing.T) {
 	_, err := router.Route(Request{})
 	require.Error(t, err)
 }
+
+func TestRouterDecide(t *testing.T) {
+	router := New(NewUserAwareRouter(UserAwareRoutingConf{
+		Default: UserAwareDefault{
+			Behaviour: NoMatchBehaviourDefault,
+		},
+		Rules: []UserAwareRoutingRule{
+			{
+				User:    regexp.MustCompile("etl-(.+)"),
+				Cluster: UserAwareClusterMatchRule{Name: regexp.MustCompile("etl")},
+			},
+		},
+	}), RoundRobin())
+
+	coordinators := []CoordinatorWithStatistics{
+		{Coordinator: models.Coordinator{Name: "etl"}},
+		{Coordinator: models.Coordinator{Name: "interactive"}},
+	}
+
+	decision, err := router.Decide(Request{User: "etl-daily", Coordinators: coordinators})
+	require.NoError(t, err)
+	require.Equal(t, "etl", decision.Coordinator.Name)
+	require.Equal(t, "round-robin", decision.Rule)
+	require.Equal(t, "etl-(.+)", decision.UserRule)
+
+	decision, err = router.Decide(Request{User: "analyst", Coordinators: coordinators})
+	require.NoError(t, err)
+	require.Equal(t, UserRuleDefault, decision.UserRule)
+}
+
+func TestRouterDecideWithoutUserRules(t *testing.T) {
+	router := New(NewUserAwareRouter(UserAwareRoutingConf{}), LessRunningQueries())
+
+	decision, err := router.Decide(Request{
+		Coordinators: []CoordinatorWithStatistics{
+			{Coordinator: models.Coordinator{Name: "test"}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "less-running-queries", decision.Rule)
+	require.Equal(t, UserRuleNone, decision.UserRule)
+}
+
+func TestRouterExplain(t *testing.T) {
+	router := New(NewUserAwareRouter(UserAwareRoutingConf{
+		Default: UserAwareDefault{
+			Behaviour: NoMatchBehaviourForbid,
+			Cluster:   UserAwareClusterMatchRule{Name: regexp.MustCompile("default")},
+		},
+		Rules: []UserAwareRoutingRule{
+			{
+				User:    regexp.MustCompile("etl-(.+)"),
+				Cluster: UserAwareClusterMatchRule{Name: regexp.MustCompile("etl"), UseDefaultIfUnhealthy: true},
+			},
+		},
+	}), RoundRobin())
+
+	req := Request{
+		User: "etl-daily",
+		Coordinators: []CoordinatorWithStatistics{
+			{Coordinator: models.Coordinator{Name: "default-0"}},
+			{Coordinator: models.Coordinator{Name: "adhoc-0"}},
+		},
+	}
+
+	decision, explanation, err := router.Explain(req)
+	require.NoError(t, err)
+	require.Equal(t, "default-0", decision.Coordinator.Name)
+	require.Equal(t, Explanation{
+		User:            "etl-daily",
+		UserRule:        "etl-(.+)",
+		Candidates:      []string{"adhoc-0", "default-0"},
+		Matching:        []string{"default-0"},
+		DefaultFallback: true,
+		Rule:            "round-robin",
+		Coordinator:     "default-0",
+	}, explanation)
+
+	req.User = "analyst"
+	_, explanation, err = router.Explain(req)
+	require.True(t, errors.Is(err, ErrForbiddenRouting))
+	require.Equal(t, []string{}, explanation.Matching)
+	require.Equal(t, "", explanation.Coordinator)
+	require.Equal(t, err.Error(), explanation.Error)
+}
+
+func TestRouterSimulateKeepsRuleState(t *testing.T) {
+	req := Request{
+		User: "test",
+		Coordinators: []CoordinatorWithStatistics{
+			weightedCoordinator("test-0", "2"),
+			weightedCoordinator("test-1", "1"),
+			weightedCoordinator("test-2", "1"),
+		},
+	}
+
+	rules := []Rule{RoundRobin(), WeightedRoundRobin()}
+	for _, rule := range rules {
+		t.Run(RuleName(rule), func(t *testing.T) {
+			router := New(NewUserAwareRouter(UserAwareRoutingConf{
+				Default: UserAwareDefault{
+					Behaviour: NoMatchBehaviourDefault,
+					Cluster:   UserAwareClusterMatchRule{Name: regexp.MustCompile(".*")},
+				},
+			}), rule)
+
+			for i := 0; i < 5; i++ {
+				simulated, explanation, err := router.Simulate(req)
+				require.NoError(t, err)
+				require.Equal(t, simulated.Coordinator.Name, explanation.Coordinator)
+
+				// the simulation is the decision of the next request
+				simulated, _, err = router.Simulate(req)
+				require.NoError(t, err)
+
+				decision, err := router.Decide(req)
+				require.NoError(t, err)
+				require.Equal(t, decision.Coordinator.Name, simulated.Coordinator.Name)
+			}
+		})
+	}
+}
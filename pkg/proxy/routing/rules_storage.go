@@ -0,0 +1,63 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const DefaultRulesTableName = "trino_routing_rules"
+
+var (
+	ErrRuleNotFound = errors.New("routing rule not found")
+	ErrInvalidRule  = errors.New("invalid routing rule")
+)
+
+// RuleDefinition is a user aware routing rule editable at runtime, the rules are evaluated by position
+type RuleDefinition struct {
+	ID                    int64             `json:"id"`
+	Position              int               `json:"position"`
+	User                  string            `json:"user"`
+	ClusterName           string            `json:"cluster_name"`
+	ClusterTags           map[string]string `json:"cluster_tags"`
+	UseDefaultIfUnhealthy bool              `json:"use_default_if_unhealthy"`
+}
+
+// RuleSet is the ordered list of rules at a version, the version changes with every modification of the rules
+type RuleSet struct {
+	Version int64            `json:"version"`
+	Rules   []RuleDefinition `json:"rules"`
+}
+
+type RulesStorage interface {
+	// List returns the rules ordered by position
+	List(ctx context.Context) (RuleSet, error)
+	Get(ctx context.Context, id int64) (RuleDefinition, error)
+	// Create stores the rule and returns it with the assigned id, a rule without position is appended
+	Create(ctx context.Context, rule RuleDefinition) (RuleDefinition, error)
+	Update(ctx context.Context, rule RuleDefinition) error
+	Delete(ctx context.Context, id int64) error
+	Version(ctx context.Context) (int64, error)
+}
+
+// ValidateRule checks the rule patterns, the errors wrap ErrInvalidRule
+func ValidateRule(rule RuleDefinition) error {
+	if len(rule.User) == 0 {
+		return fmt.Errorf("%w: user must be specified", ErrInvalidRule)
+	}
+
+	if _, err := regexp.Compile(rule.User); err != nil {
+		return fmt.Errorf("%w: invalid user pattern: %s", ErrInvalidRule, err.Error())
+	}
+
+	if _, err := regexp.Compile(rule.ClusterName); err != nil {
+		return fmt.Errorf("%w: invalid cluster name pattern: %s", ErrInvalidRule, err.Error())
+	}
+
+	if rule.Position < 0 {
+		return fmt.Errorf("%w: position must not be negative", ErrInvalidRule)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package routing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// DatabaseRulesStorage keeps the rules in the given table, the rules version is kept in the <table>_version
+// table and incremented in the same transaction of every change
+type DatabaseRulesStorage struct {
+	db           *sql.DB
+	table        string
+	versionTable string
+}
+
+func NewDatabaseRulesStorage(db *sql.DB, table string) *DatabaseRulesStorage {
+	return &DatabaseRulesStorage{
+		db:           db,
+		table:        table,
+		versionTable: table + "_version",
+	}
+}
+
+func (d DatabaseRulesStorage) List(ctx context.Context) (RuleSet, error) {
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	defer tx.Rollback()
+
+	version, err := d.version(ctx, tx)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	query := fmt.Sprintf(`SELECT id, position, "user", cluster_name, cluster_tags, use_default_if_unhealthy FROM %s ORDER BY position, id`, d.table)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	defer rows.Close()
+
+	rules := make([]RuleDefinition, 0)
+	for rows.Next() {
+		rule, err := ruleFromRow(rows)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return RuleSet{}, err
+	}
+
+	return RuleSet{Version: version, Rules: rules}, tx.Commit()
+}
+
+func (d DatabaseRulesStorage) Get(ctx context.Context, id int64) (RuleDefinition, error) {
+	query := fmt.Sprintf(`SELECT id, position, "user", cluster_name, cluster_tags, use_default_if_unhealthy FROM %s WHERE id = $1`, d.table)
+	rows, err := d.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return RuleDefinition{}, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return RuleDefinition{}, err
+		}
+		return RuleDefinition{}, ErrRuleNotFound
+	}
+
+	return ruleFromRow(rows)
+}
+
+func (d DatabaseRulesStorage) Create(ctx context.Context, rule RuleDefinition) (RuleDefinition, error) {
+	if err := ValidateRule(rule); err != nil {
+		return RuleDefinition{}, err
+	}
+
+	tags, err := json.Marshal(ruleTags(rule))
+	if err != nil {
+		return RuleDefinition{}, fmt.Errorf("error serializing tags: %w", err)
+	}
+
+	err = d.inTransaction(ctx, func(tx *sql.Tx) error {
+		if rule.Position == 0 {
+			query := fmt.Sprintf(`SELECT COALESCE(MAX(position), 0) + 1 FROM %s`, d.table)
+			if err := tx.QueryRowContext(ctx, query).Scan(&rule.Position); err != nil {
+				return err
+			}
+		}
+
+		query := fmt.Sprintf(`
+INSERT INTO %s (position, "user", cluster_name, cluster_tags, use_default_if_unhealthy) VALUES ($1, $2, $3, $4, $5)
+RETURNING id
+`, d.table)
+
+		return tx.QueryRowContext(ctx, query, rule.Position, rule.User, rule.ClusterName, tags, rule.UseDefaultIfUnhealthy).Scan(&rule.ID)
+	})
+
+	if err != nil {
+		return RuleDefinition{}, err
+	}
+
+	return rule, nil
+}
+
+func (d DatabaseRulesStorage) Update(ctx context.Context, rule RuleDefinition) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+
+	tags, err := json.Marshal(ruleTags(rule))
+	if err != nil {
+		return fmt.Errorf("error serializing tags: %w", err)
+	}
+
+	return d.inTransaction(ctx, func(tx *sql.Tx) error {
+		query := fmt.Sprintf(`
+UPDATE %s SET position = $2, "user" = $3, cluster_name = $4, cluster_tags = $5, use_default_if_unhealthy = $6
+WHERE id = $1
+`, d.table)
+
+		result, err := tx.ExecContext(ctx, query, rule.ID, rule.Position, rule.User, rule.ClusterName, tags, rule.UseDefaultIfUnhealthy)
+		if err != nil {
+			return err
+		}
+
+		return requireAffected(result)
+	})
+}
+
+func (d DatabaseRulesStorage) Delete(ctx context.Context, id int64) error {
+	return d.inTransaction(ctx, func(tx *sql.Tx) error {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, d.table)
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		return requireAffected(result)
+	})
+}
+
+func (d DatabaseRulesStorage) Version(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf(`SELECT version FROM %s`, d.versionTable)
+
+	var version int64
+	err := d.db.QueryRowContext(ctx, query).Scan(&version)
+	return version, err
+}
+
+func (d DatabaseRulesStorage) version(ctx context.Context, tx *sql.Tx) (int64, error) {
+	query := fmt.Sprintf(`SELECT version FROM %s`, d.versionTable)
+
+	var version int64
+	err := tx.QueryRowContext(ctx, query).Scan(&version)
+	return version, err
+}
+
+// inTransaction runs fn and increments the rules version in the same transaction
+func (d DatabaseRulesStorage) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET version = version + 1`, d.versionTable)
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+func ruleTags(rule RuleDefinition) map[string]string {
+	if rule.ClusterTags == nil {
+		return map[string]string{}
+	}
+	return rule.ClusterTags
+}
+
+func ruleFromRow(rows *sql.Rows) (RuleDefinition, error) {
+	var rule RuleDefinition
+	var tagsRaw string
+
+	if err := rows.Scan(&rule.ID, &rule.Position, &rule.User, &rule.ClusterName, &tagsRaw, &rule.UseDefaultIfUnhealthy); err != nil {
+		return RuleDefinition{}, err
+	}
+
+	if err := json.Unmarshal([]byte(tagsRaw), &rule.ClusterTags); err != nil {
+		return RuleDefinition{}, err
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,20 @@
+package routing
+
+import (
+	"context"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDatabaseRulesStorage(t *testing.T) {
+	ctx := context.Background()
+	container, db, err := tests.CreatePostgresDatabase(ctx, tests.WithInitScript("../../../resources/migrations/ddl-pg.sql"))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, container.Terminate(ctx))
+	}()
+
+	testRulesStorage(t, NewDatabaseRulesStorage(db, DefaultRulesTableName))
+}
@@ -0,0 +1,116 @@
+package routing
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryRulesStorage this is just for single node usage / testing purpose DO NOT use in production
+type MemoryRulesStorage struct {
+	mutex   *sync.Mutex
+	version int64
+	nextID  int64
+	rules   map[int64]RuleDefinition
+}
+
+func NewMemoryRulesStorage() *MemoryRulesStorage {
+	return &MemoryRulesStorage{
+		mutex:  &sync.Mutex{},
+		nextID: 1,
+		rules:  make(map[int64]RuleDefinition),
+	}
+}
+
+func (m *MemoryRulesStorage) List(ctx context.Context) (RuleSet, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	rules := make([]RuleDefinition, 0, len(m.rules))
+	for _, rule := range m.rules {
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Position != rules[j].Position {
+			return rules[i].Position < rules[j].Position
+		}
+		return rules[i].ID < rules[j].ID
+	})
+
+	return RuleSet{Version: m.version, Rules: rules}, nil
+}
+
+func (m *MemoryRulesStorage) Get(ctx context.Context, id int64) (RuleDefinition, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	rule, present := m.rules[id]
+	if !present {
+		return RuleDefinition{}, ErrRuleNotFound
+	}
+	return rule, nil
+}
+
+func (m *MemoryRulesStorage) Create(ctx context.Context, rule RuleDefinition) (RuleDefinition, error) {
+	if err := ValidateRule(rule); err != nil {
+		return RuleDefinition{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if rule.Position == 0 {
+		last := 0
+		for _, r := range m.rules {
+			if r.Position > last {
+				last = r.Position
+			}
+		}
+		rule.Position = last + 1
+	}
+
+	rule.ID = m.nextID
+	m.nextID++
+
+	m.rules[rule.ID] = rule
+	m.version++
+	return rule, nil
+}
+
+func (m *MemoryRulesStorage) Update(ctx context.Context, rule RuleDefinition) error {
+	if err := ValidateRule(rule); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, present := m.rules[rule.ID]; !present {
+		return ErrRuleNotFound
+	}
+
+	m.rules[rule.ID] = rule
+	m.version++
+	return nil
+}
+
+func (m *MemoryRulesStorage) Delete(ctx context.Context, id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, present := m.rules[id]; !present {
+		return ErrRuleNotFound
+	}
+
+	delete(m.rules, id)
+	m.version++
+	return nil
+}
+
+func (m *MemoryRulesStorage) Version(ctx context.Context) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.version, nil
+}
@@ -0,0 +1,92 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  RuleDefinition
+		valid bool
+	}{
+		{name: "valid", rule: RuleDefinition{User: "etl-(.+)", ClusterName: "cluster-0[0-9]"}, valid: true},
+		{name: "only tags", rule: RuleDefinition{User: "etl-(.+)", ClusterTags: map[string]string{"env": "prod"}}, valid: true},
+		{name: "missing user", rule: RuleDefinition{ClusterName: "cluster-00"}},
+		{name: "invalid user", rule: RuleDefinition{User: "etl-("}},
+		{name: "invalid cluster name", rule: RuleDefinition{User: "etl-(.+)", ClusterName: "["}},
+		{name: "negative position", rule: RuleDefinition{User: "etl-(.+)", Position: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRule(tt.rule)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, ErrInvalidRule))
+			}
+		})
+	}
+}
+
+func TestMemoryRulesStorage(t *testing.T) {
+	testRulesStorage(t, NewMemoryRulesStorage())
+}
+
+func testRulesStorage(t *testing.T, storage RulesStorage) {
+	ctx := context.Background()
+
+	version, err := storage.Version(ctx)
+	require.NoError(t, err)
+
+	first, err := storage.Create(ctx, RuleDefinition{
+		User:        "etl-(.+)",
+		ClusterName: "cluster-01",
+		ClusterTags: map[string]string{"workload": "etl"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, first.Position)
+
+	second, err := storage.Create(ctx, RuleDefinition{User: "analyst-(.+)", UseDefaultIfUnhealthy: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, second.Position)
+
+	_, err = storage.Create(ctx, RuleDefinition{User: "bi-("})
+	require.True(t, errors.Is(err, ErrInvalidRule))
+
+	set, err := storage.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, version+2, set.Version)
+	require.Len(t, set.Rules, 2)
+	require.Equal(t, first, set.Rules[0])
+	require.Equal(t, "analyst-(.+)", set.Rules[1].User)
+	require.True(t, set.Rules[1].UseDefaultIfUnhealthy)
+
+	// moving the second rule in front of the first one
+	second.Position = 0
+	require.NoError(t, storage.Update(ctx, second))
+
+	set, err = storage.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, version+3, set.Version)
+	require.Equal(t, []int64{second.ID, first.ID}, []int64{set.Rules[0].ID, set.Rules[1].ID})
+
+	rule, err := storage.Get(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, first, rule)
+
+	require.NoError(t, storage.Delete(ctx, first.ID))
+
+	_, err = storage.Get(ctx, first.ID)
+	require.Equal(t, ErrRuleNotFound, err)
+	require.Equal(t, ErrRuleNotFound, storage.Delete(ctx, first.ID))
+	require.Equal(t, ErrRuleNotFound, storage.Update(ctx, first))
+
+	current, err := storage.Version(ctx)
+	require.NoError(t, err)
+	require.Equal(t, version+4, current)
+}
@@ -23,3 +23,7 @@ func (r RunningQueriesRouter) Route(request Request) (models.Coordinator, error)
 
 	return selected.Coordinator, nil
 }
+
+func (r RunningQueriesRouter) Name() string {
+	return "less-running-queries"
+}
@@ -0,0 +1,129 @@
+package routing
+
+import (
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/statement"
+	"regexp"
+	"strings"
+)
+
+const (
+	HeaderCatalog = "X-Trino-Catalog"
+	HeaderSchema  = "X-Trino-Schema"
+)
+
+// StatementRule filters the coordinators for the statements matching the types and referencing at least one
+// table matching the catalog, schema and table patterns, the conditions not set are not checked
+type StatementRule struct {
+	Types   []statement.Type
+	Catalog *regexp.Regexp
+	Schema  *regexp.Regexp
+	Table   *regexp.Regexp
+	Cluster UserAwareClusterMatchRule
+	// Fallback keeps the coordinators unfiltered when no coordinator matches the cluster of the rule
+	Fallback bool
+}
+
+func (r StatementRule) matches(analysis statement.Analysis) bool {
+	if len(r.Types) != 0 && !containsType(r.Types, analysis.Type) {
+		return false
+	}
+
+	if r.Catalog == nil && r.Schema == nil && r.Table == nil {
+		return true
+	}
+
+	for _, table := range analysis.Tables {
+		if matchOrNil(r.Catalog, table.Catalog) && matchOrNil(r.Schema, table.Schema) && matchOrNil(r.Table, table.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name describes the rule conditions
+func (r StatementRule) Name() string {
+	parts := make([]string, 0)
+	if len(r.Types) != 0 {
+		types := make([]string, len(r.Types))
+		for i, t := range r.Types {
+			types[i] = string(t)
+		}
+		parts = append(parts, "types="+strings.Join(types, ","))
+	}
+
+	for _, condition := range []struct {
+		name string
+		re   *regexp.Regexp
+	}{{"catalog", r.Catalog}, {"schema", r.Schema}, {"table", r.Table}} {
+		if condition.re != nil {
+			parts = append(parts, fmt.Sprintf("%s=~%s", condition.name, condition.re.String()))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// StatementMatch describes how the statement rules have been applied to a request
+type StatementMatch struct {
+	Analysis statement.Analysis
+	// Rule is the name of the matched rule, empty if no rule matched
+	Rule     string
+	Fallback bool
+}
+
+// StatementRouter filters the coordinators using the sql of the submitted statement, the requests without
+// a statement or not matching any rule are not filtered
+type StatementRouter struct {
+	rules []StatementRule
+}
+
+func NewStatementRouter(rules []StatementRule) StatementRouter {
+	return StatementRouter{rules: rules}
+}
+
+// ReadsStatement is true when the router needs the statement of the submitted queries
+func (s StatementRouter) ReadsStatement() bool {
+	return len(s.rules) != 0
+}
+
+func (s StatementRouter) route(req Request) (Request, StatementMatch) {
+	if len(s.rules) == 0 || len(req.Statement) == 0 {
+		return req, StatementMatch{}
+	}
+
+	analysis := statement.Analyze(req.Statement, req.Headers.Get(HeaderCatalog), req.Headers.Get(HeaderSchema))
+	match := StatementMatch{Analysis: analysis}
+
+	for _, rule := range s.rules {
+		if !rule.matches(analysis) {
+			continue
+		}
+
+		match.Rule = rule.Name()
+
+		coordinators := filterByRule(rule.Cluster, req.Coordinators)
+		if len(coordinators) == 0 && rule.Fallback {
+			match.Fallback = true
+			return req, match
+		}
+
+		req.Coordinators = coordinators
+		return req, match
+	}
+
+	return req, match
+}
+
+func containsType(types []statement.Type, t statement.Type) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOrNil(re *regexp.Regexp, value string) bool {
+	return re == nil || re.MatchString(value)
+}
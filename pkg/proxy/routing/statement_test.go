@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/statement"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestStatementRouter(t *testing.T) {
+	router := NewStatementRouter([]StatementRule{
+		{
+			Types:   []statement.Type{statement.TypeInsert, statement.TypeCreateTableAsSelect, statement.TypeDDL},
+			Cluster: UserAwareClusterMatchRule{Tags: map[string]string{"workload": "etl"}},
+		},
+		{
+			Catalog: regexp.MustCompile("^iceberg$"),
+			Schema:  regexp.MustCompile("^marts$"),
+			Cluster: UserAwareClusterMatchRule{Name: regexp.MustCompile("cluster-02")},
+		},
+		{
+			Types:    []statement.Type{statement.TypeExplain},
+			Cluster:  UserAwareClusterMatchRule{Name: regexp.MustCompile("not-existing")},
+			Fallback: true,
+		},
+		{
+			Table:   regexp.MustCompile("^blocked$"),
+			Cluster: UserAwareClusterMatchRule{Name: regexp.MustCompile("not-existing")},
+		},
+	})
+
+	coordinators := []CoordinatorWithStatistics{
+		{Coordinator: models.Coordinator{Name: "cluster-00", Tags: map[string]string{"workload": "adhoc"}}},
+		{Coordinator: models.Coordinator{Name: "cluster-01", Tags: map[string]string{"workload": "etl"}}},
+		{Coordinator: models.Coordinator{Name: "cluster-02", Tags: map[string]string{"workload": "adhoc"}}},
+	}
+
+	tests := []struct {
+		name         string
+		statement    string
+		headers      http.Header
+		rule         string
+		fallback     bool
+		coordinators []string
+	}{
+		{name: "no statement", coordinators: []string{"cluster-00", "cluster-01", "cluster-02"}},
+		{name: "no matching rule", statement: "select * from events", coordinators: []string{"cluster-00", "cluster-01", "cluster-02"}},
+		{name: "insert", statement: "insert into t select * from s", rule: "types=insert,ctas,ddl", coordinators: []string{"cluster-01"}},
+		{name: "fully qualified table", statement: "select * from iceberg.marts.daily", rule: "catalog=~^iceberg$ schema=~^marts$", coordinators: []string{"cluster-02"}},
+		{
+			name:         "session catalog",
+			statement:    "select * from marts.daily",
+			headers:      http.Header{HeaderCatalog: []string{"iceberg"}},
+			rule:         "catalog=~^iceberg$ schema=~^marts$",
+			coordinators: []string{"cluster-02"},
+		},
+		{name: "fallback", statement: "explain select 1", rule: "types=explain", fallback: true, coordinators: []string{"cluster-00", "cluster-01", "cluster-02"}},
+		{name: "no coordinator", statement: "select * from blocked", rule: "table=~^blocked$", coordinators: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, match := router.route(Request{Statement: tt.statement, Headers: tt.headers, Coordinators: coordinators})
+			require.Equal(t, tt.rule, match.Rule)
+			require.Equal(t, tt.fallback, match.Fallback)
+			require.Equal(t, tt.coordinators, coordinatorNames(req.Coordinators))
+		})
+	}
+}
+
+func TestRouterExplainStatement(t *testing.T) {
+	router := New(NewUserAwareRouter(UserAwareRoutingConf{}), RoundRobin()).WithStatementRouter(NewStatementRouter([]StatementRule{
+		{Types: []statement.Type{statement.TypeInsert}, Cluster: UserAwareClusterMatchRule{Name: regexp.MustCompile("etl")}},
+	}))
+	require.True(t, router.ReadsStatement())
+	require.False(t, New(NewUserAwareRouter(UserAwareRoutingConf{}), RoundRobin()).ReadsStatement())
+
+	_, explanation, err := router.Explain(Request{
+		Statement: "insert into facts select * from staging",
+		Headers:   http.Header{HeaderCatalog: []string{"hive"}, HeaderSchema: []string{"dwh"}},
+		Coordinators: []CoordinatorWithStatistics{
+			{Coordinator: models.Coordinator{Name: "adhoc-0"}},
+			{Coordinator: models.Coordinator{Name: "etl-0"}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "insert", explanation.StatementType)
+	require.Equal(t, []string{"hive.dwh.facts", "hive.dwh.staging"}, explanation.Tables)
+	require.Equal(t, "types=insert", explanation.StatementRule)
+	require.Equal(t, []string{"etl-0"}, explanation.StatementMatching)
+	require.Equal(t, "etl-0", explanation.Coordinator)
+}
@@ -17,16 +17,45 @@ const (
 	NoMatchBehaviourDefault = "DEFAULT"
 )
 
+const (
+	// UserRuleNone is reported when no user aware rule is configured
+	UserRuleNone = "none"
+	// UserRuleDefault is reported when the user doesn't match any rule and the default cluster is used
+	UserRuleDefault = "default"
+)
+
 type UserAwareRoutingConf struct {
 	Default UserAwareDefault
 	Rules   []UserAwareRoutingRule
 }
 
+// UserAwareRoutingRule is applied to the requests matching both the user pattern and the matcher, the
+// conditions not set are not checked
 type UserAwareRoutingRule struct {
 	User    *regexp.Regexp
+	Match   Matcher
 	Cluster UserAwareClusterMatchRule
 }
 
+func (r UserAwareRoutingRule) matches(req Request) bool {
+	if r.User != nil && !r.User.MatchString(req.User) {
+		return false
+	}
+	return r.Match == nil || r.Match.Match(req)
+}
+
+// Name describes the rule conditions, the rules matching only the user are named by the user pattern
+func (r UserAwareRoutingRule) Name() string {
+	switch {
+	case r.Match == nil:
+		return r.User.String()
+	case r.User == nil:
+		return r.Match.String()
+	default:
+		return r.User.String() + " " + r.Match.String()
+	}
+}
+
 type UserAwareDefault struct {
 	Behaviour NoMatchBehaviour
 	Cluster   UserAwareClusterMatchRule
@@ -47,30 +76,54 @@ type UserAwareRouter struct {
 }
 
 func (u UserAwareRouter) Route(req Request) (Request, error) {
+	req, _, err := u.RouteWithMatch(req)
+	return req, err
+}
+
+// RouteWithMatch filters the request coordinators like Route and returns the name of the matched rule,
+// UserRuleDefault or UserRuleNone
+func (u UserAwareRouter) RouteWithMatch(req Request) (Request, string, error) {
+	req, match, err := u.route(req)
+	return req, match.Rule, err
+}
+
+// UserAwareMatch describes how the user aware rules have been applied to a request
+type UserAwareMatch struct {
+	// Rule is the name of the matched rule, UserRuleDefault or UserRuleNone
+	Rule string
+	// DefaultFallback is true when the matched rule had no available coordinator and the default cluster is used
+	DefaultFallback bool
+}
+
+func (u UserAwareRouter) route(req Request) (Request, UserAwareMatch, error) {
 	if len(u.conf.Rules) == 0 {
-		return req, nil
+		return req, UserAwareMatch{Rule: UserRuleNone}, nil
 	}
 
 	// test matching rule for the requester user
-	rule, matched := u.matchRule(req)
+	rule, matchedUser, matched := u.matchRule(req)
 
 	// if no rule is found we apply the configured default behaviour
 	if !matched {
 		if u.conf.Default.Behaviour == NoMatchBehaviourForbid {
-			return Request{}, ErrForbiddenRouting
+			return Request{}, UserAwareMatch{}, ErrForbiddenRouting
 		}
 		rule = u.conf.Default.Cluster
+		matchedUser = UserRuleDefault
 	}
 
+	match := UserAwareMatch{Rule: matchedUser}
+
 	// filter request's coordinator using the rule configuration
 	coordinators := filterByRule(rule, req.Coordinators)
 	// if no available coordinator is found we check if the rule have the failover on default  if unhealthy value set to true and eventually retrieve default coordinator info
 	if len(coordinators) == 0 && rule.UseDefaultIfUnhealthy {
 		coordinators = filterByRule(u.conf.Default.Cluster, req.Coordinators)
+		match.DefaultFallback = true
 	}
 
 	req.Coordinators = coordinators
-	return req, nil
+	return req, match, nil
 }
 
 func filterByRule(rule UserAwareClusterMatchRule, coordinators []CoordinatorWithStatistics) []CoordinatorWithStatistics {
@@ -91,13 +144,13 @@ func filterByRule(rule UserAwareClusterMatchRule, coordinators []CoordinatorWith
 	return coords
 }
 
-func (u UserAwareRouter) matchRule(req Request) (UserAwareClusterMatchRule, bool) {
+func (u UserAwareRouter) matchRule(req Request) (UserAwareClusterMatchRule, string, bool) {
 	for _, r := range u.conf.Rules {
-		if r.User.MatchString(req.User) {
-			return r.Cluster, true
+		if r.matches(req) {
+			return r.Cluster, r.Name(), true
 		}
 	}
-	return UserAwareClusterMatchRule{}, false
+	return UserAwareClusterMatchRule{}, "", false
 }
 
 func matchTags(source map[string]string, match map[string]string) bool {
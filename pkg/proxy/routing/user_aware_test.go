@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
 	"github.com/stretchr/testify/require"
+	"net/http"
 	"regexp"
 	"testing"
 )
@@ -427,3 +428,51 @@ func mustRegex(t *testing.T, raw string) *regexp.Regexp {
 	require.NoError(t, err)
 	return re
 }
+
+func TestUserAwareRouterMatchRules(t *testing.T) {
+	uar := NewUserAwareRouter(UserAwareRoutingConf{
+		Default: UserAwareDefault{
+			Behaviour: NoMatchBehaviourDefault,
+			Cluster:   UserAwareClusterMatchRule{Name: mustRegex(t, "cluster-00")},
+		},
+		Rules: []UserAwareRoutingRule{
+			{
+				User:    mustRegex(t, "bi-service"),
+				Match:   MatchSource(mustRegex(t, "^tableau")),
+				Cluster: UserAwareClusterMatchRule{Name: mustRegex(t, "cluster-01")},
+			},
+			{
+				Match:   MatchRoutingGroup("etl"),
+				Cluster: UserAwareClusterMatchRule{Name: mustRegex(t, "cluster-02")},
+			},
+		},
+	})
+
+	coordinators := []CoordinatorWithStatistics{
+		{Coordinator: models.Coordinator{Name: "cluster-00"}},
+		{Coordinator: models.Coordinator{Name: "cluster-01"}},
+		{Coordinator: models.Coordinator{Name: "cluster-02"}},
+	}
+
+	tests := []struct {
+		name        string
+		user        string
+		headers     http.Header
+		rule        string
+		coordinator string
+	}{
+		{name: "user and source", user: "bi-service", headers: http.Header{HeaderSource: []string{"tableau-server"}}, rule: "bi-service source=~^tableau", coordinator: "cluster-01"},
+		{name: "user without source", user: "bi-service", rule: UserRuleDefault, coordinator: "cluster-00"},
+		{name: "routing group", user: "anyone", headers: http.Header{HeaderRoutingGroup: []string{"etl"}}, rule: "routing_group=etl", coordinator: "cluster-02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, rule, err := uar.RouteWithMatch(Request{User: tt.user, Headers: tt.headers, Coordinators: coordinators})
+			require.NoError(t, err)
+			require.Equal(t, tt.rule, rule)
+			require.Len(t, req.Coordinators, 1)
+			require.Equal(t, tt.coordinator, req.Coordinators[0].Coordinator.Name)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package routing
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+// DefaultWeight is the weight of the coordinators without a valid weight tag
+const DefaultWeight = 1
+
+// Weight returns the weight of the coordinator from the weight tag, a missing, non numeric or negative
+// weight is the default weight. A coordinator with weight 0 receives no traffic
+func Weight(coordinator models.Coordinator) int {
+	raw, present := coordinator.Tags[models.TagWeight]
+	if !present {
+		return DefaultWeight
+	}
+
+	weight, err := strconv.Atoi(raw)
+	if err != nil || weight < 0 {
+		return DefaultWeight
+	}
+	return weight
+}
+
+// weights returns the weight of each coordinator, when every coordinator has weight 0 they are weighted
+// equally to keep serving the queries
+func weights(coordinators []CoordinatorWithStatistics) []int {
+	values := make([]int, len(coordinators))
+	total := 0
+	for i, c := range coordinators {
+		values[i] = Weight(c.Coordinator)
+		total += values[i]
+	}
+
+	if total == 0 {
+		for i := range values {
+			values[i] = DefaultWeight
+		}
+	}
+	return values
+}
+
+func WeightedRoundRobin() *WeightedRoundRobinRule {
+	return &WeightedRoundRobinRule{
+		current: make(map[string]int),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// WeightedRoundRobinRule is the smooth weighted round robin used by nginx: the coordinators are selected
+// proportionally to their weight and the selections of each coordinator are spread over the cycle
+type WeightedRoundRobinRule struct {
+	current map[string]int
+	mutex   *sync.Mutex
+}
+
+func (r *WeightedRoundRobinRule) Route(request Request) (models.Coordinator, error) {
+	values := weights(request.Coordinators)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	selected, total := r.next(request, values)
+	for i, c := range request.Coordinators {
+		r.current[c.Coordinator.Name] += values[i]
+	}
+	r.current[request.Coordinators[selected].Coordinator.Name] -= total
+
+	return request.Coordinators[selected].Coordinator, nil
+}
+
+func (r *WeightedRoundRobinRule) Peek(request Request) (models.Coordinator, error) {
+	values := weights(request.Coordinators)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	selected, _ := r.next(request, values)
+	return request.Coordinators[selected].Coordinator, nil
+}
+
+// next returns the index of the coordinator selected by the next Route and the total weight of the
+// coordinators, the caller must hold the mutex
+func (r *WeightedRoundRobinRule) next(request Request, values []int) (int, int) {
+	selected := -1
+	selectedCurrent := 0
+	total := 0
+	for i, c := range request.Coordinators {
+		if values[i] == 0 {
+			continue
+		}
+
+		current := r.current[c.Coordinator.Name] + values[i]
+		total += values[i]
+
+		if selected == -1 || current > selectedCurrent {
+			selected = i
+			selectedCurrent = current
+		}
+	}
+	return selected, total
+}
+
+func (r *WeightedRoundRobinRule) Name() string {
+	return "weighted-round-robin"
+}
+
+func WeightedRandom() WeightedRandomRouter {
+	return WeightedRandomRouter{}
+}
+
+// WeightedRandomRouter selects a random coordinator with a probability proportional to its weight
+type WeightedRandomRouter struct {
+}
+
+func (r WeightedRandomRouter) Route(request Request) (models.Coordinator, error) {
+	values := weights(request.Coordinators)
+
+	total := 0
+	for _, w := range values {
+		total += w
+	}
+
+	n := rand.Intn(total)
+	for i, w := range values {
+		if n < w {
+			return request.Coordinators[i].Coordinator, nil
+		}
+		n -= w
+	}
+
+	return request.Coordinators[len(request.Coordinators)-1].Coordinator, nil
+}
+
+func (r WeightedRandomRouter) Name() string {
+	return "weighted-random"
+}
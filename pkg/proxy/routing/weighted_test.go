@@ -0,0 +1,114 @@
+package routing
+
+import (
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/models"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func weightedCoordinator(name string, weight string) CoordinatorWithStatistics {
+	tags := map[string]string{}
+	if len(weight) != 0 {
+		tags[models.TagWeight] = weight
+	}
+	return CoordinatorWithStatistics{Coordinator: models.Coordinator{Name: name, Tags: tags}}
+}
+
+func routeCounts(t *testing.T, rule Rule, request Request, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		route, err := rule.Route(request)
+		require.NoError(t, err)
+		counts[route.Name]++
+	}
+	return counts
+}
+
+func TestWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		weight string
+		want   int
+	}{
+		{name: "missing", weight: "", want: DefaultWeight},
+		{name: "valid", weight: "4", want: 4},
+		{name: "zero", weight: "0", want: 0},
+		{name: "negative", weight: "-2", want: DefaultWeight},
+		{name: "invalid", weight: "heavy", want: DefaultWeight},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Weight(weightedCoordinator("test", tt.weight).Coordinator))
+		})
+	}
+}
+
+func TestWeightedRoundRobinRouting(t *testing.T) {
+	rule := WeightedRoundRobin()
+	request := Request{
+		User: "test",
+		Coordinators: []CoordinatorWithStatistics{
+			weightedCoordinator("test-0", "5"),
+			weightedCoordinator("test-1", "1"),
+			weightedCoordinator("test-2", "1"),
+		},
+	}
+
+	// the smooth weighted round robin spreads the selections of the heavier coordinator over the cycle
+	expected := []string{"test-0", "test-0", "test-1", "test-0", "test-2", "test-0", "test-0"}
+	for _, coord := range expected {
+		route, err := rule.Route(request)
+		require.NoError(t, err)
+		require.Equal(t, coord, route.Name)
+	}
+
+	require.Equal(t, map[string]int{"test-0": 500, "test-1": 100, "test-2": 100}, routeCounts(t, rule, request, 700))
+}
+
+func TestWeightedRoundRobinWeightChange(t *testing.T) {
+	rule := WeightedRoundRobin()
+	request := Request{
+		Coordinators: []CoordinatorWithStatistics{
+			weightedCoordinator("old", "4"),
+			weightedCoordinator("new", "0"),
+		},
+	}
+
+	require.Equal(t, map[string]int{"old": 100}, routeCounts(t, rule, request, 100))
+
+	request.Coordinators[0] = weightedCoordinator("old", "1")
+	request.Coordinators[1] = weightedCoordinator("new", "3")
+
+	counts := routeCounts(t, rule, request, 400)
+	require.InDelta(t, 300, counts["new"], 4)
+	require.InDelta(t, 100, counts["old"], 4)
+}
+
+func TestWeightedRoundRobinAllZero(t *testing.T) {
+	rule := WeightedRoundRobin()
+	request := Request{
+		Coordinators: []CoordinatorWithStatistics{
+			weightedCoordinator("test-0", "0"),
+			weightedCoordinator("test-1", "0"),
+		},
+	}
+
+	require.Equal(t, map[string]int{"test-0": 50, "test-1": 50}, routeCounts(t, rule, request, 100))
+}
+
+func TestWeightedRandomRouting(t *testing.T) {
+	rule := WeightedRandom()
+	request := Request{
+		Coordinators: []CoordinatorWithStatistics{
+			weightedCoordinator("test-0", "4"),
+			weightedCoordinator("test-1", "1"),
+			weightedCoordinator("test-2", "0"),
+		},
+	}
+
+	counts := routeCounts(t, rule, request, 5000)
+	require.Zero(t, counts["test-2"])
+	require.InDelta(t, 4000, counts["test-0"], 250)
+	require.InDelta(t, 1000, counts["test-1"], 250)
+}
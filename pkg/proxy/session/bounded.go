@@ -0,0 +1,187 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/metrics"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheMaxEntries = 100000
+	DefaultCacheShards     = 16
+)
+
+type BoundedMemoryConf struct {
+	// MaxEntries is the maximum number of links, the least recently used links are evicted first
+	MaxEntries int
+	// TTL is the lifetime of a link since the last Link, 0 disables the expiration
+	TTL time.Duration
+	// Shards is the number of independently locked partitions of the cache
+	Shards int
+}
+
+// BoundedMemory is an in memory Storage with a maximum number of entries, LRU eviction and per entry TTL.
+// The keys are partitioned in shards with their own lock to reduce contention
+type BoundedMemory struct {
+	shards []*cacheShard
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+type cacheShard struct {
+	mutex      *sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type cacheEntry struct {
+	key         string
+	coordinator string
+	expiresAt   time.Time
+}
+
+func NewBoundedMemoryStorage(conf BoundedMemoryConf) *BoundedMemory {
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = DefaultCacheMaxEntries
+	}
+
+	if conf.Shards <= 0 {
+		conf.Shards = DefaultCacheShards
+	}
+
+	if conf.Shards > conf.MaxEntries {
+		conf.Shards = conf.MaxEntries
+	}
+
+	// the capacity is split evenly, rounding up to never store less than MaxEntries
+	perShard := (conf.MaxEntries + conf.Shards - 1) / conf.Shards
+
+	shards := make([]*cacheShard, conf.Shards)
+	for i := range shards {
+		shards[i] = &cacheShard{
+			mutex:      &sync.Mutex{},
+			maxEntries: perShard,
+			entries:    make(map[string]*list.Element),
+			lru:        list.New(),
+		}
+	}
+
+	return &BoundedMemory{
+		shards: shards,
+		now:    time.Now,
+		ttl:    conf.TTL,
+	}
+}
+
+func (b *BoundedMemory) Link(ctx context.Context, info trino.QueryInfo, coordinator string) error {
+	key := b.queryHash(info)
+	shard := b.shard(key)
+
+	var expiresAt time.Time
+	if b.ttl > 0 {
+		expiresAt = b.now().Add(b.ttl)
+	}
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if element, present := shard.entries[key]; present {
+		entry := element.Value.(*cacheEntry)
+		entry.coordinator = coordinator
+		entry.expiresAt = expiresAt
+		shard.lru.MoveToFront(element)
+		return nil
+	}
+
+	shard.entries[key] = shard.lru.PushFront(&cacheEntry{
+		key:         key,
+		coordinator: coordinator,
+		expiresAt:   expiresAt,
+	})
+
+	b.evictExpired(shard)
+
+	for shard.lru.Len() > shard.maxEntries {
+		b.evict(shard, shard.lru.Back(), metrics.SessionCacheEvictionCapacity)
+	}
+
+	return nil
+}
+
+func (b *BoundedMemory) Unlink(ctx context.Context, info trino.QueryInfo) error {
+	key := b.queryHash(info)
+	shard := b.shard(key)
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if element, present := shard.entries[key]; present {
+		shard.lru.Remove(element)
+		delete(shard.entries, key)
+	}
+
+	return nil
+}
+
+// Evict removes the link, the storage is local to the proxy instance
+func (b *BoundedMemory) Evict(ctx context.Context, info trino.QueryInfo) error {
+	return b.Unlink(ctx, info)
+}
+
+func (b *BoundedMemory) Get(ctx context.Context, info trino.QueryInfo) (string, error) {
+	key := b.queryHash(info)
+	shard := b.shard(key)
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	element, present := shard.entries[key]
+	if !present {
+		return "", ErrLinkNotFound
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if b.expired(entry) {
+		b.evict(shard, element, metrics.SessionCacheEvictionExpired)
+		return "", ErrLinkNotFound
+	}
+
+	shard.lru.MoveToFront(element)
+	return entry.coordinator, nil
+}
+
+// evictExpired removes the expired entries from the least recently used side of the shard, the entries not
+// requested anymore ( e.g. abandoned queries ) are removed without waiting for the cache to be full
+func (b *BoundedMemory) evictExpired(shard *cacheShard) {
+	for back := shard.lru.Back(); back != nil && b.expired(back.Value.(*cacheEntry)); back = shard.lru.Back() {
+		b.evict(shard, back, metrics.SessionCacheEvictionExpired)
+	}
+}
+
+func (b *BoundedMemory) expired(entry *cacheEntry) bool {
+	return !entry.expiresAt.IsZero() && !b.now().Before(entry.expiresAt)
+}
+
+// evict removes the element from the shard, the caller must hold the shard lock
+func (b *BoundedMemory) evict(shard *cacheShard, element *list.Element, reason string) {
+	entry := shard.lru.Remove(element).(*cacheEntry)
+	delete(shard.entries, entry.key)
+
+	metrics.ObserveSessionCacheEviction(reason)
+}
+
+func (b *BoundedMemory) shard(key string) *cacheShard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return b.shards[hash.Sum32()%uint32(len(b.shards))]
+}
+
+func (b *BoundedMemory) queryHash(info trino.QueryInfo) string {
+	return fmt.Sprintf("%s::%s", info.TransactionID, info.QueryID)
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func queryInfo(id string) trino.QueryInfo {
+	return trino.QueryInfo{QueryID: id, TransactionID: "tx"}
+}
+
+func entries(storage *BoundedMemory) int {
+	count := 0
+	for _, shard := range storage.shards {
+		shard.mutex.Lock()
+		count += shard.lru.Len()
+		shard.mutex.Unlock()
+	}
+	return count
+}
+
+func TestBoundedMemoryLinkCluster(t *testing.T) {
+	storage := NewBoundedMemoryStorage(BoundedMemoryConf{MaxEntries: 10})
+	ctx := context.TODO()
+
+	require.NoError(t, storage.Link(ctx, queryInfo("q0"), "coordinator-0"))
+
+	coordinator, err := storage.Get(ctx, queryInfo("q0"))
+	require.NoError(t, err)
+	require.Equal(t, "coordinator-0", coordinator)
+
+	require.NoError(t, storage.Unlink(ctx, queryInfo("q0")))
+
+	_, err = storage.Get(ctx, queryInfo("q0"))
+	require.True(t, errors.Is(err, ErrLinkNotFound))
+}
+
+func TestBoundedMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	storage := NewBoundedMemoryStorage(BoundedMemoryConf{MaxEntries: 2, Shards: 1})
+	ctx := context.TODO()
+
+	require.NoError(t, storage.Link(ctx, queryInfo("q0"), "coordinator-0"))
+	require.NoError(t, storage.Link(ctx, queryInfo("q1"), "coordinator-0"))
+
+	// q0 becomes the most recently used, q1 is evicted by the next link
+	_, err := storage.Get(ctx, queryInfo("q0"))
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Link(ctx, queryInfo("q2"), "coordinator-0"))
+
+	_, err = storage.Get(ctx, queryInfo("q1"))
+	require.True(t, errors.Is(err, ErrLinkNotFound))
+
+	_, err = storage.Get(ctx, queryInfo("q0"))
+	require.NoError(t, err)
+	_, err = storage.Get(ctx, queryInfo("q2"))
+	require.NoError(t, err)
+
+	require.Equal(t, 2, entries(storage))
+}
+
+func TestBoundedMemoryExpiresEntries(t *testing.T) {
+	storage := NewBoundedMemoryStorage(BoundedMemoryConf{MaxEntries: 10, Shards: 1, TTL: time.Minute})
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	storage.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	require.NoError(t, storage.Link(ctx, queryInfo("q0"), "coordinator-0"))
+	require.NoError(t, storage.Link(ctx, queryInfo("q1"), "coordinator-0"))
+
+	now = now.Add(30 * time.Second)
+	_, err := storage.Get(ctx, queryInfo("q0"))
+	require.NoError(t, err)
+
+	// linking again renews the ttl
+	require.NoError(t, storage.Link(ctx, queryInfo("q0"), "coordinator-1"))
+
+	now = now.Add(time.Minute)
+	_, err = storage.Get(ctx, queryInfo("q1"))
+	require.True(t, errors.Is(err, ErrLinkNotFound))
+
+	now = now.Add(-30 * time.Second)
+	coordinator, err := storage.Get(ctx, queryInfo("q0"))
+	require.NoError(t, err)
+	require.Equal(t, "coordinator-1", coordinator)
+
+	require.Equal(t, 1, entries(storage))
+}
+
+func TestBoundedMemoryRemovesExpiredEntriesOnLink(t *testing.T) {
+	storage := NewBoundedMemoryStorage(BoundedMemoryConf{MaxEntries: 10, Shards: 1, TTL: time.Minute})
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	storage.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	require.NoError(t, storage.Link(ctx, queryInfo("abandoned-0"), "coordinator-0"))
+	require.NoError(t, storage.Link(ctx, queryInfo("abandoned-1"), "coordinator-0"))
+
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, storage.Link(ctx, queryInfo("q0"), "coordinator-0"))
+
+	require.Equal(t, 1, entries(storage))
+}
+
+func TestBoundedMemoryConcurrentAccess(t *testing.T) {
+	storage := NewBoundedMemoryStorage(BoundedMemoryConf{MaxEntries: 100, Shards: 4})
+	ctx := context.TODO()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				info := queryInfo(fmt.Sprintf("q-%d-%d", worker, j))
+				require.NoError(t, storage.Link(ctx, info, "coordinator-0"))
+				_, _ = storage.Get(ctx, info)
+				require.NoError(t, storage.Unlink(ctx, info))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, 0, entries(storage))
+}
@@ -3,9 +3,11 @@ package session
 import (
 	"context"
 	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/proxy/metrics"
+	"time"
 )
 
-func NewStorageCache(source Storage, cache *Memory) *StorageCache {
+func NewStorageCache(source Storage, cache Storage) *StorageCache {
 	return &StorageCache{
 		cache:  cache,
 		source: source,
@@ -13,11 +15,11 @@ func NewStorageCache(source Storage, cache *Memory) *StorageCache {
 }
 
 type StorageCache struct {
-	cache  *Memory
+	cache  Storage
 	source Storage
 }
 
-func NewCaching(source Storage, cache *Memory) *StorageCache {
+func NewCaching(source Storage, cache Storage) *StorageCache {
 	return &StorageCache{
 		source: source,
 		cache:  cache,
@@ -25,6 +27,8 @@ func NewCaching(source Storage, cache *Memory) *StorageCache {
 }
 
 func (s StorageCache) Link(ctx context.Context, info trino.QueryInfo, coordinator string) error {
+	defer observeOperation("link", time.Now())
+
 	if err := s.cache.Link(ctx, info, coordinator); err != nil {
 		return err
 	}
@@ -36,6 +40,8 @@ func (s StorageCache) Link(ctx context.Context, info trino.QueryInfo, coordinato
 }
 
 func (s StorageCache) Unlink(ctx context.Context, info trino.QueryInfo) error {
+	defer observeOperation("unlink", time.Now())
+
 	if err := s.cache.Unlink(ctx, info); err != nil {
 		return err
 	}
@@ -49,16 +55,26 @@ func (s StorageCache) Unlink(ctx context.Context, info trino.QueryInfo) error {
 	return nil
 }
 
+// Evict removes the link from the cache only, the link in the source is still used by the other proxy instances
+func (s StorageCache) Evict(ctx context.Context, info trino.QueryInfo) error {
+	return s.cache.Unlink(ctx, info)
+}
+
 func (s StorageCache) Get(ctx context.Context, info trino.QueryInfo) (string, error) {
+	defer observeOperation("get", time.Now())
+
 	cached, err := s.cache.Get(ctx, info)
 	if err != nil {
 		if err != ErrLinkNotFound {
 			return "", err
 		}
 	} else {
+		metrics.ObserveSessionCacheLookup(metrics.SessionCacheHit)
 		return cached, nil
 	}
 
+	metrics.ObserveSessionCacheLookup(metrics.SessionCacheMiss)
+
 	value, err := s.source.Get(ctx, info)
 	if err != nil {
 		return "", err
@@ -70,3 +86,7 @@ func (s StorageCache) Get(ctx context.Context, info trino.QueryInfo) (string, er
 
 	return value, nil
 }
+
+func observeOperation(operation string, start time.Time) {
+	metrics.ObserveSessionStoreOperation(operation, time.Since(start))
+}
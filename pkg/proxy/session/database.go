@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/logging"
+	"time"
+)
+
+const (
+	DefaultDatabaseTableName = "trino_sessions"
+)
+
+// DatabaseLinkerStorage stores the links in a postgres table, every link expires after the ttl.
+// Expired links are ignored by Get and removed by CleanupExpired
+type DatabaseLinkerStorage struct {
+	db    *sql.DB
+	table string
+	ttl   time.Duration
+}
+
+func NewDatabaseStorage(db *sql.DB, table string, ttl time.Duration) DatabaseLinkerStorage {
+	return DatabaseLinkerStorage{
+		db:    db,
+		table: table,
+		ttl:   ttl,
+	}
+}
+
+func (d DatabaseLinkerStorage) Link(ctx context.Context, info trino.QueryInfo, coordinator string) error {
+	// the expiration is computed by the database to avoid depending on the proxies clock
+	query := fmt.Sprintf(`
+INSERT INTO %s (transaction_id, query_id, coordinator, expires_at) VALUES ($1, $2, $3, now() + $4::interval)
+ON CONFLICT (transaction_id, query_id) DO UPDATE SET coordinator = excluded.coordinator, expires_at = excluded.expires_at
+`, d.table)
+
+	_, err := d.db.ExecContext(ctx, query, info.TransactionID, info.QueryID, coordinator, fmt.Sprintf("%d microseconds", d.ttl.Microseconds()))
+	return err
+}
+
+func (d DatabaseLinkerStorage) Unlink(ctx context.Context, info trino.QueryInfo) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE transaction_id = $1 AND query_id = $2", d.table)
+	_, err := d.db.ExecContext(ctx, query, info.TransactionID, info.QueryID)
+	return err
+}
+
+func (d DatabaseLinkerStorage) Get(ctx context.Context, info trino.QueryInfo) (string, error) {
+	query := fmt.Sprintf("SELECT coordinator FROM %s WHERE transaction_id = $1 AND query_id = $2 AND expires_at > now()", d.table)
+
+	var coordinator string
+	err := d.db.QueryRowContext(ctx, query, info.TransactionID, info.QueryID).Scan(&coordinator)
+	if err == sql.ErrNoRows {
+		return "", ErrLinkNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return coordinator, nil
+}
+
+// CleanupExpired removes the expired links and returns the number of removed rows
+func (d DatabaseLinkerStorage) CleanupExpired(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE expires_at <= now()", d.table)
+	result, err := d.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RunCleanup removes the expired links every interval until the context is done
+func (d DatabaseLinkerStorage) RunCleanup(ctx context.Context, interval time.Duration, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := d.CleanupExpired(ctx)
+			if err != nil {
+				logger.Warn("error removing expired sessions: %s", err.Error())
+				continue
+			}
+			logger.Debug("removed %d expired sessions", removed)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
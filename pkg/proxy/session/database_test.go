@@ -0,0 +1,56 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/api/trino"
+	"github.com/The-Data-Appeal-Company/trino-loadbalancer/pkg/common/tests"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDatabaseLinkerStorage(t *testing.T) {
+	ctx := context.Background()
+	container, db, err := tests.CreatePostgresDatabase(ctx, tests.WithInitScript("../../../resources/migrations/ddl-pg.sql"))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, container.Terminate(ctx))
+	}()
+
+	storage := NewDatabaseStorage(db, DefaultDatabaseTableName, 10*time.Minute)
+
+	queryInfo := trino.QueryInfo{
+		User:          "user",
+		QueryID:       "query",
+		TransactionID: "tx",
+	}
+
+	_, err = storage.Get(ctx, queryInfo)
+	require.True(t, errors.Is(err, ErrLinkNotFound))
+
+	require.NoError(t, storage.Link(ctx, queryInfo, "coordinator-0"))
+	// linking again moves the query to the new coordinator
+	require.NoError(t, storage.Link(ctx, queryInfo, "coordinator-1"))
+
+	coordinator, err := storage.Get(ctx, queryInfo)
+	require.NoError(t, err)
+	require.Equal(t, "coordinator-1", coordinator)
+
+	require.NoError(t, storage.Unlink(ctx, queryInfo))
+
+	_, err = storage.Get(ctx, queryInfo)
+	require.True(t, errors.Is(err, ErrLinkNotFound))
+
+	// expired links are not returned and are removed by the cleanup
+	expiring := NewDatabaseStorage(db, DefaultDatabaseTableName, -time.Second)
+	require.NoError(t, expiring.Link(ctx, queryInfo, "coordinator-0"))
+
+	_, err = storage.Get(ctx, queryInfo)
+	require.True(t, errors.Is(err, ErrLinkNotFound))
+
+	removed, err := storage.CleanupExpired(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+}
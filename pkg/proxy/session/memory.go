@@ -37,6 +37,11 @@ func (m *Memory) Unlink(ctx context.Context, info trino.QueryInfo) error {
 	return nil
 }
 
+// Evict removes the link, the storage is local to the proxy instance
+func (m *Memory) Evict(ctx context.Context, info trino.QueryInfo) error {
+	return m.Unlink(ctx, info)
+}
+
 func (m *Memory) Get(ctx context.Context, info trino.QueryInfo) (string, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
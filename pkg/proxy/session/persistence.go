@@ -24,3 +24,9 @@ type Storage interface {
 	Unlink(context.Context, trino.QueryInfo) error
 	Get(context.Context, trino.QueryInfo) (string, error)
 }
+
+// Evictor is implemented by the storages keeping a local copy of the links, Evict removes only the local copy
+// and leaves the links shared with the other proxy instances to the expiration of the store
+type Evictor interface {
+	Evict(context.Context, trino.QueryInfo) error
+}
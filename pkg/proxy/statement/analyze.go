@@ -0,0 +1,353 @@
+package statement
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Type string
+
+const (
+	TypeSelect Type = "select"
+	TypeInsert Type = "insert"
+	// TypeCreateTableAsSelect is a CREATE TABLE ... AS query
+	TypeCreateTableAsSelect Type = "ctas"
+	TypeDDL                 Type = "ddl"
+	TypeExplain             Type = "explain"
+	// TypeDML are the statements modifying the rows of a table: UPDATE, DELETE, MERGE and TRUNCATE
+	TypeDML Type = "dml"
+	// TypeOther are the session, metadata and transaction statements like SHOW, DESCRIBE, USE or SET SESSION
+	TypeOther Type = "other"
+)
+
+var Types = []Type{TypeSelect, TypeInsert, TypeCreateTableAsSelect, TypeDDL, TypeExplain, TypeDML, TypeOther}
+
+func ParseType(raw string) (Type, error) {
+	for _, t := range Types {
+		if strings.EqualFold(raw, string(t)) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("invalid statement type: %s", raw)
+}
+
+// Table is a table referenced by a statement, the parts not specified in the statement are resolved with the
+// session catalog and schema and are empty if the session has none
+type Table struct {
+	Catalog string
+	Schema  string
+	Name    string
+}
+
+func (t Table) String() string {
+	return t.Catalog + "." + t.Schema + "." + t.Name
+}
+
+type Analysis struct {
+	Type   Type
+	Tables []Table
+}
+
+// keywords that can precede a subquery, a parenthesis after any other word is a function call
+var subqueryKeywords = map[string]bool{
+	"from": true, "join": true, "in": true, "exists": true, "as": true, "on": true, "where": true, "and": true,
+	"or": true, "not": true, "union": true, "intersect": true, "except": true, "all": true, "any": true,
+	"some": true, "lateral": true, "select": true, "with": true, "values": true, "then": true, "else": true,
+	"when": true, "by": true, "having": true, "explain": true, "distinct": true, "array": true,
+}
+
+// words ending a table reference, they can't be an alias
+var clauseKeywords = map[string]bool{
+	"where": true, "join": true, "left": true, "right": true, "inner": true, "outer": true, "cross": true,
+	"full": true, "natural": true, "on": true, "using": true, "group": true, "order": true, "limit": true,
+	"offset": true, "fetch": true, "having": true, "union": true, "intersect": true, "except": true,
+	"window": true, "tablesample": true, "set": true, "when": true, "values": true, "select": true,
+	"with": true, "as": true, "for": true, "match_recognize": true, "rename": true, "add": true, "drop": true,
+	"alter": true, "execute": true, "comment": true,
+}
+
+// Analyze returns the type of the statement and the tables it references, the session catalog and schema
+// are used to resolve the partially qualified names
+func Analyze(sql string, catalog string, schema string) Analysis {
+	tokens := tokenize(sql)
+	return Analysis{
+		Type:   statementType(tokens),
+		Tables: referencedTables(tokens, catalog, schema),
+	}
+}
+
+func statementType(tokens []token) Type {
+	i := 0
+	for i < len(tokens) && tokens[i].isSymbol("(") {
+		i++
+	}
+
+	if i == len(tokens) || tokens[i].kind != tokenWord {
+		return TypeOther
+	}
+
+	switch tokens[i].text {
+	case "select", "with", "values", "table":
+		return TypeSelect
+	case "insert":
+		return TypeInsert
+	case "explain":
+		return TypeExplain
+	case "update", "delete", "merge", "truncate":
+		return TypeDML
+	case "create":
+		if isCreateTableAsSelect(tokens[i+1:]) {
+			return TypeCreateTableAsSelect
+		}
+		return TypeDDL
+	case "drop", "alter", "comment", "grant", "revoke", "deny", "refresh":
+		return TypeDDL
+	default:
+		return TypeOther
+	}
+}
+
+// isCreateTableAsSelect checks the tokens after CREATE, a CTAS has an AS outside of the parenthesis of the
+// columns and of the properties
+func isCreateTableAsSelect(tokens []token) bool {
+	i := 0
+	if i+1 < len(tokens) && tokens[i].isWord("or") && tokens[i+1].isWord("replace") {
+		i += 2
+	}
+
+	if i >= len(tokens) || !tokens[i].isWord("table") {
+		return false
+	}
+
+	depth := 0
+	for _, t := range tokens[i+1:] {
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		case depth == 0 && t.isWord("as"):
+			return true
+		}
+	}
+	return false
+}
+
+func referencedTables(tokens []token, catalog string, schema string) []Table {
+	ctes := commonTableExpressions(tokens)
+	functionCalls := functionCallDepths(tokens)
+
+	tables := make([]Table, 0)
+	seen := make(map[Table]bool)
+
+	add := func(parts []string) {
+		if len(parts) == 1 && ctes[parts[0]] {
+			return
+		}
+
+		table := resolve(parts, catalog, schema)
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != tokenWord {
+			continue
+		}
+
+		switch t.text {
+		case "from", "join":
+			// FROM inside a function call is part of the function syntax, eg. extract(year from ts), and
+			// IS DISTINCT FROM is a comparison
+			if functionCalls[i] || i > 0 && tokens[i-1].isWord("distinct") {
+				continue
+			}
+			i = relationList(tokens, i+1, add) - 1
+		case "into", "update", "table", "view", "using":
+			// UPDATE SET is the update action of MERGE
+			if t.text == "update" && i+1 < len(tokens) && tokens[i+1].isWord("set") {
+				continue
+			}
+
+			if parts, next := qualifiedName(tokens, i+1); len(parts) != 0 {
+				add(parts)
+				i = next - 1
+			}
+		}
+	}
+
+	return tables
+}
+
+// relationList reads the comma separated relations after FROM, subqueries and table functions are skipped
+// and their tables are read by the caller. It returns the position after the relations
+func relationList(tokens []token, start int, add func([]string)) int {
+	i := start
+	for i < len(tokens) {
+		if tokens[i].isWord("lateral", "unnest") || !tokens[i].isName() {
+			return i
+		}
+
+		parts, next := qualifiedName(tokens, i)
+		if len(parts) == 0 {
+			return i
+		}
+
+		// a name followed by a parenthesis is a table function
+		if next < len(tokens) && tokens[next].isSymbol("(") {
+			return next
+		}
+
+		add(parts)
+		i = skipAlias(tokens, next)
+
+		if i >= len(tokens) || !tokens[i].isSymbol(",") {
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+func skipAlias(tokens []token, i int) int {
+	if i < len(tokens) && tokens[i].isWord("as") {
+		i++
+	}
+
+	if i < len(tokens) && tokens[i].isName() && !(tokens[i].kind == tokenWord && clauseKeywords[tokens[i].text]) {
+		i++
+		// column aliases, eg. t (a, b)
+		if i < len(tokens) && tokens[i].isSymbol("(") {
+			i = skipParenthesis(tokens, i)
+		}
+	}
+	return i
+}
+
+// qualifiedName reads a dot separated name, it returns no parts if there is no name at the position
+func qualifiedName(tokens []token, start int) ([]string, int) {
+	parts := make([]string, 0, 3)
+
+	i := start
+	// IF [NOT] EXISTS precedes the name on the DDL statements
+	if i+1 < len(tokens) && tokens[i].isWord("if") {
+		i++
+		if tokens[i].isWord("not") {
+			i++
+		}
+		if i < len(tokens) && tokens[i].isWord("exists") {
+			i++
+		}
+	}
+
+	for i < len(tokens) && tokens[i].isName() {
+		parts = append(parts, tokens[i].text)
+		i++
+
+		if i+1 < len(tokens) && tokens[i].isSymbol(".") && tokens[i+1].isName() {
+			i++
+			continue
+		}
+		break
+	}
+
+	if len(parts) > 3 {
+		return nil, start
+	}
+	return parts, i
+}
+
+// commonTableExpressions returns the names defined by the WITH clauses: WITH [RECURSIVE] name [(columns)] AS (query)
+func commonTableExpressions(tokens []token) map[string]bool {
+	names := make(map[string]bool)
+
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].isWord("with") {
+			continue
+		}
+
+		j := i + 1
+		if j < len(tokens) && tokens[j].isWord("recursive") {
+			j++
+		}
+
+		for j < len(tokens) && tokens[j].isName() {
+			name := tokens[j].text
+			j++
+
+			if j < len(tokens) && tokens[j].isSymbol("(") {
+				j = skipParenthesis(tokens, j)
+			}
+
+			if j+1 >= len(tokens) || !tokens[j].isWord("as") || !tokens[j+1].isSymbol("(") {
+				break
+			}
+
+			names[name] = true
+			j = skipParenthesis(tokens, j+1)
+
+			if j >= len(tokens) || !tokens[j].isSymbol(",") {
+				break
+			}
+			j++
+		}
+	}
+
+	return names
+}
+
+// functionCallDepths marks the tokens inside the parenthesis of a function call
+func functionCallDepths(tokens []token) map[int]bool {
+	inside := make(map[int]bool)
+
+	// stack of the open parenthesis, true if the parenthesis is a function call
+	stack := make([]bool, 0)
+	for i, t := range tokens {
+		switch {
+		case t.isSymbol("("):
+			call := i > 0 && tokens[i-1].isName() && !(tokens[i-1].kind == tokenWord && subqueryKeywords[tokens[i-1].text])
+			stack = append(stack, call)
+		case t.isSymbol(")"):
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			if len(stack) > 0 && stack[len(stack)-1] {
+				inside[i] = true
+			}
+		}
+	}
+
+	return inside
+}
+
+// skipParenthesis returns the position after the parenthesis closing the one at start
+func skipParenthesis(tokens []token, start int) int {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch {
+		case tokens[i].isSymbol("("):
+			depth++
+		case tokens[i].isSymbol(")"):
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(tokens)
+}
+
+func resolve(parts []string, catalog string, schema string) Table {
+	switch len(parts) {
+	case 1:
+		return Table{Catalog: strings.ToLower(catalog), Schema: strings.ToLower(schema), Name: parts[0]}
+	case 2:
+		return Table{Catalog: strings.ToLower(catalog), Schema: parts[0], Name: parts[1]}
+	default:
+		return Table{Catalog: parts[0], Schema: parts[1], Name: parts[2]}
+	}
+}
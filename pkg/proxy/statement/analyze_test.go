@@ -0,0 +1,148 @@
+package statement
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func tableNames(tables []Table) []string {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = table.String()
+	}
+	return names
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		statement Type
+		tables    []string
+	}{
+		{
+			name:      "select",
+			sql:       "SELECT a, b FROM orders o JOIN sales.customers c ON o.id = c.id WHERE o.ts > DATE '2021-01-01'",
+			statement: TypeSelect,
+			tables:    []string{"hive.default.orders", "hive.sales.customers"},
+		},
+		{
+			name:      "comma separated relations",
+			sql:       "select * from iceberg.raw.events e, \"Users\" AS u (id, name) where e.user_id = u.id",
+			statement: TypeSelect,
+			tables:    []string{"iceberg.raw.events", "hive.default.users"},
+		},
+		{
+			name:      "subqueries and ctes",
+			sql:       "WITH recent AS (SELECT * FROM events WHERE ts > now()), top (id) AS (SELECT id FROM recent) SELECT * FROM (SELECT * FROM top) t WHERE id IN (SELECT id FROM blocked)",
+			statement: TypeSelect,
+			tables:    []string{"hive.default.events", "hive.default.blocked"},
+		},
+		{
+			name:      "function syntax is not a relation",
+			sql:       "select extract(year from ts), substring(name from 2 for 3), coalesce((select max(id) from ids), 0) from t where a is distinct from b",
+			statement: TypeSelect,
+			tables:    []string{"hive.default.ids", "hive.default.t"},
+		},
+		{
+			name:      "comments and literals",
+			sql:       "-- from comment\n/* select * from hidden */ select 'from literal', \"from\" from visible",
+			statement: TypeSelect,
+			tables:    []string{"hive.default.visible"},
+		},
+		{
+			name:      "table functions and unnest",
+			sql:       "select * from unnest(array[1, 2]) as x (n) cross join lateral (select * from inner_table) y",
+			statement: TypeSelect,
+			tables:    []string{"hive.default.inner_table"},
+		},
+		{
+			name:      "insert",
+			sql:       "INSERT INTO warehouse.facts (a, b) SELECT a, b FROM staging.facts",
+			statement: TypeInsert,
+			tables:    []string{"hive.warehouse.facts", "hive.staging.facts"},
+		},
+		{
+			name:      "ctas",
+			sql:       "CREATE TABLE IF NOT EXISTS iceberg.marts.daily WITH (format = 'ORC') AS SELECT * FROM facts",
+			statement: TypeCreateTableAsSelect,
+			tables:    []string{"iceberg.marts.daily", "hive.default.facts"},
+		},
+		{
+			name:      "create table",
+			sql:       "create or replace table t (id bigint, name varchar) with (partitioned_by = array['name'])",
+			statement: TypeDDL,
+			tables:    []string{"hive.default.t"},
+		},
+		{
+			name:      "drop",
+			sql:       "DROP TABLE IF EXISTS old.events",
+			statement: TypeDDL,
+			tables:    []string{"hive.old.events"},
+		},
+		{
+			name:      "explain",
+			sql:       "EXPLAIN (TYPE DISTRIBUTED) SELECT count(*) FROM events",
+			statement: TypeExplain,
+			tables:    []string{"hive.default.events"},
+		},
+		{
+			name:      "merge",
+			sql:       "MERGE INTO accounts a USING updates u ON a.id = u.id WHEN MATCHED THEN UPDATE SET balance = u.balance",
+			statement: TypeDML,
+			tables:    []string{"hive.default.accounts", "hive.default.updates"},
+		},
+		{
+			name:      "delete",
+			sql:       "delete from events where ts < now() - interval '7' day",
+			statement: TypeDML,
+			tables:    []string{"hive.default.events"},
+		},
+		{
+			name:      "parenthesized query",
+			sql:       "(select 1) union all (values 2)",
+			statement: TypeSelect,
+			tables:    []string{},
+		},
+		{
+			name:      "session statement",
+			sql:       "SET SESSION query_max_run_time = '1h'",
+			statement: TypeOther,
+			tables:    []string{},
+		},
+		{
+			name:      "empty",
+			sql:       "",
+			statement: TypeOther,
+			tables:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := Analyze(tt.sql, "Hive", "default")
+			require.Equal(t, tt.statement, analysis.Type)
+			require.Equal(t, tt.tables, tableNames(analysis.Tables))
+		})
+	}
+}
+
+func TestAnalyzeWithoutSessionSchema(t *testing.T) {
+	analysis := Analyze("select * from events", "", "")
+	require.Equal(t, []Table{{Name: "events"}}, analysis.Tables)
+}
+
+func TestTokenizeUnterminated(t *testing.T) {
+	require.Equal(t, []token{{kind: tokenWord, text: "select"}, {kind: tokenString, text: "abc"}}, tokenize("select 'abc"))
+	require.Equal(t, []token{{kind: tokenWord, text: "select"}}, tokenize("select /* comment"))
+	require.Equal(t, []token{{kind: tokenString, text: "it's"}}, tokenize("'it''s'"))
+}
+
+func TestParseType(t *testing.T) {
+	statement, err := ParseType("CTAS")
+	require.NoError(t, err)
+	require.Equal(t, TypeCreateTableAsSelect, statement)
+
+	_, err = ParseType("query")
+	require.Error(t, err)
+}
@@ -0,0 +1,123 @@
+package statement
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	// tokenWord is a keyword or an unquoted identifier, the text is lower case
+	tokenWord tokenKind = iota
+	// tokenIdentifier is a quoted identifier, the text is unquoted and lower case like trino does
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) isWord(words ...string) bool {
+	if t.kind != tokenWord {
+		return false
+	}
+	for _, w := range words {
+		if t.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (t token) isSymbol(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (t token) isName() bool {
+	return t.kind == tokenWord || t.kind == tokenIdentifier
+}
+
+// tokenize splits the statement in tokens, comments and whitespaces are discarded. The tokenizer is lenient:
+// unterminated literals and comments end at the end of the statement
+func tokenize(sql string) []token {
+	runes := []rune(sql)
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i += 2
+
+		case r == '\'' || r == '"':
+			text, next := quoted(runes, i)
+			kind := tokenString
+			if r == '"' {
+				kind = tokenIdentifier
+				text = strings.ToLower(text)
+			}
+			tokens = append(tokens, token{kind: kind, text: text})
+			i = next
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$' || runes[i] == '@' || runes[i] == ':') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToLower(string(runes[start:i]))})
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || unicode.IsLetter(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i])})
+
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(r)})
+			i++
+		}
+	}
+
+	return tokens
+}
+
+// quoted reads the literal starting at the quote in position start, a doubled quote is an escaped quote
+func quoted(runes []rune, start int) (string, int) {
+	quote := runes[start]
+
+	var text strings.Builder
+	i := start + 1
+	for i < len(runes) {
+		if runes[i] == quote {
+			if i+1 < len(runes) && runes[i+1] == quote {
+				text.WriteRune(quote)
+				i += 2
+				continue
+			}
+			return text.String(), i + 1
+		}
+		text.WriteRune(runes[i])
+		i++
+	}
+
+	return text.String(), i
+}
@@ -9,12 +9,13 @@ CREATE TABLE trino_clusters
 
 CREATE TABLE trino_queries
 (
-    id                                 varchar primary key,
-    cluster                            varchar(128) primary key,
+    id                                 varchar,
+    cluster                            varchar(128),
+    state                              varchar,
 
     query                              text,
 
-    user                               varchar,
+    "user"                             varchar,
     principal                          varchar,
     catalog                            varchar,
     schema                             varchar,
@@ -36,7 +37,7 @@ CREATE TABLE trino_queries
     resources_input_data               bigint,
     resources_physical_input_rows      bigint,
     resources_physical_input_data      bigint,
-    resources_physical_input_read_time bigint,
+    resources_physical_input_read_time interval,
     resources_internal_network_rows    bigint,
     resources_internal_network_data    bigint,
     resources_peak_user_memory         bigint,
@@ -46,6 +47,39 @@ CREATE TABLE trino_queries
     resources_output_data              bigint,
     resources_written_rows             bigint,
     resources_logical_written_data     bigint,
-    resources_physical_written_data    bigint
+    resources_physical_written_data    bigint,
 
-)
+    primary key (id, cluster)
+);
+
+CREATE INDEX trino_queries_submission_time_idx ON trino_queries (submission_time DESC, cluster DESC, id DESC);
+
+CREATE TABLE trino_sessions
+(
+    transaction_id varchar,
+    query_id       varchar,
+    coordinator    varchar(128) not null,
+    expires_at     timestamptz  not null,
+
+    primary key (transaction_id, query_id)
+);
+
+CREATE INDEX trino_sessions_expires_at_idx ON trino_sessions (expires_at);
+
+CREATE TABLE trino_routing_rules
+(
+    id                       bigserial primary key,
+    position                 integer not null,
+    "user"                   varchar not null,
+    cluster_name             varchar not null default '',
+    cluster_tags             json             default '{}',
+    use_default_if_unhealthy boolean not null default false
+);
+
+CREATE TABLE trino_routing_rules_version
+(
+    id      integer primary key default 1 check (id = 1),
+    version bigint not null
+);
+
+INSERT INTO trino_routing_rules_version (id, version) VALUES (1, 0);